@@ -0,0 +1,190 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"yarn-prometheus-exporter/yarn"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestAppTagsValidate(t *testing.T) {
+	yarn.ConstLabels = prometheus.Labels{"cluster": "prod"}
+	defer func() { yarn.ConstLabels = nil }()
+
+	cases := []struct {
+		keys []string
+		err  string
+	}{
+		{keys: []string{"team", "pipeline", "cost-center"}},
+		{keys: []string{"user"}, err: `label "user" clashes with an existing label`},
+		{keys: []string{"queue"}, err: `label "queue" clashes with an existing label`},
+		{keys: []string{"cluster"}, err: `label "cluster" clashes with a const label`},
+		{keys: []string{"cost-center", "cost_center"}, err: `label "cost_center" clashes with app tag "cost-center"`},
+		{keys: []string{"1team"}, err: `"1team" is not a valid label name`},
+		{keys: []string{"__team"}, err: `"__team" is not a valid label name`},
+		{keys: []string{""}, err: `"" is not a valid label name`},
+	}
+	for _, c := range cases {
+		err := yarn.AppTags{Keys: c.keys}.Validate()
+		switch {
+		case c.err == "" && err != nil:
+			t.Errorf("%v: unexpected error: %s", c.keys, err)
+		case c.err != "" && (err == nil || !strings.Contains(err.Error(), c.err)):
+			t.Errorf("%v: expected an error containing %s, got %v", c.keys, c.err, err)
+		}
+	}
+}
+
+func TestAppNameRules(t *testing.T) {
+	// 规则按顺序匹配，第一个匹配的规则生效；没有规则匹配时 job_name 等于应用名
+	rules := `[
+		{"pattern": "^(etl_[a-z]+)_\\d{4}-\\d{2}-\\d{2}$", "replacement": "$1"},
+		{"pattern": "^etl_.*$", "replacement": "etl"},
+		{"pattern": "^adhoc-(?P<user>[a-z]+)-[0-9]+$", "replacement": "adhoc-${user}"}
+	]`
+	path := filepath.Join(t.TempDir(), "rules.json")
+	if err := os.WriteFile(path, []byte(rules), 0644); err != nil {
+		t.Fatal(err)
+	}
+	loaded, err := yarn.LoadNameRules(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cases := []struct {
+		name    string
+		jobName string
+	}{
+		{"etl_orders_2026-10-17", "etl_orders"},
+		{"etl_orders_latest", "etl"},
+		{"adhoc-alice-42", "adhoc-alice"},
+		{"adhoc-alice", "adhoc-alice"},
+		{"report", "report"},
+	}
+	for _, c := range cases {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			app := map[string]interface{}{"id": "application_1", "name": c.name, "queue": "default", "state": "RUNNING"}
+			json.NewEncoder(w).Encode(map[string]interface{}{"apps": map[string]interface{}{"app": []interface{}{app}}})
+		}))
+		apps := newAppsCollector(t, server.URL+"/ws/v1/cluster/apps", yarn.DefaultAppTags, loaded)
+		expected := `
+# HELP yarn_elapsed_time elapsed time
+# TYPE yarn_elapsed_time gauge
+yarn_elapsed_time{applicationTags="",applicationType="",finalStatus="",id="application_1",job_name="` + c.jobName + `",name="` + c.name + `",queue="default",state="RUNNING",user=""} 0
+`
+		if err := testutil.CollectAndCompare(apps, strings.NewReader(expected), "yarn_elapsed_time"); err != nil {
+			t.Errorf("%s: %s", c.name, err)
+		}
+		server.Close()
+	}
+}
+
+func TestLoadNameRulesErrors(t *testing.T) {
+	dir := t.TempDir()
+	if _, err := yarn.LoadNameRules(filepath.Join(dir, "missing.json")); err == nil {
+		t.Error("expected an error for a missing file")
+	}
+	path := filepath.Join(dir, "invalid.json")
+	if err := os.WriteFile(path, []byte(`[{"pattern": "(", "replacement": ""}]`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	rules, err := yarn.LoadNameRules(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := yarn.NewAppsCollector(parseEndpoint("http://localhost:8088/ws/v1/cluster/apps"), yarn.DefaultAppTags, rules); err == nil {
+		t.Error("expected an error for an invalid pattern")
+	}
+}
+
+func TestAppsRestoreFinished(t *testing.T) {
+	apps := &fakeApps{}
+	server := httptest.NewServer(apps)
+	defer server.Close()
+
+	finished := func(id string, started int64, duration int64) map[string]interface{} {
+		return map[string]interface{}{
+			"id": id, "queue": "default", "user": "alice", "applicationType": "SPARK", "state": "FINISHED",
+			"finalStatus": "FAILED", "startedTime": started, "finishedTime": started + duration,
+		}
+	}
+	old := finished("application_1_0001", 1700000000000, 10000)
+	counted := finished("application_1_0002", 1700000100000, 90000)
+	downtime := finished("application_1_0003", 1700000200000, 30000)
+
+	// 第一次采集只记录已结束的应用，第二次计入新结束的应用
+	c := newAppsCollector(t, server.URL+"/ws/v1/cluster/apps", yarn.DefaultAppTags, nil)
+	c.CacheTTL = 0
+	apps.set(old)
+	testutil.CollectAndCount(c)
+	apps.set(old, counted)
+	testutil.CollectAndCount(c)
+	data, err := c.Snapshot()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// 重启后 counted 不重复计入，停机期间结束的 downtime 计入一次
+	restored := newAppsCollector(t, server.URL+"/ws/v1/cluster/apps", yarn.DefaultAppTags, nil)
+	restored.CacheTTL = 0
+	if err := restored.Restore(data); err != nil {
+		t.Fatal(err)
+	}
+	apps.set(old, counted, downtime)
+	expected := `
+# HELP yarn_application_failures_total applications finished with finalStatus FAILED
+# TYPE yarn_application_failures_total counter
+yarn_application_failures_total{applicationType="SPARK",queue="default",user="alice"} 2
+`
+	if err := testutil.CollectAndCompare(restored, strings.NewReader(expected), "yarn_application_failures_total"); err != nil {
+		t.Error(err)
+	}
+
+	registry := prometheus.NewPedanticRegistry()
+	registry.MustRegister(restored)
+	families, err := registry.Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, family := range families {
+		if family.GetName() != "yarn_application_duration_seconds" {
+			continue
+		}
+		h := family.Metric[0].Histogram
+		testValue(t, "duration count", 2, int(h.GetSampleCount()))
+		testValue(t, "duration sum", 120, int(h.GetSampleSum()))
+		return
+	}
+	t.Error("yarn_application_duration_seconds not collected")
+}
+
+func TestAppsFinishedWithoutStart(t *testing.T) {
+	apps := &fakeApps{}
+	server := httptest.NewServer(apps)
+	defer server.Close()
+
+	c := newAppsCollector(t, server.URL+"/ws/v1/cluster/apps", yarn.DefaultAppTags, nil)
+	c.CacheTTL = 0
+	testutil.CollectAndCount(c)
+
+	// 启动前就结束的应用只计入失败数，不计入耗时
+	apps.set(map[string]interface{}{
+		"id": "application_1_0001", "queue": "default", "user": "alice", "applicationType": "SPARK", "state": "FAILED",
+		"finalStatus": "FAILED", "startedTime": 0, "finishedTime": 1700000000000,
+	})
+	expected := `
+# HELP yarn_application_failures_total applications finished with finalStatus FAILED
+# TYPE yarn_application_failures_total counter
+yarn_application_failures_total{applicationType="SPARK",queue="default",user="alice"} 1
+`
+	if err := testutil.CollectAndCompare(c, strings.NewReader(expected), "yarn_application_failures_total", "yarn_application_duration_seconds"); err != nil {
+		t.Error(err)
+	}
+}
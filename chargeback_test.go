@@ -0,0 +1,222 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+	"yarn-prometheus-exporter/yarn"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+/**
+模拟 RM 的 apps 接口，每次采集前替换返回的应用
+*/
+
+type fakeApps struct {
+	mu   sync.Mutex
+	apps []map[string]interface{}
+}
+
+func (f *fakeApps) set(apps ...map[string]interface{}) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.apps = apps
+}
+
+func (f *fakeApps) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	json.NewEncoder(w).Encode(map[string]interface{}{"apps": map[string]interface{}{"app": f.apps}})
+}
+
+func chargebackApp(id string, user string, started int64, memorySeconds int, vcoreSeconds int) map[string]interface{} {
+	return map[string]interface{}{
+		"id": id, "queue": "default", "user": user, "applicationType": "SPARK", "state": "RUNNING",
+		"startedTime": started, "memorySeconds": memorySeconds, "vcoreSeconds": vcoreSeconds,
+	}
+}
+
+func newChargebackCollector(t *testing.T, url string) *yarn.ChargebackCollector {
+	apps := newAppsCollector(t, url+"/ws/v1/cluster/apps", yarn.DefaultAppTags, nil)
+	apps.CacheTTL = 0
+	return yarn.NewChargebackCollector(apps, 0.001, 0.01)
+}
+
+func TestChargebackBaseline(t *testing.T) {
+	rm := &fakeApps{}
+	server := httptest.NewServer(rm)
+	defer server.Close()
+	c := newChargebackCollector(t, server.URL)
+	later := time.Now().UnixNano()/int64(time.Millisecond) + 60000
+
+	// 第一次采集只记录基线，已经运行的 alice 不计入
+	rm.set(chargebackApp("application_1", "alice", 1700000000000, 100000, 100))
+	if n := testutil.CollectAndCount(c, "yarn_chargeback_memory_seconds_total"); n != 0 {
+		t.Errorf("expected no usage after the first scrape, got %d series", n)
+	}
+
+	// alice 只计入增量；bob 在基线之后启动，全部计入；carol 在基线之前启动但第一次出现，不计入
+	rm.set(
+		chargebackApp("application_1", "alice", 1700000000000, 150000, 130),
+		chargebackApp("application_2", "bob", later, 2000, 4),
+		chargebackApp("application_3", "carol", 1700000000000, 900000, 900),
+	)
+	expected := `
+# HELP yarn_chargeback_memory_seconds_total memory seconds consumed by applications :MB
+# TYPE yarn_chargeback_memory_seconds_total counter
+yarn_chargeback_memory_seconds_total{applicationType="SPARK",queue="default",user="alice"} 50000
+yarn_chargeback_memory_seconds_total{applicationType="SPARK",queue="default",user="bob"} 2000
+# HELP yarn_chargeback_v_core_seconds_total core seconds consumed by applications
+# TYPE yarn_chargeback_v_core_seconds_total counter
+yarn_chargeback_v_core_seconds_total{applicationType="SPARK",queue="default",user="alice"} 30
+yarn_chargeback_v_core_seconds_total{applicationType="SPARK",queue="default",user="bob"} 4
+# HELP yarn_cost_units_total cost units of memory and core seconds consumed by applications
+# TYPE yarn_cost_units_total counter
+yarn_cost_units_total{applicationType="SPARK",queue="default",user="alice"} 50.3
+yarn_cost_units_total{applicationType="SPARK",queue="default",user="bob"} 2.04
+`
+	names := []string{"yarn_chargeback_memory_seconds_total", "yarn_chargeback_v_core_seconds_total", "yarn_cost_units_total"}
+	if err := testutil.CollectAndCompare(c, strings.NewReader(expected), names...); err != nil {
+		t.Error(err)
+	}
+
+	// 恢复状态后基线不变，重启期间的增量照常计入
+	data, err := c.Snapshot()
+	if err != nil {
+		t.Fatal(err)
+	}
+	restored := newChargebackCollector(t, server.URL)
+	if err := restored.Restore(data); err != nil {
+		t.Fatal(err)
+	}
+	rm.set(
+		chargebackApp("application_1", "alice", 1700000000000, 150000, 130),
+		chargebackApp("application_2", "bob", later, 3000, 4),
+		chargebackApp("application_3", "carol", 1700000000000, 900100, 900),
+	)
+	expected = `
+# HELP yarn_chargeback_memory_seconds_total memory seconds consumed by applications :MB
+# TYPE yarn_chargeback_memory_seconds_total counter
+yarn_chargeback_memory_seconds_total{applicationType="SPARK",queue="default",user="alice"} 50000
+yarn_chargeback_memory_seconds_total{applicationType="SPARK",queue="default",user="bob"} 3000
+yarn_chargeback_memory_seconds_total{applicationType="SPARK",queue="default",user="carol"} 100
+`
+	if err := testutil.CollectAndCompare(restored, strings.NewReader(expected), "yarn_chargeback_memory_seconds_total"); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestChargebackRestoreWithoutCreated(t *testing.T) {
+	server := httptest.NewServer(&fakeApps{})
+	defer server.Close()
+
+	// 没有 created 的行按恢复时间作为 created，而不是 1970 年
+	before := time.Now().Truncate(time.Millisecond)
+	c := newChargebackCollector(t, server.URL)
+	state := `{"baseline": 1700000000000, "apps": {}, "usage": [{"queue": "default", "user": "alice", "applicationType": "SPARK", "memorySeconds": 1000}], "failureCount": 2}`
+	if err := c.Restore([]byte(state)); err != nil {
+		t.Fatal(err)
+	}
+	registry := prometheus.NewPedanticRegistry()
+	registry.MustRegister(c)
+	families, err := registry.Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, family := range families {
+		if family.GetName() != "yarn_chargeback_memory_seconds_total" {
+			continue
+		}
+		for _, m := range family.Metric {
+			if created := m.Counter.CreatedTimestamp.AsTime(); created.Before(before) {
+				t.Errorf("expected created at restore time, got %s", created)
+			}
+		}
+		// 失败次数和用量一起恢复
+		expected := `
+# HELP yarn_chargeback_scrape_failures_total Number of errors while accumulating chargeback usage
+# TYPE yarn_chargeback_scrape_failures_total counter
+yarn_chargeback_scrape_failures_total 2
+`
+		if err := testutil.CollectAndCompare(c, strings.NewReader(expected), "yarn_chargeback_scrape_failures_total"); err != nil {
+			t.Error(err)
+		}
+		return
+	}
+	t.Error("yarn_chargeback_memory_seconds_total not collected")
+}
+
+func TestChargebackRestoreMergesRemovedTags(t *testing.T) {
+	server := httptest.NewServer(&fakeApps{})
+	defer server.Close()
+
+	// 保存状态时按 team 和 pipeline 划分，恢复时只保留 team，pipeline 不同的两行合并，created 取较早的一行
+	state := `{"baseline": 1700000000000, "apps": {}, "usage": [
+		{"queue": "default", "user": "alice", "applicationType": "SPARK", "tags": {"team": "data", "pipeline": "a"}, "memorySeconds": 1000, "vcoreSeconds": 1, "costUnits": 1, "created": 1700000300000},
+		{"queue": "default", "user": "alice", "applicationType": "SPARK", "tags": {"team": "data", "pipeline": "b"}, "memorySeconds": 2000, "vcoreSeconds": 2, "costUnits": 2, "created": 1700000100000},
+		{"queue": "default", "user": "alice", "applicationType": "SPARK", "tags": {"team": "ml", "pipeline": "a"}, "memorySeconds": 4000, "vcoreSeconds": 4, "costUnits": 4, "created": 1700000200000}
+	]}`
+	apps := newAppsCollector(t, server.URL+"/ws/v1/cluster/apps", yarn.AppTags{Keys: []string{"team"}}, nil)
+	apps.CacheTTL = 0
+	c := yarn.NewChargebackCollector(apps, 0.001, 0.01)
+	if err := c.Restore([]byte(state)); err != nil {
+		t.Fatal(err)
+	}
+	expected := `
+# HELP yarn_chargeback_memory_seconds_total memory seconds consumed by applications :MB
+# TYPE yarn_chargeback_memory_seconds_total counter
+yarn_chargeback_memory_seconds_total{applicationType="SPARK",queue="default",team="data",user="alice"} 3000
+yarn_chargeback_memory_seconds_total{applicationType="SPARK",queue="default",team="ml",user="alice"} 4000
+`
+	if err := testutil.CollectAndCompare(c, strings.NewReader(expected), "yarn_chargeback_memory_seconds_total"); err != nil {
+		t.Error(err)
+	}
+
+	data, err := c.Snapshot()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var saved struct {
+		Usage []struct {
+			Tags    map[string]string `json:"tags"`
+			Created int64             `json:"created"`
+		} `json:"usage"`
+	}
+	if err := json.Unmarshal(data, &saved); err != nil {
+		t.Fatal(err)
+	}
+	if len(saved.Usage) != 2 || saved.Usage[0].Created != 1700000100000 || len(saved.Usage[0].Tags) != 1 {
+		t.Errorf("unexpected merged state: %s", data)
+	}
+}
+
+func TestChargebackRestoreMergesRemovedJobNames(t *testing.T) {
+	rm := &fakeApps{}
+	server := httptest.NewServer(rm)
+	defer server.Close()
+
+	// 保存状态时配置了改写规则，恢复时没有规则，job_name 不同的两行合并，之后的增量累加到合并后的一行
+	state := `{"baseline": 1700000000000, "apps": {"application_1": {"memorySeconds": 1000, "vcoreSeconds": 1}}, "usage": [
+		{"queue": "default", "user": "alice", "applicationType": "SPARK", "jobName": "etl", "memorySeconds": 1000, "created": 1700000100000},
+		{"queue": "default", "user": "alice", "applicationType": "SPARK", "jobName": "adhoc", "memorySeconds": 2000, "created": 1700000200000}
+	]}`
+	c := newChargebackCollector(t, server.URL)
+	if err := c.Restore([]byte(state)); err != nil {
+		t.Fatal(err)
+	}
+	rm.set(chargebackApp("application_1", "alice", 1700000000000, 1500, 1))
+	expected := `
+# HELP yarn_chargeback_memory_seconds_total memory seconds consumed by applications :MB
+# TYPE yarn_chargeback_memory_seconds_total counter
+yarn_chargeback_memory_seconds_total{applicationType="SPARK",queue="default",user="alice"} 3500
+`
+	if err := testutil.CollectAndCompare(c, strings.NewReader(expected), "yarn_chargeback_memory_seconds_total"); err != nil {
+		t.Error(err)
+	}
+}
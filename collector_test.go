@@ -44,6 +44,11 @@ func TestDecodeJSON(t *testing.T) {
 	testValue(t, "RebootedNodes", 23, c.ClusterMetrics.RebootedNodes)
 	testValue(t, "ActiveNodes", 24, c.ClusterMetrics.ActiveNodes)
 	testValue(t, "ShutdownNodes", 25, c.ClusterMetrics.ShutdownNodes)
+
+	total := c.ClusterMetrics.TotalClusterResourcesAcrossPartition
+	testValue(t, "TotalClusterResourcesAcrossPartition.Memory", 729088, total.Memory)
+	testValue(t, "TotalClusterResourcesAcrossPartition.ResourceInformation", 2, len(total.ResourceInformations.ResourceInformation))
+	testValue(t, "TotalClusterResourcesAcrossPartition.vcores", 96, int(total.ResourceInformations.ResourceInformation[1].Value))
 }
 
 func testValue(t *testing.T, metric string, expected int, actual int) {
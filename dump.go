@@ -0,0 +1,150 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"text/tabwriter"
+	"time"
+	"yarn-prometheus-exporter/yarn"
+
+	dto "github.com/prometheus/client_model/go"
+	"github.com/prometheus/common/expfmt"
+)
+
+/**
+dump 子命令：按当前配置运行一次所有 collector，把指标以 text、json 或 table 格式打印到标准输出。
+后台拉取的 collector（JobHistory、Timeline）先同步拉取一次。跨采集累加的指标（chargeback 用量、
+应用耗时和失败数）第一次采集只记录基线，dump 中没有样本。
+-v 时把每个数据源的原始响应打印到标准错误。任何一次请求失败或采集出错时返回非 0
+*/
+
+func runDump(args []string) int {
+	return dump(args, os.Stdout, os.Stderr)
+}
+
+// dump 是 runDump 的实现，输出写到给定的 stdout 和 stderr
+func dump(args []string, stdout io.Writer, stderr io.Writer) int {
+	flags := flag.NewFlagSet("dump", flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	format := flags.String("format", "text", "output format: text, json or table")
+	verbose := flags.Bool("v", false, "print the raw responses of every endpoint to stderr")
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+	if *format != "text" && *format != "json" && *format != "table" {
+		fmt.Fprintln(stderr, "unknown format: "+*format)
+		return 2
+	}
+
+	var mu sync.Mutex
+	failures := 0
+	defer func() { yarn.FetchHook = nil }()
+	yarn.FetchHook = func(u *url.URL, body []byte, err error) {
+		mu.Lock()
+		defer mu.Unlock()
+		if err != nil {
+			failures++
+		}
+		if *verbose {
+			fmt.Fprintf(stderr, "# GET %s\n%s\n", u, body)
+			if err != nil {
+				fmt.Fprintf(stderr, "# error: %s\n", err)
+			}
+		}
+	}
+
+	loadEnv()
+	registry, _, pollers := newRegistry()
+	pollOnce(pollers)
+	families, err := registry.Gather()
+	if err != nil {
+		fmt.Fprintln(stderr, "Error while gathering metrics: "+err.Error())
+		failures++
+	}
+
+	switch *format {
+	case "text":
+		err = writeText(stdout, families)
+	case "json":
+		err = writeJSON(stdout, families)
+	case "table":
+		err = writeTable(stdout, families)
+	}
+	if err != nil {
+		fmt.Fprintln(stderr, err)
+		return 1
+	}
+
+	if failures > 0 {
+		fmt.Fprintf(stderr, "%d collection errors\n", failures)
+		return 1
+	}
+	return 0
+}
+
+func writeText(w io.Writer, families []*dto.MetricFamily) error {
+	encoder := expfmt.NewEncoder(w, expfmt.NewFormat(expfmt.TypeTextPlain))
+	for _, f := range families {
+		if err := encoder.Encode(f); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+type dumpSample struct {
+	Name   string            `json:"name"`
+	Labels map[string]string `json:"labels"`
+	Value  float64           `json:"value"`
+}
+
+/**
+把指标展开为样本，直方图和 summary 展开为 _bucket、_sum、_count
+*/
+
+func dumpSamples(families []*dto.MetricFamily) []*dumpSample {
+	var samples []*dumpSample
+	for _, s := range toTimeSeries(families, time.Now()) {
+		sample := &dumpSample{Labels: make(map[string]string), Value: s.value}
+		for _, l := range s.labels {
+			if l[0] == "__name__" {
+				sample.Name = l[1]
+				continue
+			}
+			sample.Labels[l[0]] = l[1]
+		}
+		samples = append(samples, sample)
+	}
+	return samples
+}
+
+func writeJSON(w io.Writer, families []*dto.MetricFamily) error {
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(dumpSamples(families))
+}
+
+func writeTable(w io.Writer, families []*dto.MetricFamily) error {
+	tw := tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(tw, "NAME\tLABELS\tVALUE")
+	for _, s := range dumpSamples(families) {
+		names := make([]string, 0, len(s.Labels))
+		for name := range s.Labels {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		labels := make([]string, 0, len(names))
+		for _, name := range names {
+			labels = append(labels, name+"="+s.Labels[name])
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%g\n", s.Name, strings.Join(labels, ","), s.Value)
+	}
+	return tw.Flush()
+}
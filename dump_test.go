@@ -0,0 +1,123 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+/**
+把 RM 地址指向 handler，返回 dump 的退出码和输出
+*/
+
+func runDumpAgainst(t *testing.T, handler http.Handler, args ...string) (int, string, string) {
+	server := httptest.NewServer(handler)
+	defer server.Close()
+	u, _ := url.Parse(server.URL)
+	t.Setenv("YARN_PROMETHEUS_ENDPOINT_HOST", u.Hostname())
+	t.Setenv("YARN_PROMETHEUS_ENDPOINT_PORT", u.Port())
+
+	var stdout, stderr bytes.Buffer
+	code := dump(args, &stdout, &stderr)
+	return code, stdout.String(), stderr.String()
+}
+
+func TestDumpFormats(t *testing.T) {
+	fixtures := replayHandler(filepath.Join("testdata", "fixtures", "hadoop-3.3"))
+
+	code, stdout, stderr := runDumpAgainst(t, fixtures, "-format", "text")
+	if code != 0 {
+		t.Fatalf("expected exit code 0, got %d: %s", code, stderr)
+	}
+	if !strings.Contains(stdout, "# TYPE yarn_up gauge\nyarn_up 1\n") {
+		t.Errorf("yarn_up missing from text output:\n%s", stdout)
+	}
+
+	code, stdout, _ = runDumpAgainst(t, fixtures, "-format", "json")
+	if code != 0 {
+		t.Fatalf("expected exit code 0, got %d", code)
+	}
+	var samples []*dumpSample
+	if err := json.Unmarshal([]byte(stdout), &samples); err != nil {
+		t.Fatal(err)
+	}
+	found := false
+	for _, s := range samples {
+		if s.Name == "yarn_capacity" && s.Labels["queueName"] == "default" {
+			found = true
+			if s.Value != 40 {
+				t.Errorf("error asserting [yarn_capacity]: expected: 40, actual: %v", s.Value)
+			}
+		}
+	}
+	if !found {
+		t.Error("yarn_capacity of the default queue missing from JSON output")
+	}
+
+	code, stdout, _ = runDumpAgainst(t, fixtures, "-format", "table")
+	if code != 0 {
+		t.Fatalf("expected exit code 0, got %d", code)
+	}
+	if !strings.HasPrefix(stdout, "NAME") || !strings.Contains(stdout, "queueName=default") {
+		t.Errorf("unexpected table output:\n%s", stdout)
+	}
+}
+
+func TestDumpFailures(t *testing.T) {
+	// scheduler 请求失败时以非 0 退出，-v 打印原始响应
+	fixtures := replayHandler(filepath.Join("testdata", "fixtures", "hadoop-3.3"))
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/ws/v1/cluster/scheduler" {
+			http.Error(w, "scheduler unavailable", http.StatusServiceUnavailable)
+			return
+		}
+		fixtures.ServeHTTP(w, r)
+	})
+
+	code, _, stderr := runDumpAgainst(t, handler, "-v")
+	if code != 1 {
+		t.Errorf("expected exit code 1, got %d", code)
+	}
+	if !strings.Contains(stderr, "/ws/v1/cluster/metrics\n") || !strings.Contains(stderr, "scheduler unavailable") {
+		t.Errorf("raw responses missing from stderr:\n%s", stderr)
+	}
+	if !strings.Contains(stderr, "collection errors") {
+		t.Errorf("collection errors not reported:\n%s", stderr)
+	}
+
+	if code, _, _ := runDumpAgainst(t, handler, "-format", "yaml"); code != 2 {
+		t.Errorf("expected exit code 2 for an unknown format, got %d", code)
+	}
+}
+
+func TestDumpPollsJobHistory(t *testing.T) {
+	jhs := &fakeJobHistory{failing: make(map[string]bool)}
+	jhs.add("job_1", "default", time.Now().UnixMilli()+60000)
+	fixtures := replayHandler(filepath.Join("testdata", "fixtures", "hadoop-3.3"))
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasPrefix(r.URL.Path, "/ws/v1/history/") {
+			jhs.ServeHTTP(w, r)
+			return
+		}
+		fixtures.ServeHTTP(w, r)
+	})
+	server := httptest.NewServer(handler)
+	defer server.Close()
+	t.Setenv("YARN_JHS_PROMETHEUS_ENDPOINT", server.URL+"/ws/v1/history/mapreduce/jobs")
+	t.Cleanup(func() { jhsEP = nil })
+
+	// JobHistory 在后台拉取，dump 先同步拉取一次，否则没有作业指标
+	code, stdout, stderr := runDumpAgainst(t, handler, "-format", "text")
+	if code != 0 {
+		t.Fatalf("expected exit code 0, got %d: %s", code, stderr)
+	}
+	if !strings.Contains(stdout, `yarn_jhs_jobs_completed_total{queue="default",state="SUCCEEDED",user="alice"} 1`) {
+		t.Errorf("jobs polled from the JobHistory Server missing from text output:\n%s", stdout)
+	}
+}
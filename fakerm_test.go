@@ -0,0 +1,66 @@
+package main
+
+import (
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+	"yarn-prometheus-exporter/yarn"
+	"yarn-prometheus-exporter/yarn/fakerm"
+)
+
+func TestFakeRM(t *testing.T) {
+	cluster := fakerm.New(1, 4, "default", "etl")
+	now := time.Now()
+	for i := 1; i <= 30; i++ {
+		cluster.Step(now.Add(time.Duration(i) * 10 * time.Second))
+	}
+	server := httptest.NewServer(cluster)
+	defer server.Close()
+	u, _ := url.Parse(server.URL)
+	t.Setenv("YARN_PROMETHEUS_ENDPOINT_HOST", u.Hostname())
+	t.Setenv("YARN_PROMETHEUS_ENDPOINT_PORT", u.Port())
+
+	failures := 0
+	yarn.FetchHook = func(u *url.URL, body []byte, err error) {
+		if err != nil {
+			failures++
+		}
+	}
+	defer func() { yarn.FetchHook = nil }()
+
+	loadEnv()
+	registry, _, _ := newRegistry()
+	families, err := registry.Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	values := map[string]float64{}
+	for _, series := range toTimeSeries(families, time.Now()) {
+		for _, l := range series.labels {
+			if l[0] == "__name__" {
+				values[l[1]] += series.value
+			}
+		}
+	}
+	testValue(t, "yarn_up", 1, int(values["yarn_up"]))
+	if values["yarn_applications_submitted"] == 0 {
+		t.Error("no applications submitted")
+	}
+	if values["yarn_applications_completed"] == 0 {
+		t.Error("no applications completed")
+	}
+	if values["yarn_node_num_containers"] == 0 {
+		t.Error("no containers allocated")
+	}
+	if values["yarn_memory_allocated"] != values["yarn_node_used_memory"] {
+		t.Errorf("cluster and node memory disagree: %v != %v", values["yarn_memory_allocated"], values["yarn_node_used_memory"])
+	}
+	for _, name := range []string{"yarn_partition_capacity", "yarn_queue_used_resource", "yarn_cluster_total_resource", "yarn_node_used_resource", "yarn_jmx_cluster_num_active_n_ms", "yarn_jmx_queue_apps_submitted"} {
+		if _, ok := values[name]; !ok {
+			t.Errorf("missing metric %s", name)
+		}
+	}
+	testValue(t, "failures", 0, failures)
+}
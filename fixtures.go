@@ -0,0 +1,169 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+	"yarn-prometheus-exporter/yarn"
+	"yarn-prometheus-exporter/yarn/fakerm"
+)
+
+/**
+fixture 文件名：请求路径加上 .json，有查询参数时在路径后追加 @ 和转义后的查询参数，
+例如 ws/v1/cluster/apps@states=RUNNING.json
+*/
+
+func fixtureName(u *url.URL) string {
+	name := strings.Trim(u.Path, "/")
+	if name == "" {
+		name = "index"
+	}
+	if u.RawQuery != "" {
+		name += "@" + strings.NewReplacer("/", "%2F", "*", "%2A", ":", "%3A").Replace(u.RawQuery)
+	}
+	return filepath.FromSlash(name) + ".json"
+}
+
+// fixtureHost 是保存其它主机响应的子目录名，: 同样转义
+func fixtureHost(host string) string {
+	return strings.ReplaceAll(host, ":", "%3A")
+}
+
+/**
+RM 的响应直接保存在 dir 下；NodeManager、JHS 等其它主机的响应保存在以 host:port 命名的子目录中，
+多个 NodeManager 的同一路径不会互相覆盖
+*/
+
+func fixturePath(u *url.URL, rm *url.URL) string {
+	if u.Host == rm.Host {
+		return fixtureName(u)
+	}
+	return filepath.Join(fixtureHost(u.Host), fixtureName(u))
+}
+
+/**
+record 子命令：按当前配置运行一次所有 collector，把每个数据源的原始响应保存到 -dir 目录。
+后台拉取的 collector（JobHistory、Timeline）先同步拉取一次，它们的响应也会被保存
+*/
+
+func runRecord(args []string) int {
+	flags := flag.NewFlagSet("record", flag.ContinueOnError)
+	dir := flags.String("dir", "fixtures", "directory to write the responses to")
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+
+	var mu sync.Mutex
+	failures := 0
+	defer func() { yarn.FetchHook = nil }()
+	yarn.FetchHook = func(u *url.URL, body []byte, err error) {
+		mu.Lock()
+		defer mu.Unlock()
+		if err != nil {
+			failures++
+			fmt.Fprintf(os.Stderr, "# error: GET %s: %s\n", u, err)
+			return
+		}
+		path := filepath.Join(*dir, fixturePath(u, cep))
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err == nil {
+			err = os.WriteFile(path, body, 0644)
+		}
+		if err != nil {
+			failures++
+			fmt.Fprintln(os.Stderr, err)
+			return
+		}
+		fmt.Fprintln(os.Stderr, "# recorded "+path)
+	}
+
+	loadEnv()
+	registry, _, pollers := newRegistry()
+	pollOnce(pollers)
+	if _, err := registry.Gather(); err != nil {
+		fmt.Fprintln(os.Stderr, "Error while gathering metrics: "+err.Error())
+		failures++
+	}
+
+	if failures > 0 {
+		fmt.Fprintf(os.Stderr, "%d collection errors\n", failures)
+		return 1
+	}
+	return 0
+}
+
+/**
+replayHandler 把 record 保存的响应按请求路径和查询参数返回：先查找以请求的 Host 命名的子目录，
+再查找 dir 本身，都没有对应文件时返回 404。路径、查询参数或 Host 中含有 .. 或反斜杠，
+或 Host 中含有 / 的请求返回 400，不会读取 dir 之外的文件
+*/
+
+func replayHandler(dir string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.Contains(r.URL.Path+r.URL.RawQuery+r.Host, "..") || strings.ContainsAny(r.URL.Path+r.URL.RawQuery+r.Host, `\`) || strings.Contains(r.Host, "/") {
+			http.Error(w, "invalid fixture name", http.StatusBadRequest)
+			return
+		}
+		name := fixtureName(r.URL)
+		body, err := os.ReadFile(filepath.Join(dir, fixtureHost(r.Host), name))
+		if os.IsNotExist(err) {
+			body, err = os.ReadFile(filepath.Join(dir, name))
+		}
+		if os.IsNotExist(err) {
+			http.NotFound(w, r)
+			return
+		}
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write(body)
+	})
+}
+
+/**
+replay 子命令：以 fake RM 的方式提供 -dir 目录中的响应
+*/
+
+func runReplay(args []string) int {
+	flags := flag.NewFlagSet("replay", flag.ContinueOnError)
+	dir := flags.String("dir", "fixtures", "directory with recorded responses")
+	listen := flags.String("addr", ":8088", "address to serve the responses on")
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+
+	log.Println("回放 " + *dir + "，监听 " + *listen)
+	log.Println(http.ListenAndServe(*listen, replayHandler(*dir)))
+	return 1
+}
+
+/**
+fakerm 子命令：提供一个模拟集群，状态每隔 -interval 推进一次
+*/
+
+func runFakeRM(args []string) int {
+	flags := flag.NewFlagSet("fakerm", flag.ContinueOnError)
+	listen := flags.String("addr", ":8088", "address to serve the fake ResourceManager on")
+	nodes := flags.Int("nodes", 8, "number of simulated nodes")
+	queues := flags.String("queues", "default,etl,adhoc", "comma separated leaf queues")
+	interval := flags.Duration("interval", 5*time.Second, "how often the simulated cluster changes")
+	seed := flags.Int64("seed", time.Now().UnixNano(), "random seed of the simulation")
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+
+	cluster := fakerm.New(*seed, *nodes, strings.Split(*queues, ",")...)
+	go cluster.Run(*interval, make(chan struct{}))
+
+	log.Println("模拟 ResourceManager 监听 " + *listen)
+	log.Println(http.ListenAndServe(*listen, cluster))
+	return 1
+}
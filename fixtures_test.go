@@ -0,0 +1,213 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+	"yarn-prometheus-exporter/yarn"
+)
+
+func TestReplayFixtures(t *testing.T) {
+	dirs, err := filepath.Glob(filepath.Join("testdata", "fixtures", "*"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(dirs) == 0 {
+		t.Fatal("no fixtures found")
+	}
+
+	for _, dir := range dirs {
+		t.Run(filepath.Base(dir), func(t *testing.T) {
+			server := httptest.NewServer(replayHandler(dir))
+			defer server.Close()
+			u, _ := url.Parse(server.URL)
+			t.Setenv("YARN_PROMETHEUS_ENDPOINT_HOST", u.Hostname())
+			t.Setenv("YARN_PROMETHEUS_ENDPOINT_PORT", u.Port())
+
+			yarn.FetchHook = func(u *url.URL, body []byte, err error) {
+				if err != nil {
+					t.Errorf("GET %s: %s", u, err)
+				}
+			}
+			defer func() { yarn.FetchHook = nil }()
+
+			loadEnv()
+			registry, _, _ := newRegistry()
+			families, err := registry.Gather()
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			values := map[string]float64{}
+			for _, series := range toTimeSeries(families, time.Now()) {
+				for _, l := range series.labels {
+					if l[0] == "__name__" {
+						values[l[1]] = series.value
+					}
+				}
+			}
+			testValue(t, "yarn_up", 1, int(values["yarn_up"]))
+			for _, name := range []string{"yarn_applications_submitted", "yarn_capacity", "yarn_elapsed_time", "yarn_node_used_memory"} {
+				if _, ok := values[name]; !ok {
+					t.Errorf("missing metric %s", name)
+				}
+			}
+		})
+	}
+}
+
+func TestFixtureName(t *testing.T) {
+	u, _ := url.Parse("http://localhost:8088/jmx?qry=Hadoop:service=ResourceManager,*")
+	expected := filepath.FromSlash("jmx@qry=Hadoop%3Aservice=ResourceManager,%2A.json")
+	if name := fixtureName(u); name != expected {
+		t.Errorf("error asserting fixture name: expected: %s, actual: %s", expected, name)
+	}
+	if _, err := os.Stat(filepath.Join("testdata", "fixtures", "sample", expected)); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestReplayRejectsTraversal(t *testing.T) {
+	handler := replayHandler(filepath.Join("testdata", "fixtures", "sample"))
+	for _, target := range []string{
+		"/ws/v1/cluster/../../../../golden/apps",
+		"/ws/v1/cluster/apps?x=/../../../golden/apps",
+		"/ws/v1/cluster/apps%5C..%5Cscheduler",
+	} {
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, httptest.NewRequest("GET", target, nil))
+		if w.Code != 400 {
+			t.Errorf("GET %s: expected status 400, got %d", target, w.Code)
+		}
+	}
+
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest("GET", "/ws/v1/cluster/apps", nil))
+	if w.Code != 200 {
+		t.Errorf("GET /ws/v1/cluster/apps: expected status 200, got %d", w.Code)
+	}
+}
+
+func TestConstLabels(t *testing.T) {
+	server := httptest.NewServer(replayHandler(filepath.Join("testdata", "fixtures", "sample")))
+	defer server.Close()
+	u, _ := url.Parse(server.URL)
+	t.Setenv("YARN_PROMETHEUS_ENDPOINT_HOST", u.Hostname())
+	t.Setenv("YARN_PROMETHEUS_ENDPOINT_PORT", u.Port())
+	t.Setenv("YARN_CONST_LABELS", "env=test, datacenter=dc1")
+	defer func() { yarn.ConstLabels = nil }()
+
+	loadEnv()
+	registry, _, _ := newRegistry()
+	families, err := registry.Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(families) == 0 {
+		t.Fatal("no metrics gathered")
+	}
+	for _, family := range families {
+		for _, m := range family.Metric {
+			labels := map[string]string{}
+			for _, l := range m.Label {
+				labels[l.GetName()] = l.GetValue()
+			}
+			if labels["env"] != "test" || labels["datacenter"] != "dc1" {
+				t.Errorf("%s is missing the constant labels: %v", family.GetName(), labels)
+				break
+			}
+		}
+	}
+}
+
+func TestFixturePath(t *testing.T) {
+	rm, _ := url.Parse("http://rm.hadoop.lan:8088/ws/v1/cluster/metrics")
+	for _, c := range []struct {
+		url      string
+		expected string
+	}{
+		{"http://rm.hadoop.lan:8088/ws/v1/cluster/apps", "ws/v1/cluster/apps.json"},
+		{"http://nm1.hadoop.lan:8042/ws/v1/node/info", "nm1.hadoop.lan%3A8042/ws/v1/node/info.json"},
+		{"http://nm2.hadoop.lan:8042/ws/v1/node/info", "nm2.hadoop.lan%3A8042/ws/v1/node/info.json"},
+	} {
+		u, _ := url.Parse(c.url)
+		if path := fixturePath(u, rm); path != filepath.FromSlash(c.expected) {
+			t.Errorf("error asserting fixture path of %s: expected: %s, actual: %s", c.url, filepath.FromSlash(c.expected), path)
+		}
+	}
+}
+
+func TestReplayByHost(t *testing.T) {
+	dir := t.TempDir()
+	for path, body := range map[string]string{
+		"ws/v1/node/info.json":                       `{"nodeInfo": {"id": "rm"}}`,
+		"nm1.hadoop.lan%3A8042/ws/v1/node/info.json": `{"nodeInfo": {"id": "nm1"}}`,
+		"nm2.hadoop.lan%3A8042/ws/v1/node/info.json": `{"nodeInfo": {"id": "nm2"}}`,
+	} {
+		path = filepath.Join(dir, filepath.FromSlash(path))
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(body), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// 按 Host 选择子目录，没有对应子目录时使用 dir 下的文件
+	handler := replayHandler(dir)
+	for host, expected := range map[string]string{
+		"nm1.hadoop.lan:8042": "nm1",
+		"nm2.hadoop.lan:8042": "nm2",
+		"localhost:8088":      "rm",
+	} {
+		r := httptest.NewRequest("GET", "/ws/v1/node/info", nil)
+		r.Host = host
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, r)
+		if !strings.Contains(w.Body.String(), `"`+expected+`"`) {
+			t.Errorf("GET %s/ws/v1/node/info: expected the response of %s, got %d %s", host, expected, w.Code, w.Body.String())
+		}
+	}
+
+	r := httptest.NewRequest("GET", "/ws/v1/node/info", nil)
+	r.Host = ".."
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, r)
+	if w.Code != 400 {
+		t.Errorf("Host ..: expected status 400, got %d", w.Code)
+	}
+}
+
+func TestRecordPollsJobHistory(t *testing.T) {
+	jhs := &fakeJobHistory{failing: make(map[string]bool)}
+	jhs.add("job_1", "default", time.Now().UnixMilli()+60000)
+	fixtures := replayHandler(filepath.Join("testdata", "fixtures", "hadoop-3.3"))
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasPrefix(r.URL.Path, "/ws/v1/history/") {
+			jhs.ServeHTTP(w, r)
+			return
+		}
+		fixtures.ServeHTTP(w, r)
+	}))
+	defer server.Close()
+	u, _ := url.Parse(server.URL)
+	t.Setenv("YARN_PROMETHEUS_ENDPOINT_HOST", u.Hostname())
+	t.Setenv("YARN_PROMETHEUS_ENDPOINT_PORT", u.Port())
+	t.Setenv("YARN_JHS_PROMETHEUS_ENDPOINT", server.URL+"/ws/v1/history/mapreduce/jobs")
+	t.Cleanup(func() { jhsEP = nil })
+	defer func() { yarn.FetchHook = nil }()
+
+	// JobHistory 在后台拉取，record 先同步拉取一次，作业列表和详情也被保存
+	dir := t.TempDir()
+	if code := runRecord([]string{"-dir", dir}); code != 0 {
+		t.Fatalf("expected exit code 0, got %d", code)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "ws", "v1", "history", "mapreduce", "jobs", "job_1.json")); err != nil {
+		t.Error(err)
+	}
+}
@@ -0,0 +1,274 @@
+package main
+
+import (
+	"flag"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"yarn-prometheus-exporter/yarn"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/prometheus/common/expfmt"
+)
+
+var update = flag.Bool("update", false, "rewrite the golden files in testdata/golden")
+
+func TestGoldenExposition(t *testing.T) {
+	server := httptest.NewServer(replayHandler(filepath.Join("testdata", "fixtures", "sample")))
+	defer server.Close()
+	base := server.URL + "/ws/v1/cluster/"
+
+	collectors := map[string]func(t *testing.T) prometheus.Collector{
+		"cluster-v2": func(t *testing.T) prometheus.Collector {
+			return yarn.WithNaming(yarn.NewClusterCollector(parseEndpoint(base+"metrics"), parseEndpoint(base+"info")), yarn.NamingV2)
+		},
+		"scheduler-v2": func(t *testing.T) prometheus.Collector {
+			return yarn.WithNaming(yarn.NewSchedulerCollector(parseEndpoint(base+"scheduler")), yarn.NamingV2)
+		},
+		"apps-tags": func(t *testing.T) prometheus.Collector {
+			tags := yarn.AppTags{Keys: []string{"team", "pipeline", "cost_center"}}
+			return newAppsCollector(t, base+"apps", tags, nil)
+		},
+		"apps-jobs": func(t *testing.T) prometheus.Collector {
+			rules, err := yarn.LoadNameRules(filepath.Join("testdata", "app_name_rules.json"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			return newAppsCollector(t, base+"apps", yarn.DefaultAppTags, rules)
+		},
+		"apps-v2": func(t *testing.T) prometheus.Collector {
+			return yarn.WithNaming(newAppsCollector(t, base+"apps", yarn.DefaultAppTags, nil), yarn.NamingV2)
+		},
+		"nodes-v2": func(t *testing.T) prometheus.Collector {
+			return yarn.WithNaming(yarn.NewNodesCollector(parseEndpoint(base+"nodes")), yarn.NamingV2)
+		},
+		"node-labels-v2": func(t *testing.T) prometheus.Collector {
+			return yarn.WithNaming(yarn.NewNodeLabelsCollector(parseEndpoint(base+"get-node-labels")), yarn.NamingV2)
+		},
+		"cluster": func(t *testing.T) prometheus.Collector {
+			return yarn.NewClusterCollector(parseEndpoint(base+"metrics"), parseEndpoint(base+"info"))
+		},
+		"scheduler": func(t *testing.T) prometheus.Collector {
+			return yarn.NewSchedulerCollector(parseEndpoint(base + "scheduler"))
+		},
+		"apps": func(t *testing.T) prometheus.Collector {
+			return newAppsCollector(t, base+"apps", yarn.DefaultAppTags, nil)
+		},
+	}
+
+	for name, newCollector := range collectors {
+		t.Run(name, func(t *testing.T) {
+			compareGolden(t, filepath.Join("testdata", "golden", name+".prom"), newCollector)
+		})
+	}
+}
+
+/**
+各个 Hadoop 版本的 fixture 覆盖分区、资源类型、节点标签和 JMX，每个目录对应 testdata/golden 下的同名目录
+*/
+
+func TestGoldenFixtures(t *testing.T) {
+	dirs, err := filepath.Glob(filepath.Join("testdata", "fixtures", "hadoop-*"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(dirs) == 0 {
+		t.Fatal("no fixtures found")
+	}
+
+	for _, dir := range dirs {
+		server := httptest.NewServer(replayHandler(dir))
+		base := server.URL + "/ws/v1/cluster/"
+		collectors := map[string]func(t *testing.T) prometheus.Collector{
+			"cluster": func(t *testing.T) prometheus.Collector {
+				return yarn.NewClusterCollector(parseEndpoint(base+"metrics"), parseEndpoint(base+"info"))
+			},
+			"scheduler": func(t *testing.T) prometheus.Collector {
+				return yarn.NewSchedulerCollector(parseEndpoint(base + "scheduler"))
+			},
+			"node-labels": func(t *testing.T) prometheus.Collector {
+				return yarn.NewNodeLabelsCollector(parseEndpoint(base + "get-node-labels"))
+			},
+			"nodes": func(t *testing.T) prometheus.Collector {
+				return yarn.NewNodesCollector(parseEndpoint(base + "nodes"))
+			},
+			"jmx": func(t *testing.T) prometheus.Collector {
+				c, err := yarn.NewJmxCollector(parseEndpoint(server.URL+"/jmx?qry=Hadoop:service=ResourceManager,*"), yarn.DefaultJmxRules)
+				if err != nil {
+					t.Fatal(err)
+				}
+				return c
+			},
+		}
+		for name, newCollector := range collectors {
+			t.Run(filepath.Base(dir)+"/"+name, func(t *testing.T) {
+				compareGolden(t, filepath.Join("testdata", "golden", filepath.Base(dir), name+".prom"), newCollector)
+			})
+		}
+		server.Close()
+	}
+}
+
+func compareGolden(t *testing.T, golden string, newCollector func(t *testing.T) prometheus.Collector) {
+	if *update {
+		writeGolden(t, golden, newCollector(t))
+	}
+	f, err := os.Open(golden)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	if err := testutil.CollectAndCompare(newCollector(t), f); err != nil {
+		t.Errorf("%s (run go test -update if the change is intended)", err)
+	}
+}
+
+func newAppsCollector(t *testing.T, endpoint string, tags yarn.AppTags, rules []*yarn.NameRule) *yarn.ApplicationCollector {
+	c, err := yarn.NewAppsCollector(parseEndpoint(endpoint), tags, rules)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return c
+}
+
+func writeGolden(t *testing.T, path string, c prometheus.Collector) {
+	registry := prometheus.NewPedanticRegistry()
+	registry.MustRegister(c)
+	families, err := registry.Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		t.Fatal(err)
+	}
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	encoder := expfmt.NewEncoder(f, expfmt.NewFormat(expfmt.TypeTextPlain))
+	for _, family := range families {
+		if err := encoder.Encode(family); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestCounterCreatedTimestamps(t *testing.T) {
+	server := httptest.NewServer(replayHandler(filepath.Join("testdata", "fixtures", "sample")))
+	defer server.Close()
+	base := server.URL + "/ws/v1/cluster/"
+
+	registry := prometheus.NewPedanticRegistry()
+	registry.MustRegister(
+		yarn.WithNaming(yarn.NewClusterCollector(parseEndpoint(base+"metrics"), parseEndpoint(base+"info")), yarn.NamingBoth),
+		yarn.WithNaming(newAppsCollector(t, base+"apps", yarn.DefaultAppTags, nil), yarn.NamingBoth),
+	)
+	families, err := registry.Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// 只有 v2 的 _total counter 带 created：应用计数以 RM 的 startedOn 为准，资源用量以各应用的 startedTime 为准；
+	// v1 名称保持原来的类型，集群的应用计数是 counter，应用的资源用量是 gauge，都不带 created
+	rm := map[int64]bool{1700000000000: true}
+	apps := map[int64]bool{1700000000000: true, 1700000100000: true}
+	expected := map[string]map[int64]bool{
+		"yarn_cluster_applications_submitted_total": rm,
+		"yarn_cluster_applications_failed_total":    rm,
+		"yarn_app_memory_byte_seconds_total":        apps,
+		"yarn_app_v_core_seconds_total":             apps,
+		"yarn_applications_submitted":               nil,
+		"yarn_applications_failed":                  nil,
+		"yarn_memory_seconds":                       nil,
+		"yarn_v_core_seconds":                       nil,
+	}
+	v1Types := map[string]dto.MetricType{
+		"yarn_applications_submitted": dto.MetricType_COUNTER,
+		"yarn_applications_failed":    dto.MetricType_COUNTER,
+		"yarn_memory_seconds":         dto.MetricType_GAUGE,
+		"yarn_v_core_seconds":         dto.MetricType_GAUGE,
+	}
+	for _, family := range families {
+		allowed, ok := expected[family.GetName()]
+		if !ok {
+			continue
+		}
+		delete(expected, family.GetName())
+		for _, m := range family.Metric {
+			if allowed == nil {
+				if family.GetType() != v1Types[family.GetName()] {
+					t.Errorf("%s changed type to %s", family.GetName(), family.GetType())
+				}
+				if m.Counter != nil && m.Counter.CreatedTimestamp != nil {
+					t.Errorf("%s has a created timestamp", family.GetName())
+				}
+				continue
+			}
+			if m.Counter == nil || m.Counter.CreatedTimestamp == nil {
+				t.Errorf("%s has no created timestamp", family.GetName())
+				continue
+			}
+			if created := m.Counter.CreatedTimestamp.AsTime().UnixMilli(); !allowed[created] {
+				t.Errorf("unexpected created timestamp of %s: %d", family.GetName(), created)
+			}
+		}
+	}
+	for name := range expected {
+		t.Errorf("missing metric %s", name)
+	}
+}
+
+func TestOpenMetricsExposition(t *testing.T) {
+	server := httptest.NewServer(replayHandler(filepath.Join("testdata", "fixtures", "sample")))
+	defer server.Close()
+	base := server.URL + "/ws/v1/cluster/"
+
+	registry := prometheus.NewPedanticRegistry()
+	registry.MustRegister(
+		yarn.WithNaming(yarn.NewClusterCollector(parseEndpoint(base+"metrics"), parseEndpoint(base+"info")), yarn.NamingBoth),
+		yarn.WithNaming(newAppsCollector(t, base+"apps", yarn.DefaultAppTags, nil), yarn.NamingBoth),
+	)
+	handler := promhttp.HandlerFor(registry, promhttp.HandlerOpts{
+		Registry:                            registry,
+		EnableOpenMetrics:                   true,
+		EnableOpenMetricsTextCreatedSamples: true,
+	})
+	req := httptest.NewRequest("GET", "/metrics", nil)
+	req.Header.Set("Accept", "application/openmetrics-text; version=1.0.0; charset=utf-8")
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	body := rec.Body.String()
+	if rec.Code != 200 || !strings.HasPrefix(rec.Header().Get("Content-Type"), "application/openmetrics-text") {
+		t.Fatalf("unexpected response %d %s:\n%s", rec.Code, rec.Header().Get("Content-Type"), body)
+	}
+
+	// v1 名称保持原来的类型：应用计数是 counter，但名称没有 _total 后缀，OpenMetrics 下按 unknown 输出；
+	// 资源用量是 gauge。_created 样本只出现在 v2 的 _total counter 上
+	for _, line := range []string{
+		"# TYPE yarn_applications_submitted unknown\n",
+		"yarn_applications_submitted 1.0\n",
+		"# TYPE yarn_memory_seconds gauge\n",
+		"# TYPE yarn_cluster_applications_submitted counter\n",
+		"yarn_cluster_applications_submitted_created 1.7e+09\n",
+		"# TYPE yarn_app_memory_byte_seconds counter\n",
+	} {
+		if !strings.Contains(body, line) {
+			t.Errorf("missing %q", line)
+		}
+	}
+	for _, line := range []string{
+		"yarn_applications_submitted_created",
+		"yarn_memory_seconds_created",
+		"yarn_v_core_seconds_created",
+	} {
+		if strings.Contains(body, line) {
+			t.Errorf("unexpected %q", line)
+		}
+	}
+}
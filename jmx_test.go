@@ -0,0 +1,216 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"yarn-prometheus-exporter/yarn"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+/**
+用给定的 bean 和规则采集一次
+*/
+
+func collectJmx(t *testing.T, rules []*yarn.JmxRule, beans ...map[string]interface{}) prometheus.Collector {
+	body, err := json.Marshal(map[string]interface{}{"beans": beans})
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write(body)
+	}))
+	t.Cleanup(server.Close)
+
+	c, err := yarn.NewJmxCollector(parseEndpoint(server.URL+"/jmx"), rules)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return c
+}
+
+func TestJmxMetricNames(t *testing.T) {
+	// 属性名转为 snake_case
+	cases := map[string]string{
+		"MemHeapUsedM":        "yarn_jmx_test_mem_heap_used_m",
+		"NumActiveNMs":        "yarn_jmx_test_num_active_n_ms",
+		"RpcQueueTimeAvgTime": "yarn_jmx_test_rpc_queue_time_avg_time",
+		"GcCountG1YoungGen":   "yarn_jmx_test_gc_count_g1_young_gen",
+		"running_60":          "yarn_jmx_test_running_60",
+		"HTTPRequests":        "yarn_jmx_test_http_requests",
+	}
+	for attribute, expected := range cases {
+		bean := map[string]interface{}{"name": "Hadoop:service=ResourceManager,name=Test", attribute: 1}
+		c := collectJmx(t, []*yarn.JmxRule{{Bean: "name=Test$", Name: "test"}}, bean)
+		if n := testutil.CollectAndCount(c, expected); n != 1 {
+			t.Errorf("%s: expected one %s, got %d", attribute, expected, n)
+		}
+	}
+}
+
+func TestJmxValues(t *testing.T) {
+	// 数值和布尔属性直接导出，JSON 数组字符串导出长度，其它属性忽略
+	bean := map[string]interface{}{
+		"name":             "Hadoop:service=ResourceManager,name=RMNMInfo",
+		"modelerType":      "org.apache.hadoop.yarn.server.resourcemanager.RMNMInfo",
+		"LiveNodeManagers": `[{"HostName":"worker-1"},{"HostName":"worker-2"}]`,
+		"Enabled":          true,
+		"Disabled":         false,
+		"Ratio":            0.25,
+		"Description":      "[not json",
+		"Tag":              nil,
+	}
+	expected := `
+# HELP yarn_jmx_rm_disabled Hadoop:service=ResourceManager,name=RMNMInfo Disabled
+# TYPE yarn_jmx_rm_disabled gauge
+yarn_jmx_rm_disabled 0
+# HELP yarn_jmx_rm_enabled Hadoop:service=ResourceManager,name=RMNMInfo Enabled
+# TYPE yarn_jmx_rm_enabled gauge
+yarn_jmx_rm_enabled 1
+# HELP yarn_jmx_rm_live_node_managers Hadoop:service=ResourceManager,name=RMNMInfo LiveNodeManagers
+# TYPE yarn_jmx_rm_live_node_managers gauge
+yarn_jmx_rm_live_node_managers 2
+# HELP yarn_jmx_rm_ratio Hadoop:service=ResourceManager,name=RMNMInfo Ratio
+# TYPE yarn_jmx_rm_ratio gauge
+yarn_jmx_rm_ratio 0.25
+`
+	c := collectJmx(t, []*yarn.JmxRule{{Bean: "name=RMNMInfo$", Name: "rm"}}, bean)
+	if err := testutil.CollectAndCompare(c, strings.NewReader(expected)); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestJmxBeanLabels(t *testing.T) {
+	// bean name 中的 key=value 作为标签，Name 为空时指标名取 name= 的值；
+	// 比规则更深的队列层级连接到最后一个 qN 标签，不会与上级队列重复
+	queue := func(props string, running int) map[string]interface{} {
+		return map[string]interface{}{"name": "Hadoop:service=ResourceManager,name=QueueMetrics," + props, "AppsRunning": running}
+	}
+	expected := `
+# HELP yarn_jmx_queue_metrics_apps_running Hadoop:service=ResourceManager,name=QueueMetrics,q0=root AppsRunning
+# TYPE yarn_jmx_queue_metrics_apps_running gauge
+yarn_jmx_queue_metrics_apps_running{q0="root",q1="",user=""} 6
+yarn_jmx_queue_metrics_apps_running{q0="root",q1="a",user=""} 6
+yarn_jmx_queue_metrics_apps_running{q0="root",q1="a.b",user=""} 5
+yarn_jmx_queue_metrics_apps_running{q0="root",q1="a.b.c",user=""} 4
+yarn_jmx_queue_metrics_apps_running{q0="root",q1="a.b.c",user="alice"} 3
+`
+	c := collectJmx(t, []*yarn.JmxRule{{Bean: "name=QueueMetrics,", Labels: []string{"q0", "q1", "user"}}},
+		queue("q0=root", 6),
+		queue("q0=root,q1=a", 6),
+		queue("q0=root,q1=a,q2=b", 5),
+		queue("q0=root,q1=a,q2=b,q3=c", 4),
+		queue("q0=root,q1=a,q2=b,q3=c,user=alice", 3),
+	)
+	if err := testutil.CollectAndCompare(c, strings.NewReader(expected)); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestJmxDeepQueues(t *testing.T) {
+	// 默认规则只有 q0 到 q3，更深的队列不能与上级队列重复，否则整个 scrape 失败
+	var beans []map[string]interface{}
+	props := "q0=root"
+	for _, q := range []string{"a", "b", "c", "d", "e"} {
+		props += ",q" + string(rune('0'+len(beans)+1)) + "=" + q
+		beans = append(beans, map[string]interface{}{"name": "Hadoop:service=ResourceManager,name=QueueMetrics," + props, "AppsRunning": 1})
+	}
+	registry := prometheus.NewPedanticRegistry()
+	registry.MustRegister(collectJmx(t, yarn.DefaultJmxRules, beans...))
+	if _, err := registry.Gather(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestJmxRulesWithConflictingLabels(t *testing.T) {
+	rules := []*yarn.JmxRule{
+		{Bean: "name=QueueMetrics,", Name: "queue", Labels: []string{"q0", "q1"}},
+		{Bean: "name=QueueMetrics,", Name: "queue", Labels: []string{"q0", "user"}},
+	}
+	if _, err := yarn.NewJmxCollector(parseEndpoint("http://localhost:8088/jmx"), rules); err == nil {
+		t.Error("expected an error for rules sharing a name with different labels")
+	}
+	if _, err := yarn.NewJmxCollector(parseEndpoint("http://localhost:8088/jmx"), yarn.DefaultJmxRules); err != nil {
+		t.Error(err)
+	}
+
+	// 冲突按最终的指标名判断：同名规则的属性不重叠，或者 Name 为空时，标签可以不同
+	allowed := [][]*yarn.JmxRule{
+		{
+			{Bean: "name=JvmMetrics$", Name: "jvm", Attributes: []string{"GcCount"}},
+			{Bean: "name=JvmMetrics$", Name: "jvm", Attributes: []string{"MemHeapUsedM"}, Labels: []string{"name"}},
+		},
+		{
+			{Bean: "name=QueueMetrics,", Labels: []string{"q0"}},
+			{Bean: "name=ClusterMetrics$", Labels: []string{"name"}},
+		},
+	}
+	for _, rules := range allowed {
+		if _, err := yarn.NewJmxCollector(parseEndpoint("http://localhost:8088/jmx"), rules); err != nil {
+			t.Error(err)
+		}
+	}
+	overlapping := []*yarn.JmxRule{
+		{Bean: "name=JvmMetrics$", Name: "jvm", Attributes: []string{"GcCount"}},
+		{Bean: "name=JvmMetrics$", Name: "jvm", Attributes: []string{"GcCount", "MemHeapUsedM"}, Labels: []string{"name"}},
+	}
+	if _, err := yarn.NewJmxCollector(parseEndpoint("http://localhost:8088/jmx"), overlapping); err == nil {
+		t.Error("expected an error for rules producing the same metric with different labels")
+	}
+}
+
+func TestJmxRulesNotShared(t *testing.T) {
+	// 编译规则时使用副本，不修改共享的 DefaultJmxRules
+	if _, err := yarn.NewJmxCollector(parseEndpoint("http://localhost:8088/jmx"), yarn.DefaultJmxRules); err != nil {
+		t.Fatal(err)
+	}
+	for _, rule := range yarn.DefaultJmxRules {
+		if !reflect.ValueOf(rule).Elem().FieldByName("beanPattern").IsNil() {
+			t.Errorf("rule %s was compiled in place", rule.Bean)
+		}
+	}
+}
+
+func TestJmxCounters(t *testing.T) {
+	// counter 以 _total 结尾，毫秒换算为秒
+	bean := map[string]interface{}{"name": "Hadoop:service=ResourceManager,name=JvmMetrics", "GcCount": 12, "GcTimeMillis": 1500, "MemHeapUsedM": 100}
+	expected := `
+# HELP yarn_jmx_jvm_gc_count_total Hadoop:service=ResourceManager,name=JvmMetrics GcCount
+# TYPE yarn_jmx_jvm_gc_count_total counter
+yarn_jmx_jvm_gc_count_total 12
+# HELP yarn_jmx_jvm_gc_time_seconds_total Hadoop:service=ResourceManager,name=JvmMetrics GcTimeMillis
+# TYPE yarn_jmx_jvm_gc_time_seconds_total counter
+yarn_jmx_jvm_gc_time_seconds_total 1.5
+# HELP yarn_jmx_jvm_mem_heap_used_m Hadoop:service=ResourceManager,name=JvmMetrics MemHeapUsedM
+# TYPE yarn_jmx_jvm_mem_heap_used_m gauge
+yarn_jmx_jvm_mem_heap_used_m 100
+`
+	c := collectJmx(t, yarn.DefaultJmxRules, bean)
+	names := []string{"yarn_jmx_jvm_gc_count_total", "yarn_jmx_jvm_gc_time_seconds_total", "yarn_jmx_jvm_mem_heap_used_m"}
+	if err := testutil.CollectAndCompare(c, strings.NewReader(expected), names...); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestJmxConflictingUnnamedRules(t *testing.T) {
+	// Name 为空的规则只有采集时才知道指标名，标签不同的指标跳过，而不是让整个 scrape 失败
+	rules := []*yarn.JmxRule{
+		{Bean: "name=QueueMetrics,", Labels: []string{"q0"}},
+		{Bean: "name=QueueMetrics,", Labels: []string{"q0", "q1"}},
+	}
+	bean := map[string]interface{}{"name": "Hadoop:service=ResourceManager,name=QueueMetrics,q0=root,q1=a", "AppsRunning": 1}
+	registry := prometheus.NewPedanticRegistry()
+	registry.MustRegister(collectJmx(t, rules, bean))
+	families, err := registry.Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(families) != 1 || len(families[0].Metric) != 1 || len(families[0].Metric[0].Label) != 1 {
+		t.Errorf("expected only the first rule's series, got %v", families)
+	}
+}
@@ -0,0 +1,206 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+	"yarn-prometheus-exporter/yarn"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+/**
+模拟 JHS 的作业列表和作业详情接口，列表按 finishedTimeBegin 过滤
+*/
+
+type fakeJobHistory struct {
+	mu       sync.Mutex
+	jobs     []map[string]interface{}
+	failing  map[string]bool
+	requests int
+}
+
+func (f *fakeJobHistory) add(id string, queue string, finishTime int64) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.jobs = append(f.jobs, map[string]interface{}{
+		"id": id, "queue": queue, "user": "alice", "state": "SUCCEEDED",
+		"startTime": finishTime - 90000, "finishTime": finishTime,
+		"mapsTotal": 10, "reducesTotal": 2, "failedMapAttempts": 1,
+	})
+}
+
+func (f *fakeJobHistory) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.requests++
+
+	const prefix = "/ws/v1/history/mapreduce/jobs"
+	if id := strings.TrimPrefix(strings.TrimPrefix(r.URL.Path, prefix), "/"); id != "" {
+		for _, j := range f.jobs {
+			if j["id"] == id && !f.failing[id] {
+				json.NewEncoder(w).Encode(map[string]interface{}{"job": j})
+				return
+			}
+		}
+		http.Error(w, "unavailable", http.StatusInternalServerError)
+		return
+	}
+	begin, _ := strconv.ParseInt(r.URL.Query().Get("finishedTimeBegin"), 10, 64)
+	var jobs []map[string]interface{}
+	for _, j := range f.jobs {
+		if j["finishTime"].(int64) >= begin {
+			jobs = append(jobs, j)
+		}
+	}
+	json.NewEncoder(w).Encode(map[string]interface{}{"jobs": map[string]interface{}{"job": jobs}})
+}
+
+func TestJobHistoryPolling(t *testing.T) {
+	jhs := &fakeJobHistory{failing: make(map[string]bool)}
+	server := httptest.NewServer(jhs)
+	defer server.Close()
+
+	c := yarn.NewJobHistoryCollector(parseEndpoint(server.URL+"/ws/v1/history/mapreduce/jobs"), time.Minute)
+	finished := time.Now().UnixNano()/int64(time.Millisecond) + 60000
+	jhs.add("job_1", "default", finished)
+	jhs.add("job_2", "default", finished+1000)
+	jhs.add("job_3", "prod", finished+1000)
+	jhs.failing["job_3"] = true
+
+	// job_3 的详情请求失败，游标停在 job_2，下次从 job_3 继续
+	if err := c.Poll(); err == nil {
+		t.Fatal("expected an error for the failing job detail")
+	}
+	delete(jhs.failing, "job_3")
+	if err := c.Poll(); err != nil {
+		t.Fatal(err)
+	}
+	// 与游标同一毫秒完成的作业只计一次
+	jhs.add("job_4", "prod", finished+1000)
+	if err := c.Poll(); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Poll(); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := `
+# HELP yarn_jhs_jobs_completed_total MapReduce jobs completed
+# TYPE yarn_jhs_jobs_completed_total counter
+yarn_jhs_jobs_completed_total{queue="default",state="SUCCEEDED",user="alice"} 2
+yarn_jhs_jobs_completed_total{queue="prod",state="SUCCEEDED",user="alice"} 2
+# HELP yarn_jhs_map_tasks_total map tasks of completed jobs
+# TYPE yarn_jhs_map_tasks_total counter
+yarn_jhs_map_tasks_total{queue="default",user="alice"} 20
+yarn_jhs_map_tasks_total{queue="prod",user="alice"} 20
+# HELP yarn_jhs_failed_map_attempts_total failed map attempts of completed jobs
+# TYPE yarn_jhs_failed_map_attempts_total counter
+yarn_jhs_failed_map_attempts_total{queue="default",user="alice"} 2
+yarn_jhs_failed_map_attempts_total{queue="prod",user="alice"} 2
+`
+	jhs.mu.Lock()
+	requests := jhs.requests
+	jhs.mu.Unlock()
+	err := testutil.CollectAndCompare(c, strings.NewReader(expected),
+		"yarn_jhs_jobs_completed_total", "yarn_jhs_map_tasks_total", "yarn_jhs_failed_map_attempts_total")
+	if err != nil {
+		t.Error(err)
+	}
+	if n := testutil.CollectAndCount(c, "yarn_jhs_job_duration_seconds"); n != 2 {
+		t.Errorf("expected 2 duration histograms, got %d", n)
+	}
+
+	// 采集只输出已累加的指标，不请求 JHS
+	jhs.mu.Lock()
+	defer jhs.mu.Unlock()
+	if jhs.requests != requests {
+		t.Errorf("expected no requests while collecting, got %d", jhs.requests-requests)
+	}
+}
+
+func TestJobHistoryRun(t *testing.T) {
+	jhs := &fakeJobHistory{failing: make(map[string]bool)}
+	jhs.add("job_1", "default", time.Now().UnixNano()/int64(time.Millisecond)+60000)
+	server := httptest.NewServer(jhs)
+	defer server.Close()
+
+	// Run 启动后立即拉取一次，stop 关闭后返回
+	c := yarn.NewJobHistoryCollector(parseEndpoint(server.URL+"/ws/v1/history/mapreduce/jobs"), time.Hour)
+	stop := make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		c.Run(stop)
+		close(done)
+	}()
+	deadline := time.Now().Add(5 * time.Second)
+	for testutil.CollectAndCount(c, "yarn_jhs_jobs_completed_total") == 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("job not polled after Run started")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	close(stop)
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Run did not return after stop")
+	}
+}
+
+func TestJobHistoryRestoresCounters(t *testing.T) {
+	jhs := &fakeJobHistory{failing: make(map[string]bool)}
+	server := httptest.NewServer(jhs)
+	defer server.Close()
+	endpoint := parseEndpoint(server.URL + "/ws/v1/history/mapreduce/jobs")
+
+	c := yarn.NewJobHistoryCollector(endpoint, time.Minute)
+	jhs.add("job_1", "default", time.Now().UnixNano()/int64(time.Millisecond)+60000)
+	if err := c.Poll(); err != nil {
+		t.Fatal(err)
+	}
+	data, err := c.Snapshot()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// 重启后计数器和直方图从保存的值继续，已经计入的作业不会重复计入
+	restored := yarn.NewJobHistoryCollector(endpoint, time.Minute)
+	if err := restored.Restore(data); err != nil {
+		t.Fatal(err)
+	}
+	if err := restored.Poll(); err != nil {
+		t.Fatal(err)
+	}
+	expected := `
+# HELP yarn_jhs_jobs_completed_total MapReduce jobs completed
+# TYPE yarn_jhs_jobs_completed_total counter
+yarn_jhs_jobs_completed_total{queue="default",state="SUCCEEDED",user="alice"} 1
+# HELP yarn_jhs_job_duration_seconds duration of completed jobs
+# TYPE yarn_jhs_job_duration_seconds histogram
+yarn_jhs_job_duration_seconds_bucket{queue="default",user="alice",le="60"} 0
+yarn_jhs_job_duration_seconds_bucket{queue="default",user="alice",le="120"} 1
+yarn_jhs_job_duration_seconds_bucket{queue="default",user="alice",le="240"} 1
+yarn_jhs_job_duration_seconds_bucket{queue="default",user="alice",le="480"} 1
+yarn_jhs_job_duration_seconds_bucket{queue="default",user="alice",le="960"} 1
+yarn_jhs_job_duration_seconds_bucket{queue="default",user="alice",le="1920"} 1
+yarn_jhs_job_duration_seconds_bucket{queue="default",user="alice",le="3840"} 1
+yarn_jhs_job_duration_seconds_bucket{queue="default",user="alice",le="7680"} 1
+yarn_jhs_job_duration_seconds_bucket{queue="default",user="alice",le="15360"} 1
+yarn_jhs_job_duration_seconds_bucket{queue="default",user="alice",le="30720"} 1
+yarn_jhs_job_duration_seconds_bucket{queue="default",user="alice",le="61440"} 1
+yarn_jhs_job_duration_seconds_bucket{queue="default",user="alice",le="122880"} 1
+yarn_jhs_job_duration_seconds_bucket{queue="default",user="alice",le="+Inf"} 1
+yarn_jhs_job_duration_seconds_sum{queue="default",user="alice"} 90
+yarn_jhs_job_duration_seconds_count{queue="default",user="alice"} 1
+`
+	err = testutil.CollectAndCompare(restored, strings.NewReader(expected), "yarn_jhs_jobs_completed_total", "yarn_jhs_job_duration_seconds")
+	if err != nil {
+		t.Error(err)
+	}
+}
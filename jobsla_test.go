@@ -0,0 +1,212 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+	"yarn-prometheus-exporter/yarn"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestJobSLA(t *testing.T) {
+	server := httptest.NewServer(replayHandler(filepath.Join("testdata", "fixtures", "sample")))
+	defer server.Close()
+
+	jobs, err := yarn.LoadJobSLAs(filepath.Join("testdata", "job_slas.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	collector, err := yarn.NewJobSLACollector(newAppsCollector(t, server.URL+"/ws/v1/cluster/apps", yarn.DefaultAppTags, nil), jobs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	collector.Now = fixedNow("2023-11-16T07:00:00Z")
+
+	// adhoc 在 1700000300（2023-11-14 22:18 UTC）成功、耗时 300 秒，超出 adhoc-daily 11-16 06:00 之前的 24h 窗口；
+	// daily-etl 正在运行了 600 秒，超过 5m；other-queue 没有匹配的应用，也没有 interval
+	expected := `
+# HELP yarn_job_last_duration_seconds duration of the last successful run of the job
+# TYPE yarn_job_last_duration_seconds gauge
+yarn_job_last_duration_seconds{job="adhoc"} 300
+yarn_job_last_duration_seconds{job="adhoc-daily"} 300
+# HELP yarn_job_last_success_timestamp_seconds finish time of the last successful run of the job, in unix seconds
+# TYPE yarn_job_last_success_timestamp_seconds gauge
+yarn_job_last_success_timestamp_seconds{job="adhoc"} 1.7000003e+09
+yarn_job_last_success_timestamp_seconds{job="adhoc-daily"} 1.7000003e+09
+# HELP yarn_job_sla_breached 1 if the job missed its schedule or exceeded its max duration
+# TYPE yarn_job_sla_breached gauge
+yarn_job_sla_breached{job="adhoc"} 0
+yarn_job_sla_breached{job="adhoc-daily"} 1
+yarn_job_sla_breached{job="daily-etl"} 1
+yarn_job_sla_breached{job="other-queue"} 0
+# HELP yarn_job_sla_scrape_failures_total Number of errors while fetching applications for job SLAs
+# TYPE yarn_job_sla_scrape_failures_total counter
+yarn_job_sla_scrape_failures_total 0
+`
+	if err := testutil.CollectAndCompare(collector, strings.NewReader(expected)); err != nil {
+		t.Error(err)
+	}
+
+	// 最近一次成功通过状态保存，RM 不再返回该应用后依然可用
+	data, err := collector.Snapshot()
+	if err != nil {
+		t.Fatal(err)
+	}
+	restored, _ := yarn.NewJobSLACollector(newAppsCollector(t, server.URL+"/ws/v1/cluster/missing", yarn.DefaultAppTags, nil), jobs)
+	if err := restored.Restore(data); err != nil {
+		t.Fatal(err)
+	}
+	if err := testutil.CollectAndCompare(restored, strings.NewReader(expected), "yarn_job_last_success_timestamp_seconds"); err != nil {
+		t.Error(err)
+	}
+
+	// 拉取失败时不知道作业是否按时成功，不输出 breached，只增加失败次数
+	if n := testutil.CollectAndCount(restored, "yarn_job_sla_breached"); n != 0 {
+		t.Errorf("expected no yarn_job_sla_breached after a failed fetch, got %d series", n)
+	}
+	failures := `
+# HELP yarn_job_sla_scrape_failures_total Number of errors while fetching applications for job SLAs
+# TYPE yarn_job_sla_scrape_failures_total counter
+yarn_job_sla_scrape_failures_total 3
+`
+	if err := testutil.CollectAndCompare(restored, strings.NewReader(failures), "yarn_job_sla_scrape_failures_total"); err != nil {
+		t.Error(err)
+	}
+}
+
+func fixedNow(value string) func() time.Time {
+	now, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		panic(err)
+	}
+	return func() time.Time { return now }
+}
+
+func millis(value string) int64 {
+	t, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		panic(err)
+	}
+	return t.UnixMilli()
+}
+
+func TestJobSLABreached(t *testing.T) {
+	daily := yarn.JobSLA{Name: "etl", Pattern: "^etl", Interval: "24h", Deadline: "06:00", Timezone: "UTC"}
+	berlin := yarn.JobSLA{Name: "etl", Pattern: "^etl", Interval: "24h", Deadline: "06:00", Timezone: "Europe/Berlin"}
+	everyOtherDay := yarn.JobSLA{Name: "etl", Pattern: "^etl", Interval: "48h", Deadline: "06:00", Timezone: "UTC"}
+	sevenHours := yarn.JobSLA{Name: "etl", Pattern: "^etl", Interval: "7h", Deadline: "06:00", Timezone: "UTC"}
+	hourly := yarn.JobSLA{Name: "etl", Pattern: "^etl", Interval: "1h"}
+	capped := yarn.JobSLA{Name: "etl", Pattern: "^etl", MaxDuration: "5m"}
+	succeeded := func(started string, finished string) map[string]interface{} {
+		return map[string]interface{}{"id": "application_1", "name": "etl", "state": "FINISHED", "finalStatus": "SUCCEEDED",
+			"startedTime": millis(started), "finishedTime": millis(finished)}
+	}
+	running := func(elapsed time.Duration) map[string]interface{} {
+		return map[string]interface{}{"id": "application_2", "name": "etl", "state": "RUNNING", "elapsedTime": elapsed.Milliseconds()}
+	}
+
+	cases := []struct {
+		name     string
+		job      yarn.JobSLA
+		now      string
+		apps     []map[string]interface{}
+		breached float64
+	}{
+		{"never succeeded", daily, "2026-10-19T07:00:00Z", nil, 1},
+		{"succeeded before the deadline", daily, "2026-10-19T07:00:00Z", []map[string]interface{}{succeeded("2026-10-19T05:00:00Z", "2026-10-19T05:30:00Z")}, 0},
+		{"missed the deadline", daily, "2026-10-19T07:00:00Z", []map[string]interface{}{succeeded("2026-10-18T04:00:00Z", "2026-10-18T05:00:00Z")}, 1},
+		// 截止时间之前只检查上一个截止时间，前一天的成功依然有效
+		{"before the deadline", daily, "2026-10-19T05:00:00Z", []map[string]interface{}{succeeded("2026-10-18T04:00:00Z", "2026-10-18T05:00:00Z")}, 0},
+		{"late recovery", daily, "2026-10-19T08:00:00Z", []map[string]interface{}{succeeded("2026-10-19T07:00:00Z", "2026-10-19T07:30:00Z")}, 0},
+		// 2026-03-29 柏林切换到夏令时，截止时间是当地 06:00，窗口从前一天当地 06:00 开始
+		{"daylight saving deadline", berlin, "2026-03-29T04:30:00Z", []map[string]interface{}{succeeded("2026-03-27T05:00:00Z", "2026-03-27T05:30:00Z")}, 1},
+		{"daylight saving window", berlin, "2026-03-29T04:45:00Z", []map[string]interface{}{succeeded("2026-03-28T04:00:00Z", "2026-03-28T04:30:00Z")}, 1},
+		// 截止时间从 1970-01-01 起算：48h 的截止时间落在 10-18 和 10-20，10-19 不是截止日
+		{"every other day", everyOtherDay, "2026-10-19T07:00:00Z", []map[string]interface{}{succeeded("2026-10-17T04:00:00Z", "2026-10-17T05:00:00Z")}, 0},
+		{"every other day missed", everyOtherDay, "2026-10-20T07:00:00Z", []map[string]interface{}{succeeded("2026-10-17T04:00:00Z", "2026-10-17T05:00:00Z")}, 1},
+		// 7h 的截止时间不在午夜重新对齐，10-19 14:00 之前的最近一个是 08:00
+		{"sub-day phase", sevenHours, "2026-10-19T14:00:00Z", []map[string]interface{}{succeeded("2026-10-19T05:00:00Z", "2026-10-19T05:30:00Z")}, 0},
+		{"within the interval", hourly, "2026-10-19T07:00:00Z", []map[string]interface{}{succeeded("2026-10-19T06:00:00Z", "2026-10-19T06:30:00Z")}, 0},
+		{"outside the interval", hourly, "2026-10-19T07:00:00Z", []map[string]interface{}{succeeded("2026-10-19T05:00:00Z", "2026-10-19T05:30:00Z")}, 1},
+		{"short run", capped, "2026-10-19T07:00:00Z", []map[string]interface{}{succeeded("2026-10-19T06:00:00Z", "2026-10-19T06:04:00Z")}, 0},
+		{"long run", capped, "2026-10-19T07:00:00Z", []map[string]interface{}{succeeded("2026-10-19T06:00:00Z", "2026-10-19T06:10:00Z")}, 1},
+		{"long running", capped, "2026-10-19T07:00:00Z", []map[string]interface{}{running(10 * time.Minute)}, 1},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			rm := &fakeApps{}
+			rm.set(c.apps...)
+			server := httptest.NewServer(rm)
+			defer server.Close()
+
+			job := c.job
+			collector, err := yarn.NewJobSLACollector(newAppsCollector(t, server.URL+"/ws/v1/cluster/apps", yarn.DefaultAppTags, nil), []*yarn.JobSLA{&job})
+			if err != nil {
+				t.Fatal(err)
+			}
+			collector.Now = fixedNow(c.now)
+			expected := fmt.Sprintf(`
+# HELP yarn_job_sla_breached 1 if the job missed its schedule or exceeded its max duration
+# TYPE yarn_job_sla_breached gauge
+yarn_job_sla_breached{job="etl"} %v
+`, c.breached)
+			if err := testutil.CollectAndCompare(collector, strings.NewReader(expected), "yarn_job_sla_breached"); err != nil {
+				t.Error(err)
+			}
+		})
+	}
+}
+
+func TestJobSLADuplicateNames(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "jobs.json")
+	jobs := `[{"name": "etl", "pattern": "^etl"}, {"name": "etl", "pattern": "^daily-etl"}]`
+	if err := os.WriteFile(path, []byte(jobs), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := yarn.LoadJobSLAs(path); err == nil || !strings.Contains(err.Error(), "duplicate") {
+		t.Errorf("expected a duplicate name error, got %v", err)
+	}
+	duplicated := []*yarn.JobSLA{{Name: "etl", Pattern: "^etl"}, {Name: "etl", Pattern: "^daily-etl"}}
+	if _, err := yarn.NewJobSLACollector(nil, duplicated); err == nil {
+		t.Error("expected a duplicate name error")
+	}
+}
+
+func TestJobSLARestore(t *testing.T) {
+	server := httptest.NewServer(http.NotFoundHandler())
+	defer server.Close()
+
+	// 旧版本的快照只有按作业名索引的 map，新版本同时保存失败次数
+	for name, c := range map[string]struct {
+		state    string
+		failures int
+	}{
+		"legacy":  {`{"etl": {"lastSuccess": 1700000300000, "lastDuration": 300}}`, 1},
+		"current": {`{"jobs": {"etl": {"lastSuccess": 1700000300000, "lastDuration": 300}}, "failureCount": 2}`, 3},
+	} {
+		collector, err := yarn.NewJobSLACollector(newAppsCollector(t, server.URL+"/ws/v1/cluster/apps", yarn.DefaultAppTags, nil), []*yarn.JobSLA{{Name: "etl", Pattern: "^etl"}})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := collector.Restore([]byte(c.state)); err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		expected := fmt.Sprintf(`
+# HELP yarn_job_last_success_timestamp_seconds finish time of the last successful run of the job, in unix seconds
+# TYPE yarn_job_last_success_timestamp_seconds gauge
+yarn_job_last_success_timestamp_seconds{job="etl"} 1.7000003e+09
+# HELP yarn_job_sla_scrape_failures_total Number of errors while fetching applications for job SLAs
+# TYPE yarn_job_sla_scrape_failures_total counter
+yarn_job_sla_scrape_failures_total %d
+`, c.failures)
+		if err := testutil.CollectAndCompare(collector, strings.NewReader(expected), "yarn_job_last_success_timestamp_seconds", "yarn_job_sla_scrape_failures_total"); err != nil {
+			t.Errorf("%s: %v", name, err)
+		}
+	}
+}
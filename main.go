@@ -5,6 +5,12 @@ import (
 	"net/http"
 	"net/url"
 	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
 	"yarn-prometheus-exporter/yarn"
 
 	"github.com/prometheus/client_golang/prometheus"
@@ -12,25 +18,228 @@ import (
 )
 
 var (
-	addr string
-	cep  *url.URL
-	aep  *url.URL
-	sep  *url.URL
+	addr       string
+	cep        *url.URL
+	iep        *url.URL
+	aep        *url.URL
+	sep        *url.URL
+	nep        *url.URL
+	nodesEP    *url.URL
+	rep        *url.URL
+	jep        *url.URL
+	planQueues []string
+	jmxRules   []*yarn.JmxRule
+
+	metricNaming yarn.Naming
+	appTags      yarn.AppTags
+	appNameRules []*yarn.NameRule
+
+	nodeManagers           []string
+	nodeManagerDiscovery   bool
+	nodeManagerScheme      string
+	nodeManagerConcurrency int
+
+	jhsEP       *url.URL
+	jhsInterval time.Duration
+
+	sparkEnabled bool
+	sparkHistory *url.URL
+
+	timelineEP           *url.URL
+	timelineLookbackDays int
+	timelineFlowLimit    int
+	timelineInterval     time.Duration
+
+	jobSLAs []*yarn.JobSLA
+
+	chargebackEnabled    bool
+	chargebackMemoryRate float64
+	chargebackVCoreRate  float64
+
+	stateStore         yarn.StateStore
+	checkpointInterval time.Duration
+
+	remoteWriteEP         *url.URL
+	remoteWriteInterval   time.Duration
+	remoteWriteQueueSize  int
+	remoteWriteMaxRetries int
+
+	clusterName         string
+	pushgatewayUrl      string
+	pushgatewayJob      string
+	pushgatewayInterval time.Duration
+	pushgatewayGrouping map[string]string
 )
 
 func main() {
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "dump":
+			os.Exit(runDump(os.Args[2:]))
+		case "record":
+			os.Exit(runRecord(os.Args[2:]))
+		case "replay":
+			os.Exit(runReplay(os.Args[2:]))
+		case "fakerm":
+			os.Exit(runFakeRM(os.Args[2:]))
+		}
+	}
+
 	loadEnv()
-	c := yarn.NewClusterCollector(cep)
-	s := yarn.NewSchedulerCollector(sep)
-	a := yarn.NewAppsCollector(aep)
+	registry, states, pollers := newRegistry()
+
+	// 收到退出信号时关闭 stop，等待后台任务结束后退出
+	stop := make(chan struct{})
+	var wg sync.WaitGroup
+
+	if stateStore != nil {
+		cp, err := yarn.NewCheckpointer(stateStore, checkpointInterval, states...)
+		if err != nil {
+			log.Fatal(err)
+		}
+		registry.MustRegister(cp)
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			cp.Run(stop)
+			stateStore.Close()
+		}()
+	}
+
+	// 在恢复状态之后开始后台拉取
+	for _, p := range pollers {
+		wg.Add(1)
+		go func(p poller) {
+			defer wg.Done()
+			p.Run(stop)
+		}(p)
+	}
+
+	if remoteWriteEP != nil {
+		rw := newRemoteWriter(remoteWriteEP, registry, remoteWriteInterval, remoteWriteQueueSize, remoteWriteMaxRetries)
+		registry.MustRegister(rw)
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			rw.Run(stop)
+		}()
+	}
+
+	// Pushgateway 模式下不提供 /metrics
+	if pushgatewayUrl != "" {
+		if pushgatewayInterval == 0 {
+			err := runPushgateway(registry, stop)
+			close(stop)
+			wg.Wait()
+			if err != nil {
+				log.Fatal(err)
+			}
+			return
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			runPushgateway(registry, stop)
+		}()
+		waitForSignal(stop, &wg)
+		return
+	}
+
+	go waitForSignal(stop, &wg)
 
-	registry := prometheus.NewRegistry()
-	registry.MustRegister(c, s, a)
 	log.Println("监控服务已启动...")
-	http.Handle("/metrics", promhttp.HandlerFor(registry, promhttp.HandlerOpts{Registry: registry}))
+	http.Handle("/metrics", promhttp.HandlerFor(registry, promhttp.HandlerOpts{
+		Registry:                            registry,
+		EnableOpenMetrics:                   true,
+		EnableOpenMetricsTextCreatedSamples: true,
+	}))
 	log.Fatal(http.ListenAndServe(addr, nil))
 }
 
+func waitForSignal(stop chan struct{}, wg *sync.WaitGroup) {
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	<-signals
+	close(stop)
+	wg.Wait()
+	os.Exit(0)
+}
+
+/**
+poller 是在后台拉取数据的 collector，Run 在 stop 关闭后返回
+*/
+
+type poller interface {
+	Run(stop <-chan struct{})
+}
+
+// pollOnce 让每个 poller 同步拉取一次：stop 已经关闭，Run 立即拉取后返回
+func pollOnce(pollers []poller) {
+	stop := make(chan struct{})
+	close(stop)
+	for _, p := range pollers {
+		p.Run(stop)
+	}
+}
+
+/**
+按配置创建并注册所有 collector，同时返回其中需要持久化状态和需要后台拉取的 collector
+*/
+
+func newRegistry() (*prometheus.Registry, []yarn.Stateful, []poller) {
+	c := yarn.NewClusterCollector(cep, iep)
+	s := yarn.NewSchedulerCollector(sep)
+	a, err := yarn.NewAppsCollector(aep, appTags, appNameRules)
+	if err != nil {
+		log.Fatal(err)
+	}
+	n := yarn.NewNodeLabelsCollector(nep)
+	nodes := yarn.NewNodesCollector(nodesEP)
+	j, err := yarn.NewJmxCollector(jep, jmxRules)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	registry := prometheus.NewRegistry()
+	registry.MustRegister(yarn.WithNaming(c, metricNaming), yarn.WithNaming(s, metricNaming), yarn.WithNaming(a, metricNaming), yarn.WithNaming(n, metricNaming), yarn.WithNaming(nodes, metricNaming), j)
+	states := []yarn.Stateful{c, a}
+	var pollers []poller
+	if len(planQueues) > 0 {
+		registry.MustRegister(yarn.WithNaming(yarn.NewReservationCollector(rep, planQueues), metricNaming))
+	}
+	if len(nodeManagers) > 0 || nodeManagerDiscovery {
+		registry.MustRegister(yarn.WithNaming(yarn.NewNodeManagerCollector(nodeManagers, nodesEP, nodeManagerScheme, nodeManagerConcurrency), metricNaming))
+	}
+	if jhsEP != nil {
+		jhs := yarn.NewJobHistoryCollector(jhsEP, jhsInterval)
+		registry.MustRegister(jhs)
+		states = append(states, jhs)
+		pollers = append(pollers, jhs)
+	}
+	if sparkEnabled {
+		registry.MustRegister(yarn.NewSparkCollector(a, sparkHistory))
+	}
+	if timelineEP != nil {
+		timeline := yarn.NewTimelineCollector(timelineEP, timelineLookbackDays, timelineFlowLimit, timelineInterval)
+		registry.MustRegister(yarn.WithNaming(timeline, metricNaming))
+		pollers = append(pollers, timeline)
+	}
+	if len(jobSLAs) > 0 {
+		jobs, err := yarn.NewJobSLACollector(a, jobSLAs)
+		if err != nil {
+			log.Fatal(err)
+		}
+		registry.MustRegister(jobs)
+		states = append(states, jobs)
+	}
+	if chargebackEnabled {
+		cb := yarn.NewChargebackCollector(a, chargebackMemoryRate, chargebackVCoreRate)
+		registry.MustRegister(cb)
+		states = append(states, cb)
+	}
+	return registry, states, pollers
+}
+
 func loadEnv() {
 	log.Println("env 加载中...")
 	addr = getEnvOr("YARN_PROMETHEUS_LISTEN_ADDR", ":9113")
@@ -39,26 +248,143 @@ func loadEnv() {
 	host := getEnvOr("YARN_PROMETHEUS_ENDPOINT_HOST", "localhost")
 	port := getEnvOr("YARN_PROMETHEUS_ENDPOINT_PORT", "8088")
 	clusterPath := getEnvOr("YARN_CLUSTER_PROMETHEUS_ENDPOINT_PATH", "ws/v1/cluster/metrics")
+	infoPath := getEnvOr("YARN_CLUSTER_INFO_PROMETHEUS_ENDPOINT_PATH", "ws/v1/cluster/info")
 	appsPath := getEnvOr("YARN_APPS_PROMETHEUS_ENDPOINT_PATH", "ws/v1/cluster/apps")
 	schedulerPath := getEnvOr("YARN_SCHEDULER_PROMETHEUS_ENDPOINT_PATH", "ws/v1/cluster/scheduler")
+	nodeLabelsPath := getEnvOr("YARN_NODE_LABELS_PROMETHEUS_ENDPOINT_PATH", "ws/v1/cluster/get-node-labels")
+	nodesPath := getEnvOr("YARN_NODES_PROMETHEUS_ENDPOINT_PATH", "ws/v1/cluster/nodes")
+	reservationPath := getEnvOr("YARN_RESERVATION_PROMETHEUS_ENDPOINT_PATH", "ws/v1/cluster/reservation/list")
+	jmxPath := getEnvOr("YARN_JMX_PROMETHEUS_ENDPOINT_PATH", "jmx?qry=Hadoop:service=ResourceManager,*")
 
-	clusterUrl := scheme + "://" + host + ":" + port + "/" + clusterPath
-	appsUrl := scheme + "://" + host + ":" + port + "/" + appsPath
-	schedulerUrl := scheme + "://" + host + ":" + port + "/" + schedulerPath
+	yarn.HTTPClient.Timeout = getEnvDurationOr("YARN_HTTP_TIMEOUT", 30*time.Second)
 
-	clusterEP, err := url.Parse(clusterUrl)
-	appsEP, err := url.Parse(appsUrl)
-	schedulerEP, err := url.Parse(schedulerUrl)
+	baseUrl := scheme + "://" + host + ":" + port + "/"
+	cep = parseEndpoint(baseUrl + clusterPath)
+	iep = parseEndpoint(baseUrl + infoPath)
+	aep = parseEndpoint(baseUrl + appsPath)
+	sep = parseEndpoint(baseUrl + schedulerPath)
+	nep = parseEndpoint(baseUrl + nodeLabelsPath)
+	nodesEP = parseEndpoint(baseUrl + nodesPath)
+	rep = parseEndpoint(baseUrl + reservationPath)
+	jep = parseEndpoint(baseUrl + jmxPath)
+
+	planQueues = getEnvList("YARN_RESERVATION_PLAN_QUEUES")
+
+	// 创建 collector 之前设置，所有指标都会带上这些标签
+	yarn.ConstLabels = getEnvLabels("YARN_CONST_LABELS")
+
+	naming, err := yarn.ParseNaming(getEnvOr("YARN_METRIC_NAMING", "v1"))
 	if err != nil {
 		log.Fatal(err)
 	}
+	metricNaming = naming
 
-	cep = clusterEP
-	aep = appsEP
-	sep = schedulerEP
+	appTags = yarn.AppTags{
+		Keys:      getEnvList("YARN_APP_TAG_LABELS"),
+		Separator: getEnvOr("YARN_APP_TAG_SEPARATOR", yarn.DefaultAppTags.Separator),
+		KeepRaw:   getEnvOr("YARN_APP_RAW_TAGS", "true") == "true",
+	}
+	if err := appTags.Validate(); err != nil {
+		log.Fatal("YARN_APP_TAG_LABELS: " + err.Error())
+	}
+	appNameRules = nil
+	jobSLAs = nil
+	if jobsFile := getEnvOr("YARN_JOB_SLA_FILE", ""); jobsFile != "" {
+		jobs, err := yarn.LoadJobSLAs(jobsFile)
+		if err != nil {
+			log.Fatal(err)
+		}
+		jobSLAs = jobs
+	}
+	if rulesFile := getEnvOr("YARN_APP_NAME_RULES_FILE", ""); rulesFile != "" {
+		rules, err := yarn.LoadNameRules(rulesFile)
+		if err != nil {
+			log.Fatal(err)
+		}
+		appNameRules = rules
+	}
+
+	jmxRules = yarn.DefaultJmxRules
+	if rulesFile := getEnvOr("YARN_JMX_RULES_FILE", ""); rulesFile != "" {
+		rules, err := yarn.LoadJmxRules(rulesFile)
+		if err != nil {
+			log.Fatal(err)
+		}
+		jmxRules = rules
+	}
+
+	nodeManagers = getEnvList("YARN_NODEMANAGER_ADDRESSES")
+	nodeManagerDiscovery = getEnvOr("YARN_NODEMANAGER_DISCOVERY", "false") == "true"
+	nodeManagerScheme = getEnvOr("YARN_NODEMANAGER_SCHEME", scheme)
+	nodeManagerConcurrency = getEnvIntOr("YARN_NODEMANAGER_CONCURRENCY", 16)
+
+	if jhsUrl := getEnvOr("YARN_JHS_PROMETHEUS_ENDPOINT", ""); jhsUrl != "" {
+		jhsEP = parseEndpoint(jhsUrl)
+	}
+	jhsInterval = getEnvPositiveDurationOr("YARN_JHS_POLL_INTERVAL", time.Minute)
+
+	sparkEnabled = getEnvOr("YARN_SPARK_ENABLED", "false") == "true"
+	if historyUrl := getEnvOr("YARN_SPARK_HISTORY_SERVER", ""); historyUrl != "" {
+		sparkHistory = parseEndpoint(historyUrl)
+	}
+
+	if timelineUrl := getEnvOr("YARN_TIMELINE_READER_ENDPOINT", ""); timelineUrl != "" {
+		timelineEP = parseEndpoint(timelineUrl)
+	}
+	timelineLookbackDays = getEnvIntOr("YARN_TIMELINE_LOOKBACK_DAYS", 1)
+	timelineFlowLimit = getEnvIntOr("YARN_TIMELINE_FLOW_LIMIT", 100)
+	timelineInterval = getEnvPositiveDurationOr("YARN_TIMELINE_POLL_INTERVAL", time.Minute)
+
+	chargebackEnabled = getEnvOr("YARN_CHARGEBACK_ENABLED", "false") == "true"
+	chargebackMemoryRate = getEnvFloatOr("YARN_CHARGEBACK_MEMORY_RATE", 0)
+	chargebackVCoreRate = getEnvFloatOr("YARN_CHARGEBACK_VCORE_RATE", 0)
+
+	checkpointInterval = getEnvPositiveDurationOr("YARN_STATE_CHECKPOINT_INTERVAL", time.Minute)
+	switch storeType := getEnvOr("YARN_STATE_STORE", ""); storeType {
+	case "":
+	case "file":
+		store, err := yarn.NewFileStateStore(getEnvOr("YARN_STATE_PATH", "state"))
+		if err != nil {
+			log.Fatal(err)
+		}
+		stateStore = store
+	case "bolt":
+		store, err := yarn.NewBoltStateStore(getEnvOr("YARN_STATE_PATH", "state.db"))
+		if err != nil {
+			log.Fatal(err)
+		}
+		stateStore = store
+	default:
+		log.Fatal("YARN_STATE_STORE: unknown state store " + storeType)
+	}
+
+	if remoteWriteUrl := getEnvOr("YARN_REMOTE_WRITE_URL", ""); remoteWriteUrl != "" {
+		remoteWriteEP = parseEndpoint(remoteWriteUrl)
+	}
+	remoteWriteInterval = getEnvPositiveDurationOr("YARN_REMOTE_WRITE_INTERVAL", 30*time.Second)
+	remoteWriteQueueSize = getEnvPositiveIntOr("YARN_REMOTE_WRITE_QUEUE_SIZE", 10)
+	remoteWriteMaxRetries = getEnvIntOr("YARN_REMOTE_WRITE_MAX_RETRIES", 3)
+
+	clusterName = getEnvOr("YARN_CLUSTER_NAME", "")
+	pushgatewayUrl = getEnvOr("YARN_PUSHGATEWAY_URL", "")
+	pushgatewayJob = getEnvOr("YARN_PUSHGATEWAY_JOB", "yarn")
+	pushgatewayInterval = getEnvDurationOr("YARN_PUSHGATEWAY_INTERVAL", 0)
+	if pushgatewayInterval < 0 {
+		log.Fatal("YARN_PUSHGATEWAY_INTERVAL: must not be negative, got " + pushgatewayInterval.String())
+	}
+	pushgatewayGrouping = getEnvLabels("YARN_PUSHGATEWAY_GROUPING")
 	log.Println("env 加载完成...")
 }
 
+func parseEndpoint(rawUrl string) *url.URL {
+	endpoint, err := url.Parse(rawUrl)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	return endpoint
+}
+
 func getEnvOr(key string, defaultValue string) string {
 	if value, ok := os.LookupEnv(key); ok {
 		return value
@@ -66,3 +392,97 @@ func getEnvOr(key string, defaultValue string) string {
 
 	return defaultValue
 }
+
+func getEnvIntOr(key string, defaultValue int) int {
+	value, ok := os.LookupEnv(key)
+	if !ok {
+		return defaultValue
+	}
+
+	i, err := strconv.Atoi(value)
+	if err != nil {
+		log.Fatal(key + ": " + err.Error())
+	}
+	return i
+}
+
+func getEnvFloatOr(key string, defaultValue float64) float64 {
+	value, ok := os.LookupEnv(key)
+	if !ok {
+		return defaultValue
+	}
+
+	f, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		log.Fatal(key + ": " + err.Error())
+	}
+	return f
+}
+
+func getEnvDurationOr(key string, defaultValue time.Duration) time.Duration {
+	value, ok := os.LookupEnv(key)
+	if !ok {
+		return defaultValue
+	}
+
+	d, err := time.ParseDuration(value)
+	if err != nil {
+		log.Fatal(key + ": " + err.Error())
+	}
+	return d
+}
+
+/**
+读取必须大于 0 的整数，例如 channel 的容量
+*/
+
+func getEnvPositiveIntOr(key string, defaultValue int) int {
+	i := getEnvIntOr(key, defaultValue)
+	if i <= 0 {
+		log.Fatal(key + ": must be greater than 0, got " + strconv.Itoa(i))
+	}
+	return i
+}
+
+/**
+读取必须大于 0 的时间间隔，用于 time.NewTicker
+*/
+
+func getEnvPositiveDurationOr(key string, defaultValue time.Duration) time.Duration {
+	d := getEnvDurationOr(key, defaultValue)
+	if d <= 0 {
+		log.Fatal(key + ": must be greater than 0, got " + d.String())
+	}
+	return d
+}
+
+/**
+读取逗号分隔的列表，忽略空白项
+*/
+
+func getEnvList(key string) []string {
+	var values []string
+	for _, value := range strings.Split(getEnvOr(key, ""), ",") {
+		if value = strings.TrimSpace(value); value != "" {
+			values = append(values, value)
+		}
+	}
+
+	return values
+}
+
+/**
+解析逗号分隔的 key=value 列表
+*/
+
+func getEnvLabels(key string) map[string]string {
+	labels := make(map[string]string)
+	for _, pair := range getEnvList(key) {
+		kv := strings.SplitN(pair, "=", 2)
+		if len(kv) != 2 || strings.TrimSpace(kv[0]) == "" {
+			log.Fatal(key + ": expected key=value, got " + pair)
+		}
+		labels[strings.TrimSpace(kv[0])] = strings.TrimSpace(kv[1])
+	}
+	return labels
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"yarn-prometheus-exporter/yarn"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestNodeLabelsResponseFormats(t *testing.T) {
+	// Hadoop 2.x 带 nodeLabelsInfo 根节点，3.x 直接返回 nodeLabelInfo 数组
+	bodies := map[string]string{
+		"wrapped": `{"nodeLabelsInfo": {"nodeLabelInfo": [{"name": "gpu", "exclusivity": true, "activeNMs": 2,
+			"partitionInfo": {"resourceAvailable": {"memory": 65536, "vCores": 32}}}, {"name": "ssd", "exclusivity": false}]}}`,
+		"flat": `{"nodeLabelInfo": [{"name": "gpu", "exclusivity": true, "activeNMs": 2,
+			"partitionInfo": {"resourceAvailable": {"memory": 65536, "vCores": 32}}}, {"name": "ssd", "exclusivity": false}]}`,
+	}
+	expected := `
+# HELP yarn_node_label_active_nodes active node managers with the node label
+# TYPE yarn_node_label_active_nodes gauge
+yarn_node_label_active_nodes{exclusivity="true",label="gpu"} 2
+yarn_node_label_active_nodes{exclusivity="false",label="ssd"} 0
+# HELP yarn_node_label_resource_available_memory memory available in the node label partition
+# TYPE yarn_node_label_resource_available_memory gauge
+yarn_node_label_resource_available_memory{exclusivity="true",label="gpu"} 65536
+yarn_node_label_resource_available_memory{exclusivity="false",label="ssd"} 0
+`
+
+	for name, body := range bodies {
+		t.Run(name, func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.Write([]byte(body))
+			}))
+			defer server.Close()
+
+			c := yarn.NewNodeLabelsCollector(parseEndpoint(server.URL + "/ws/v1/cluster/get-node-labels"))
+			err := testutil.CollectAndCompare(c, strings.NewReader(expected), "yarn_node_label_active_nodes", "yarn_node_label_resource_available_memory")
+			if err != nil {
+				t.Error(err)
+			}
+		})
+	}
+}
+
+func TestPartitionQueueMetrics(t *testing.T) {
+	server := httptest.NewServer(replayHandler(filepath.Join("testdata", "fixtures", "hadoop-3.3")))
+	defer server.Close()
+
+	// 默认分区的 partition 为空字符串，嵌套的叶子队列同样输出分区指标
+	expected := `
+# HELP yarn_partition_capacity capacity percentage per partition
+# TYPE yarn_partition_capacity gauge
+yarn_partition_capacity{partition="",queueName="default",queuePath="root.default",type="capacitySchedulerLeafQueueInfo"} 40
+yarn_partition_capacity{partition="",queueName="etl",queuePath="root.prod.etl",type="capacitySchedulerLeafQueueInfo"} 40
+yarn_partition_capacity{partition="",queueName="prod",queuePath="root.prod",type=""} 60
+yarn_partition_capacity{partition="",queueName="reporting",queuePath="root.prod.reporting",type="capacitySchedulerLeafQueueInfo"} 20
+yarn_partition_capacity{partition="gpu",queueName="default",queuePath="root.default",type="capacitySchedulerLeafQueueInfo"} 40
+yarn_partition_capacity{partition="gpu",queueName="etl",queuePath="root.prod.etl",type="capacitySchedulerLeafQueueInfo"} 40
+yarn_partition_capacity{partition="gpu",queueName="prod",queuePath="root.prod",type=""} 60
+yarn_partition_capacity{partition="gpu",queueName="reporting",queuePath="root.prod.reporting",type="capacitySchedulerLeafQueueInfo"} 20
+# HELP yarn_partition_resources_used_memory used memory per partition
+# TYPE yarn_partition_resources_used_memory gauge
+yarn_partition_resources_used_memory{partition="",queueName="default",queuePath="root.default",type="capacitySchedulerLeafQueueInfo"} 16384
+yarn_partition_resources_used_memory{partition="",queueName="etl",queuePath="root.prod.etl",type="capacitySchedulerLeafQueueInfo"} 8192
+yarn_partition_resources_used_memory{partition="",queueName="prod",queuePath="root.prod",type=""} 8192
+yarn_partition_resources_used_memory{partition="",queueName="reporting",queuePath="root.prod.reporting",type="capacitySchedulerLeafQueueInfo"} 0
+yarn_partition_resources_used_memory{partition="gpu",queueName="default",queuePath="root.default",type="capacitySchedulerLeafQueueInfo"} 0
+yarn_partition_resources_used_memory{partition="gpu",queueName="etl",queuePath="root.prod.etl",type="capacitySchedulerLeafQueueInfo"} 0
+yarn_partition_resources_used_memory{partition="gpu",queueName="prod",queuePath="root.prod",type=""} 0
+yarn_partition_resources_used_memory{partition="gpu",queueName="reporting",queuePath="root.prod.reporting",type="capacitySchedulerLeafQueueInfo"} 0
+`
+	c := yarn.NewSchedulerCollector(parseEndpoint(server.URL + "/ws/v1/cluster/scheduler"))
+	if err := testutil.CollectAndCompare(c, strings.NewReader(expected), "yarn_partition_capacity", "yarn_partition_resources_used_memory"); err != nil {
+		t.Error(err)
+	}
+}
@@ -0,0 +1,186 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+	"yarn-prometheus-exporter/yarn"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+/**
+模拟一个 NM，返回节点信息和一个 RUNNING 容器
+*/
+
+func newNodeManager(t *testing.T, handler http.HandlerFunc) *httptest.Server {
+	server := httptest.NewServer(handler)
+	t.Cleanup(server.Close)
+	return server
+}
+
+func nodeManagerHandler(w http.ResponseWriter, r *http.Request) {
+	switch r.URL.Path {
+	case "/ws/v1/node/info":
+		w.Write([]byte(`{"nodeInfo": {"nodeHealthy": true, "lastNodeUpdateTime": 1700000000000,
+			"totalVmemAllocatedContainersMB": 17203, "totalPmemAllocatedContainersMB": 8192, "totalVCoresAllocatedContainers": 4,
+			"nodeManagerVersion": "3.3.6", "hadoopVersion": "3.3.6"}}`))
+	case "/ws/v1/node/containers":
+		w.Write([]byte(`{"containers": {"container": [{"id": "container_1700000000000_0001_01_000001", "user": "alice",
+			"state": "RUNNING", "totalMemoryNeededMB": 2048, "totalVCoresNeeded": 1}]}}`))
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func TestNodeManagerCollector(t *testing.T) {
+	nm := newNodeManager(t, nodeManagerHandler)
+	address := strings.TrimPrefix(nm.URL, "http://")
+
+	expected := `
+# HELP yarn_nodemanager_up Able to contact the NodeManager
+# TYPE yarn_nodemanager_up gauge
+yarn_nodemanager_up{node="` + address + `"} 1
+# HELP yarn_nodemanager_healthy 1 if the NodeManager reports itself healthy
+# TYPE yarn_nodemanager_healthy gauge
+yarn_nodemanager_healthy{node="` + address + `"} 1
+# HELP yarn_nodemanager_version_info NodeManager version
+# TYPE yarn_nodemanager_version_info gauge
+yarn_nodemanager_version_info{hadoopVersion="3.3.6",node="` + address + `",version="3.3.6"} 1
+# HELP yarn_nodemanager_total_vmem_allocated_containers virtual memory allocated to containers :MB
+# TYPE yarn_nodemanager_total_vmem_allocated_containers gauge
+yarn_nodemanager_total_vmem_allocated_containers{node="` + address + `"} 17203
+# HELP yarn_nodemanager_containers containers per state
+# TYPE yarn_nodemanager_containers gauge
+yarn_nodemanager_containers{node="` + address + `",state="RUNNING"} 1
+# HELP yarn_nodemanager_container_allocated_memory memory allocated to the container, not its measured usage :MB
+# TYPE yarn_nodemanager_container_allocated_memory gauge
+yarn_nodemanager_container_allocated_memory{container="container_1700000000000_0001_01_000001",node="` + address + `",state="RUNNING",user="alice"} 2048
+`
+	c := yarn.NewNodeManagerCollector([]string{address}, nil, "http", 4)
+	err := testutil.CollectAndCompare(c, strings.NewReader(expected),
+		"yarn_nodemanager_up", "yarn_nodemanager_healthy", "yarn_nodemanager_version_info",
+		"yarn_nodemanager_total_vmem_allocated_containers", "yarn_nodemanager_containers",
+		"yarn_nodemanager_container_allocated_memory")
+	if err != nil {
+		t.Error(err)
+	}
+
+	// v2 名称中内存换算为字节
+	expected = `
+# HELP yarn_nodemanager_containers_vmem_allocated_bytes Virtual memory allocated to containers
+# TYPE yarn_nodemanager_containers_vmem_allocated_bytes gauge
+yarn_nodemanager_containers_vmem_allocated_bytes{node="` + address + `"} 1.8038652928e+10
+# HELP yarn_nodemanager_container_memory_allocated_bytes Memory allocated to the container, not its measured usage
+# TYPE yarn_nodemanager_container_memory_allocated_bytes gauge
+yarn_nodemanager_container_memory_allocated_bytes{container="container_1700000000000_0001_01_000001",node="` + address + `",state="RUNNING",user="alice"} 2.147483648e+09
+`
+	err = testutil.CollectAndCompare(yarn.WithNaming(c, yarn.NamingV2), strings.NewReader(expected),
+		"yarn_nodemanager_containers_vmem_allocated_bytes", "yarn_nodemanager_container_memory_allocated_bytes",
+		"yarn_nodemanager_total_vmem_allocated_containers", "yarn_nodemanager_container_allocated_memory")
+	if err != nil {
+		t.Error(err)
+	}
+}
+
+func TestNodeManagerDiscovery(t *testing.T) {
+	nm := newNodeManager(t, nodeManagerHandler)
+	address := strings.TrimPrefix(nm.URL, "http://")
+	unhealthy := newNodeManager(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/ws/v1/node/info" {
+			w.Write([]byte(`{"nodeInfo": {"nodeHealthy": false, "healthReport": "1/1 local-dirs are bad"}}`))
+			return
+		}
+		nodeManagerHandler(w, r)
+	})
+	unhealthyAddress := strings.TrimPrefix(unhealthy.URL, "http://")
+	rm := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"nodes": {"node": [
+			{"id": "worker-1:45454", "state": "RUNNING", "nodeHTTPAddress": "` + address + `"},
+			{"id": "worker-2:45454", "state": "LOST", "nodeHTTPAddress": "worker-2:8042"},
+			{"id": "worker-3:45454", "state": "UNHEALTHY", "nodeHTTPAddress": "` + unhealthyAddress + `"},
+			{"id": "worker-4:45454", "state": "DECOMMISSIONED", "nodeHTTPAddress": "worker-4:8042"}]}}`))
+	}))
+	defer rm.Close()
+
+	// 请求 RUNNING 和 UNHEALTHY 的节点，不健康的 NM 报告 healthy 为 0；LOST 和 DECOMMISSIONED 的节点不请求
+	expected := `
+# HELP yarn_nodemanager_up Able to contact the NodeManager
+# TYPE yarn_nodemanager_up gauge
+yarn_nodemanager_up{node="` + address + `"} 1
+yarn_nodemanager_up{node="` + unhealthyAddress + `"} 1
+# HELP yarn_nodemanager_healthy 1 if the NodeManager reports itself healthy
+# TYPE yarn_nodemanager_healthy gauge
+yarn_nodemanager_healthy{node="` + address + `"} 1
+yarn_nodemanager_healthy{node="` + unhealthyAddress + `"} 0
+`
+	c := yarn.NewNodeManagerCollector(nil, parseEndpoint(rm.URL+"/ws/v1/cluster/nodes"), "http", 4)
+	if err := testutil.CollectAndCompare(c, strings.NewReader(expected), "yarn_nodemanager_up", "yarn_nodemanager_healthy"); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestNodeManagerDuplicateAddresses(t *testing.T) {
+	nm := newNodeManager(t, nodeManagerHandler)
+	address := strings.TrimPrefix(nm.URL, "http://")
+
+	// 重复配置的地址只采集一次，否则重复的指标会让整个 scrape 失败
+	registry := prometheus.NewPedanticRegistry()
+	registry.MustRegister(yarn.NewNodeManagerCollector([]string{address, address}, nil, "http", 4))
+	if _, err := registry.Gather(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestNodeManagerTimeoutAndConcurrency(t *testing.T) {
+	timeout := yarn.HTTPClient.Timeout
+	yarn.HTTPClient.Timeout = 200 * time.Millisecond
+	defer func() { yarn.HTTPClient.Timeout = timeout }()
+
+	// 一个 NM 一直不响应，其它 NM 照常采集；同时处理的请求数不超过 Concurrency
+	var active, peak int32
+	handler := func(w http.ResponseWriter, r *http.Request) {
+		n := atomic.AddInt32(&active, 1)
+		defer atomic.AddInt32(&active, -1)
+		for {
+			p := atomic.LoadInt32(&peak)
+			if n <= p || atomic.CompareAndSwapInt32(&peak, p, n) {
+				break
+			}
+		}
+		time.Sleep(20 * time.Millisecond)
+		nodeManagerHandler(w, r)
+	}
+	done := make(chan struct{})
+	hung := newNodeManager(t, func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-done:
+		case <-r.Context().Done():
+		}
+	})
+	defer close(done)
+
+	addresses := []string{strings.TrimPrefix(hung.URL, "http://")}
+	for i := 0; i < 6; i++ {
+		addresses = append(addresses, strings.TrimPrefix(newNodeManager(t, handler).URL, "http://"))
+	}
+
+	c := yarn.NewNodeManagerCollector(addresses, nil, "http", 2)
+	finished := make(chan int)
+	go func() { finished <- testutil.CollectAndCount(c, "yarn_nodemanager_healthy") }()
+	select {
+	case n := <-finished:
+		if n != 6 {
+			t.Errorf("expected 6 healthy NodeManagers, got %d", n)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("scrape blocked by an unresponsive NodeManager")
+	}
+	if peak := atomic.LoadInt32(&peak); peak > 2 {
+		t.Errorf("expected at most 2 concurrent requests, got %d", peak)
+	}
+}
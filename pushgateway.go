@@ -0,0 +1,90 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/push"
+	dto "github.com/prometheus/client_model/go"
+)
+
+/**
+把 registry 推送到 Pushgateway。grouping key 包含 cluster（如果配置了集群名）和 YARN_PUSHGATEWAY_GROUPING 中的 key=value
+*/
+
+func newPusher(gatherer prometheus.Gatherer) *push.Pusher {
+	grouping := make(map[string]string)
+	if clusterName != "" {
+		grouping["cluster"] = clusterName
+	}
+	for name, value := range pushgatewayGrouping {
+		grouping[name] = value
+	}
+	pusher := push.New(pushgatewayUrl, pushgatewayJob).Gatherer(withoutGroupingLabels(gatherer, grouping))
+	for name, value := range grouping {
+		pusher = pusher.Grouping(name, value)
+	}
+	return pusher
+}
+
+/**
+Pushgateway 拒绝带有 grouping key 中标签的指标。与 grouping key 取值相同的标签（例如 cluster 常量标签）
+在推送前移除，由 Pushgateway 重新加上；取值不同时推送失败
+*/
+
+func withoutGroupingLabels(gatherer prometheus.Gatherer, grouping map[string]string) prometheus.Gatherer {
+	return prometheus.GathererFunc(func() ([]*dto.MetricFamily, error) {
+		families, err := gatherer.Gather()
+		if err != nil {
+			return nil, err
+		}
+		for _, mf := range families {
+			for _, m := range mf.Metric {
+				labels := m.Label[:0]
+				for _, l := range m.Label {
+					value, ok := grouping[l.GetName()]
+					if !ok {
+						labels = append(labels, l)
+						continue
+					}
+					if l.GetValue() != value {
+						return nil, fmt.Errorf("metric %s has label %s=%q, but the grouping key has %q", mf.GetName(), l.GetName(), l.GetValue(), value)
+					}
+				}
+				m.Label = labels
+			}
+		}
+		return families, nil
+	})
+}
+
+/**
+YARN_PUSHGATEWAY_INTERVAL 为 0 时只推送一次并返回推送的错误，由调用方在保存状态后以非 0 状态退出；
+否则按间隔推送直到 stop 被关闭，推送失败只记录日志
+*/
+
+func runPushgateway(gatherer prometheus.Gatherer, stop <-chan struct{}) error {
+	pusher := newPusher(gatherer)
+	if pushgatewayInterval == 0 {
+		if err := pusher.Push(); err != nil {
+			return fmt.Errorf("pushing metrics to Pushgateway: %w", err)
+		}
+		log.Println("已推送到 Pushgateway")
+		return nil
+	}
+
+	ticker := time.NewTicker(pushgatewayInterval)
+	defer ticker.Stop()
+	for {
+		if err := pusher.Push(); err != nil {
+			log.Println("Error while pushing metrics to Pushgateway: " + err.Error())
+		}
+		select {
+		case <-ticker.C:
+		case <-stop:
+			return nil
+		}
+	}
+}
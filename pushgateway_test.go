@@ -0,0 +1,145 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/prometheus/common/expfmt"
+)
+
+type pushRequest struct {
+	method   string
+	path     string
+	families map[string]*dto.MetricFamily
+}
+
+/**
+模拟 Pushgateway，把每次推送的请求发送到返回的 channel
+*/
+
+func newPushgateway(t *testing.T) (*httptest.Server, chan *pushRequest) {
+	pushes := make(chan *pushRequest, 16)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		p := &pushRequest{method: r.Method, path: r.URL.Path, families: make(map[string]*dto.MetricFamily)}
+		decoder := expfmt.NewDecoder(r.Body, expfmt.ResponseFormat(r.Header))
+		for {
+			var mf dto.MetricFamily
+			if err := decoder.Decode(&mf); err != nil {
+				break
+			}
+			p.families[mf.GetName()] = &mf
+		}
+		pushes <- p
+		w.WriteHeader(http.StatusOK)
+	}))
+	t.Cleanup(server.Close)
+	return server, pushes
+}
+
+/**
+设置 Pushgateway 相关的全局配置，测试结束后恢复
+*/
+
+func setPushgatewayEnv(t *testing.T, url string, interval time.Duration, cluster string, grouping map[string]string) {
+	oldUrl, oldJob, oldInterval, oldCluster, oldGrouping := pushgatewayUrl, pushgatewayJob, pushgatewayInterval, clusterName, pushgatewayGrouping
+	t.Cleanup(func() {
+		pushgatewayUrl, pushgatewayJob, pushgatewayInterval, clusterName, pushgatewayGrouping = oldUrl, oldJob, oldInterval, oldCluster, oldGrouping
+	})
+	pushgatewayUrl, pushgatewayJob, pushgatewayInterval, clusterName, pushgatewayGrouping = url, "yarn", interval, cluster, grouping
+}
+
+func newPushRegistry(constLabels prometheus.Labels) *prometheus.Registry {
+	registry := prometheus.NewRegistry()
+	gauge := prometheus.NewGauge(prometheus.GaugeOpts{Name: "yarn_test_gauge", Help: "test", ConstLabels: constLabels})
+	gauge.Set(42)
+	registry.MustRegister(gauge)
+	return registry
+}
+
+func TestPushgatewayOnce(t *testing.T) {
+	server, pushes := newPushgateway(t)
+	setPushgatewayEnv(t, server.URL, 0, "dev", map[string]string{"team": "data"})
+
+	// 与 grouping key 相同的 cluster 常量标签在推送前移除
+	if err := runPushgateway(newPushRegistry(prometheus.Labels{"cluster": "dev", "env": "test"}), make(chan struct{})); err != nil {
+		t.Fatal(err)
+	}
+
+	select {
+	case p := <-pushes:
+		if p.method != http.MethodPut {
+			t.Errorf("expected PUT, got %s", p.method)
+		}
+		// grouping key 中标签的顺序不固定
+		segments := strings.Split(strings.TrimPrefix(p.path, "/metrics/"), "/")
+		grouping := make(map[string]string)
+		for i := 0; i+1 < len(segments); i += 2 {
+			grouping[segments[i]] = segments[i+1]
+		}
+		expected := map[string]string{"job": "yarn", "cluster": "dev", "team": "data"}
+		if !reflect.DeepEqual(grouping, expected) {
+			t.Errorf("expected grouping key %v, got path %s", expected, p.path)
+		}
+		mf, ok := p.families["yarn_test_gauge"]
+		if !ok {
+			t.Fatal("yarn_test_gauge not pushed")
+		}
+		labels := mf.Metric[0].Label
+		if len(labels) != 1 || labels[0].GetName() != "env" {
+			t.Errorf("expected only the env label, got %v", labels)
+		}
+		if v := mf.Metric[0].Gauge.GetValue(); v != 42 {
+			t.Errorf("error asserting [yarn_test_gauge]: expected: 42, actual: %v", v)
+		}
+	default:
+		t.Fatal("nothing pushed")
+	}
+}
+
+func TestPushgatewayConflictingGroupingLabel(t *testing.T) {
+	server, pushes := newPushgateway(t)
+	setPushgatewayEnv(t, server.URL, 0, "dev", nil)
+
+	// 只推送一次时返回错误，由 main 在保存状态后退出
+	if err := runPushgateway(newPushRegistry(prometheus.Labels{"cluster": "prod"}), make(chan struct{})); err == nil {
+		t.Error("expected an error for a cluster label that differs from YARN_CLUSTER_NAME")
+	}
+	if len(pushes) != 0 {
+		t.Error("expected nothing pushed")
+	}
+}
+
+func TestPushgatewayInterval(t *testing.T) {
+	server, pushes := newPushgateway(t)
+	setPushgatewayEnv(t, server.URL, 10*time.Millisecond, "", nil)
+
+	// 按间隔推送，stop 关闭后返回
+	stop := make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		runPushgateway(newPushRegistry(nil), stop)
+		close(done)
+	}()
+	for i := 0; i < 2; i++ {
+		select {
+		case p := <-pushes:
+			if p.path != "/metrics/job/yarn" {
+				t.Errorf("expected path /metrics/job/yarn, got %s", p.path)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatal("no periodic push received")
+		}
+	}
+	close(stop)
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("runPushgateway did not return after stop")
+	}
+}
@@ -0,0 +1,308 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"math"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"time"
+	"yarn-prometheus-exporter/yarn"
+
+	"github.com/golang/snappy"
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+/**
+remoteWriter 定期采集 registry，按 Prometheus remote-write 协议（snappy 压缩的 protobuf）推送到 URL。
+采集和发送通过队列解耦：队列满时丢弃最旧的一批，发送失败按指数退避重试 MaxRetries 次
+*/
+
+type remoteWriter struct {
+	URL        *url.URL
+	Gatherer   prometheus.Gatherer
+	Interval   time.Duration
+	MaxRetries int
+	Backoff    time.Duration
+	Client     *http.Client
+
+	queue       chan *writeBatch
+	samples     prometheus.Counter
+	failures    prometheus.Counter
+	retries     prometheus.Counter
+	dropped     prometheus.Counter
+	queueLength *prometheus.Desc
+}
+
+// 编码后的一次 WriteRequest
+type writeBatch struct {
+	data    []byte
+	samples int
+}
+
+// 不重试的错误，例如 4xx 响应
+type permanentError struct {
+	error
+}
+
+func newRemoteWriter(u *url.URL, gatherer prometheus.Gatherer, interval time.Duration, queueSize int, maxRetries int) *remoteWriter {
+	rw := &remoteWriter{
+		URL:         u,
+		Gatherer:    gatherer,
+		Interval:    interval,
+		MaxRetries:  maxRetries,
+		Backoff:     time.Second,
+		Client:      &http.Client{Timeout: 30 * time.Second},
+		queue:       make(chan *writeBatch, queueSize),
+		samples:     newSelfCounter("remote_write_samples_total", "Samples pushed through remote write"),
+		failures:    newSelfCounter("remote_write_failures_total", "Remote write requests that failed after all retries"),
+		retries:     newSelfCounter("remote_write_retries_total", "Remote write requests that were retried"),
+		dropped:     newSelfCounter("remote_write_dropped_total", "Remote write requests dropped because the send queue was full"),
+		queueLength: prometheus.NewDesc("yarn_remote_write_queue_length", "Remote write requests waiting to be sent", nil, yarn.ConstLabels),
+	}
+	return rw
+}
+
+// 与 collector 的指标一样带上 yarn.ConstLabels
+func newSelfCounter(name string, help string) prometheus.Counter {
+	return prometheus.NewCounter(prometheus.CounterOpts{Namespace: "yarn", Name: name, Help: help, ConstLabels: yarn.ConstLabels})
+}
+
+func (rw *remoteWriter) Describe(ch chan<- *prometheus.Desc) {
+	rw.samples.Describe(ch)
+	rw.failures.Describe(ch)
+	rw.retries.Describe(ch)
+	rw.dropped.Describe(ch)
+	ch <- rw.queueLength
+}
+
+func (rw *remoteWriter) Collect(ch chan<- prometheus.Metric) {
+	rw.samples.Collect(ch)
+	rw.failures.Collect(ch)
+	rw.retries.Collect(ch)
+	rw.dropped.Collect(ch)
+	ch <- prometheus.MustNewConstMetric(rw.queueLength, prometheus.GaugeValue, float64(len(rw.queue)))
+}
+
+/**
+启动发送协程，并按 Interval 采集入队，直到 stop 被关闭；发送协程退出后才返回
+*/
+
+func (rw *remoteWriter) Run(stop <-chan struct{}) {
+	sent := make(chan struct{})
+	go func() {
+		defer close(sent)
+		rw.send(stop)
+	}()
+
+	ticker := time.NewTicker(rw.Interval)
+	defer ticker.Stop()
+	for {
+		rw.enqueue()
+		select {
+		case <-ticker.C:
+		case <-stop:
+			<-sent
+			return
+		}
+	}
+}
+
+func (rw *remoteWriter) enqueue() {
+	families, err := rw.Gatherer.Gather()
+	if err != nil {
+		log.Println("Error while gathering metrics for remote write: " + err.Error())
+	}
+	series := toTimeSeries(families, time.Now())
+	if len(series) == 0 {
+		return
+	}
+	batch := &writeBatch{data: encodeWriteRequest(series), samples: len(series)}
+	for {
+		select {
+		case rw.queue <- batch:
+			return
+		default:
+		}
+		// 队列已满，丢弃最旧的一批
+		select {
+		case <-rw.queue:
+			rw.dropped.Inc()
+		default:
+		}
+	}
+}
+
+func (rw *remoteWriter) send(stop <-chan struct{}) {
+	for {
+		select {
+		case batch := <-rw.queue:
+			if err := rw.sendWithRetries(batch, stop); err != nil {
+				rw.failures.Inc()
+				log.Println("Error while pushing metrics through remote write: " + err.Error())
+			}
+		case <-stop:
+			return
+		}
+	}
+}
+
+func (rw *remoteWriter) sendWithRetries(batch *writeBatch, stop <-chan struct{}) error {
+	backoff := rw.Backoff
+	for attempt := 0; ; attempt++ {
+		err := rw.post(batch.data)
+		if err == nil {
+			rw.samples.Add(float64(batch.samples))
+			return nil
+		}
+		var permanent permanentError
+		if errors.As(err, &permanent) || attempt >= rw.MaxRetries {
+			return err
+		}
+		rw.retries.Inc()
+		select {
+		case <-time.After(backoff):
+		case <-stop:
+			return err
+		}
+		backoff *= 2
+	}
+}
+
+func (rw *remoteWriter) post(req []byte) error {
+	body := snappy.Encode(nil, req)
+	httpReq, err := http.NewRequest("POST", rw.URL.String(), bytes.NewReader(body))
+	if err != nil {
+		return permanentError{err}
+	}
+	httpReq.Header.Set("Content-Encoding", "snappy")
+	httpReq.Header.Set("Content-Type", "application/x-protobuf")
+	httpReq.Header.Set("User-Agent", "yarn-prometheus-exporter")
+	httpReq.Header.Set("X-Prometheus-Remote-Write-Version", "0.1.0")
+
+	resp, err := rw.Client.Do(httpReq)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, resp.Body)
+
+	if resp.StatusCode/100 == 2 {
+		return nil
+	}
+	err = errors.New(fmt.Sprintf("unexpected HTTP status: %v", resp.StatusCode))
+	// 4xx 说明请求本身有问题，重试没有意义；429 除外
+	if resp.StatusCode/100 == 4 && resp.StatusCode != http.StatusTooManyRequests {
+		return permanentError{err}
+	}
+	return err
+}
+
+/**
+remote-write 的时间序列，labels 按名称排序且包含 __name__
+*/
+
+type timeSeries struct {
+	labels    [][2]string
+	value     float64
+	timestamp int64
+}
+
+func toTimeSeries(families []*dto.MetricFamily, now time.Time) []*timeSeries {
+	ts := now.UnixNano() / int64(time.Millisecond)
+	var series []*timeSeries
+	add := func(name string, m *dto.Metric, value float64, extra ...string) {
+		labels := [][2]string{{"__name__", name}}
+		for _, l := range m.GetLabel() {
+			labels = append(labels, [2]string{l.GetName(), l.GetValue()})
+		}
+		for i := 0; i+1 < len(extra); i += 2 {
+			labels = append(labels, [2]string{extra[i], extra[i+1]})
+		}
+		sort.Slice(labels, func(i, j int) bool { return labels[i][0] < labels[j][0] })
+		t := ts
+		if m.TimestampMs != nil {
+			t = m.GetTimestampMs()
+		}
+		series = append(series, &timeSeries{labels: labels, value: value, timestamp: t})
+	}
+
+	for _, f := range families {
+		name := f.GetName()
+		for _, m := range f.GetMetric() {
+			switch f.GetType() {
+			case dto.MetricType_COUNTER:
+				add(name, m, m.GetCounter().GetValue())
+			case dto.MetricType_GAUGE:
+				add(name, m, m.GetGauge().GetValue())
+			case dto.MetricType_UNTYPED:
+				add(name, m, m.GetUntyped().GetValue())
+			case dto.MetricType_SUMMARY:
+				s := m.GetSummary()
+				for _, q := range s.GetQuantile() {
+					add(name, m, q.GetValue(), "quantile", formatFloat(q.GetQuantile()))
+				}
+				add(name+"_sum", m, s.GetSampleSum())
+				add(name+"_count", m, float64(s.GetSampleCount()))
+			case dto.MetricType_HISTOGRAM:
+				h := m.GetHistogram()
+				for _, b := range h.GetBucket() {
+					if math.IsInf(b.GetUpperBound(), 1) {
+						continue
+					}
+					add(name+"_bucket", m, float64(b.GetCumulativeCount()), "le", formatFloat(b.GetUpperBound()))
+				}
+				add(name+"_bucket", m, float64(h.GetSampleCount()), "le", "+Inf")
+				add(name+"_sum", m, h.GetSampleSum())
+				add(name+"_count", m, float64(h.GetSampleCount()))
+			}
+		}
+	}
+	return series
+}
+
+func formatFloat(f float64) string {
+	if math.IsInf(f, 1) {
+		return "+Inf"
+	}
+	return strconv.FormatFloat(f, 'g', -1, 64)
+}
+
+/**
+按 prometheus/prompb 的 WriteRequest 编码：
+WriteRequest{timeseries=1}，TimeSeries{labels=1, samples=2}，Label{name=1, value=2}，Sample{value=1, timestamp=2}
+*/
+
+func encodeWriteRequest(series []*timeSeries) []byte {
+	var req []byte
+	for _, s := range series {
+		var ts []byte
+		for _, l := range s.labels {
+			var label []byte
+			label = protowire.AppendTag(label, 1, protowire.BytesType)
+			label = protowire.AppendString(label, l[0])
+			label = protowire.AppendTag(label, 2, protowire.BytesType)
+			label = protowire.AppendString(label, l[1])
+			ts = protowire.AppendTag(ts, 1, protowire.BytesType)
+			ts = protowire.AppendBytes(ts, label)
+		}
+		var sample []byte
+		sample = protowire.AppendTag(sample, 1, protowire.Fixed64Type)
+		sample = protowire.AppendFixed64(sample, math.Float64bits(s.value))
+		sample = protowire.AppendTag(sample, 2, protowire.VarintType)
+		sample = protowire.AppendVarint(sample, uint64(s.timestamp))
+		ts = protowire.AppendTag(ts, 2, protowire.BytesType)
+		ts = protowire.AppendBytes(ts, sample)
+
+		req = protowire.AppendTag(req, 1, protowire.BytesType)
+		req = protowire.AppendBytes(req, ts)
+	}
+	return req
+}
@@ -0,0 +1,181 @@
+package main
+
+import (
+	"io"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+	"yarn-prometheus-exporter/yarn"
+
+	"github.com/golang/snappy"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+func TestRemoteWrite(t *testing.T) {
+	received := make(chan map[string]float64, 1)
+	requests := 0
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		if requests == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		if r.Header.Get("Content-Encoding") != "snappy" {
+			t.Errorf("unexpected Content-Encoding: %s", r.Header.Get("Content-Encoding"))
+		}
+		body, _ := io.ReadAll(r.Body)
+		data, err := snappy.Decode(nil, body)
+		if err != nil {
+			t.Error(err)
+		}
+		received <- decodeWriteRequest(t, data)
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer receiver.Close()
+
+	registry := prometheus.NewRegistry()
+	gauge := prometheus.NewGauge(prometheus.GaugeOpts{Name: "yarn_test_gauge", Help: "test"})
+	gauge.Set(42)
+	registry.MustRegister(gauge)
+
+	u, _ := url.Parse(receiver.URL)
+	rw := newRemoteWriter(u, registry, time.Hour, 1, 3)
+	rw.Backoff = time.Millisecond
+	stop := make(chan struct{})
+	defer close(stop)
+	go rw.Run(stop)
+
+	select {
+	case series := <-received:
+		if series["yarn_test_gauge"] != 42 {
+			t.Errorf("error asserting [yarn_test_gauge]: expected: 42, actual: %v", series["yarn_test_gauge"])
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("no remote write request received")
+	}
+	if retries := testutil.ToFloat64(rw.retries); retries != 1 {
+		t.Errorf("error asserting [retries]: expected: 1, actual: %v", retries)
+	}
+}
+
+func TestRemoteWriteStops(t *testing.T) {
+	requested := make(chan struct{}, 1)
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case requested <- struct{}{}:
+		default:
+		}
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer receiver.Close()
+
+	registry := prometheus.NewRegistry()
+	gauge := prometheus.NewGauge(prometheus.GaugeOpts{Name: "yarn_test_gauge", Help: "test"})
+	registry.MustRegister(gauge)
+
+	// 发送协程在重试等待中，stop 关闭后 Run 等它退出再返回
+	u, _ := url.Parse(receiver.URL)
+	rw := newRemoteWriter(u, registry, time.Hour, 1, 3)
+	rw.Backoff = time.Hour
+	stop := make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		rw.Run(stop)
+		close(done)
+	}()
+	select {
+	case <-requested:
+	case <-time.After(5 * time.Second):
+		t.Fatal("no remote write request received")
+	}
+	close(stop)
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Run did not return after stop")
+	}
+	if failures := testutil.ToFloat64(rw.failures); failures != 1 {
+		t.Errorf("error asserting [failures]: expected: 1, actual: %v", failures)
+	}
+}
+
+/**
+解析 WriteRequest，返回 __name__ 到样本值的映射
+*/
+
+func decodeWriteRequest(t *testing.T, data []byte) map[string]float64 {
+	series := make(map[string]float64)
+	for _, ts := range consumeFields(t, data, 1) {
+		var name string
+		var value float64
+		for _, label := range consumeFields(t, ts, 1) {
+			fields := consumeFields(t, label, 1, 2)
+			if string(fields[0]) == "__name__" {
+				name = string(fields[1])
+			}
+		}
+		for _, sample := range consumeFields(t, ts, 2) {
+			num, _, n := protowire.ConsumeTag(sample)
+			if num == 1 {
+				v, _ := protowire.ConsumeFixed64(sample[n:])
+				value = math.Float64frombits(v)
+			}
+		}
+		series[name] = value
+	}
+	return series
+}
+
+/**
+返回指定字段号的 bytes 字段值
+*/
+
+func consumeFields(t *testing.T, data []byte, nums ...protowire.Number) [][]byte {
+	var fields [][]byte
+	for len(data) > 0 {
+		num, typ, n := protowire.ConsumeTag(data)
+		if n < 0 {
+			t.Fatal(protowire.ParseError(n))
+		}
+		data = data[n:]
+		if typ != protowire.BytesType {
+			n = protowire.ConsumeFieldValue(num, typ, data)
+			data = data[n:]
+			continue
+		}
+		v, n := protowire.ConsumeBytes(data)
+		data = data[n:]
+		for _, want := range nums {
+			if num == want {
+				fields = append(fields, v)
+			}
+		}
+	}
+	return fields
+}
+
+func TestRemoteWriteConstLabels(t *testing.T) {
+	yarn.ConstLabels = prometheus.Labels{"cluster": "prod"}
+	defer func() { yarn.ConstLabels = nil }()
+
+	// 自身的指标和 collector 的指标一样带上 ConstLabels
+	u, _ := url.Parse("http://localhost:9090/api/v1/write")
+	rw := newRemoteWriter(u, prometheus.NewRegistry(), time.Hour, 1, 3)
+	expected := `
+# HELP yarn_remote_write_dropped_total Remote write requests dropped because the send queue was full
+# TYPE yarn_remote_write_dropped_total counter
+yarn_remote_write_dropped_total{cluster="prod"} 0
+# HELP yarn_remote_write_queue_length Remote write requests waiting to be sent
+# TYPE yarn_remote_write_queue_length gauge
+yarn_remote_write_queue_length{cluster="prod"} 0
+`
+	if err := testutil.CollectAndCompare(rw, strings.NewReader(expected), "yarn_remote_write_dropped_total", "yarn_remote_write_queue_length"); err != nil {
+		t.Error(err)
+	}
+}
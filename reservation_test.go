@@ -0,0 +1,111 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"yarn-prometheus-exporter/yarn"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestReservationCollector(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("include-resource-allocations") != "true" {
+			t.Errorf("resource allocations not requested: %s", r.URL)
+		}
+		switch r.URL.Query().Get("queue") {
+		case "dedicated":
+			// 第一段分配在很久以后，第二段覆盖当前时刻，第三段已经结束；只有第二段计入当前预留，
+			// 已经结束的分配不输出，但按开始时间排序的序号不变
+			w.Write([]byte(`{"reservations": [{
+				"acceptance-time": 1600000000000,
+				"reservation-id": "reservation_1600000000000_0001",
+				"user": "etl",
+				"reservation-definition": {"arrival": 1600000000000, "deadline": 4102444800000, "reservation-name": "nightly"},
+				"resource-allocations": [
+					{"resource": {"memory": 4096, "vCores": 2}, "startTime": 4102444700000, "endTime": 4102444800000},
+					{"resource": {"memory": 8192, "vCores": 4, "resourceInformations": {"resourceInformation": [
+						{"name": "memory-mb", "units": "Mi", "value": 8192},
+						{"name": "yarn.io/gpu", "units": "", "value": 2}
+					]}}, "startTime": 1700000000000, "endTime": 4102444800000},
+					{"resource": {"memory": 2048, "vCores": 1}, "startTime": 1600000000000, "endTime": 1600003600000}
+				]
+			}]}`))
+		case "empty":
+			w.Write([]byte(`{}`))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	expected := `
+# HELP yarn_reservations reservations in the plan queue
+# TYPE yarn_reservations gauge
+yarn_reservations{queue="dedicated"} 1
+yarn_reservations{queue="empty"} 0
+# HELP yarn_reservation_start_time reservation start time, in unix seconds
+# TYPE yarn_reservation_start_time gauge
+yarn_reservation_start_time{id="reservation_1600000000000_0001",name="nightly",queue="dedicated",user="etl"} 1.6e+09
+# HELP yarn_reservation_end_time reservation end time, in unix seconds
+# TYPE yarn_reservation_end_time gauge
+yarn_reservation_end_time{id="reservation_1600000000000_0001",name="nightly",queue="dedicated",user="etl"} 4.1024448e+09
+# HELP yarn_reservation_reserved_memory memory reserved at scrape time :MB
+# TYPE yarn_reservation_reserved_memory gauge
+yarn_reservation_reserved_memory{id="reservation_1600000000000_0001",name="nightly",queue="dedicated",user="etl"} 8192
+# HELP yarn_reservation_reserved_v_cores cores reserved at scrape time
+# TYPE yarn_reservation_reserved_v_cores gauge
+yarn_reservation_reserved_v_cores{id="reservation_1600000000000_0001",name="nightly",queue="dedicated",user="etl"} 4
+# HELP yarn_reservation_reserved_resource resource reserved at scrape time per resource type
+# TYPE yarn_reservation_reserved_resource gauge
+yarn_reservation_reserved_resource{id="reservation_1600000000000_0001",name="nightly",queue="dedicated",resource="memory-mb",unit="Mi",user="etl"} 8192
+yarn_reservation_reserved_resource{id="reservation_1600000000000_0001",name="nightly",queue="dedicated",resource="yarn.io/gpu",unit="",user="etl"} 2
+# HELP yarn_reservation_allocation_start_time start time of a current or future reservation allocation, in unix seconds
+# TYPE yarn_reservation_allocation_start_time gauge
+yarn_reservation_allocation_start_time{allocation="1",id="reservation_1600000000000_0001",name="nightly",queue="dedicated",user="etl"} 1.7e+09
+yarn_reservation_allocation_start_time{allocation="2",id="reservation_1600000000000_0001",name="nightly",queue="dedicated",user="etl"} 4.1024447e+09
+# HELP yarn_reservation_allocation_end_time end time of a current or future reservation allocation, in unix seconds
+# TYPE yarn_reservation_allocation_end_time gauge
+yarn_reservation_allocation_end_time{allocation="1",id="reservation_1600000000000_0001",name="nightly",queue="dedicated",user="etl"} 4.1024448e+09
+yarn_reservation_allocation_end_time{allocation="2",id="reservation_1600000000000_0001",name="nightly",queue="dedicated",user="etl"} 4.1024448e+09
+# HELP yarn_reservation_allocation_memory memory of a current or future reservation allocation :MB
+# TYPE yarn_reservation_allocation_memory gauge
+yarn_reservation_allocation_memory{allocation="1",id="reservation_1600000000000_0001",name="nightly",queue="dedicated",user="etl"} 8192
+yarn_reservation_allocation_memory{allocation="2",id="reservation_1600000000000_0001",name="nightly",queue="dedicated",user="etl"} 4096
+# HELP yarn_reservation_allocation_v_cores cores of a current or future reservation allocation
+# TYPE yarn_reservation_allocation_v_cores gauge
+yarn_reservation_allocation_v_cores{allocation="1",id="reservation_1600000000000_0001",name="nightly",queue="dedicated",user="etl"} 4
+yarn_reservation_allocation_v_cores{allocation="2",id="reservation_1600000000000_0001",name="nightly",queue="dedicated",user="etl"} 2
+# HELP yarn_reservation_allocation_resource resource of a current or future reservation allocation per resource type
+# TYPE yarn_reservation_allocation_resource gauge
+yarn_reservation_allocation_resource{allocation="1",id="reservation_1600000000000_0001",name="nightly",queue="dedicated",resource="memory-mb",unit="Mi",user="etl"} 8192
+yarn_reservation_allocation_resource{allocation="1",id="reservation_1600000000000_0001",name="nightly",queue="dedicated",resource="yarn.io/gpu",unit="",user="etl"} 2
+`
+	// missing 队列请求失败，只记录日志，不影响其它队列
+	c := yarn.NewReservationCollector(parseEndpoint(server.URL+"/ws/v1/cluster/reservation/list"), []string{"dedicated", "empty", "missing"})
+	if err := testutil.CollectAndCompare(c, strings.NewReader(expected)); err != nil {
+		t.Error(err)
+	}
+
+	// v2 名称中内存换算为字节，时间戳以 _timestamp_seconds 结尾
+	expected = `
+# HELP yarn_reservation_start_timestamp_seconds Reservation start time
+# TYPE yarn_reservation_start_timestamp_seconds gauge
+yarn_reservation_start_timestamp_seconds{id="reservation_1600000000000_0001",name="nightly",queue="dedicated",user="etl"} 1.6e+09
+# HELP yarn_reservation_memory_reserved_bytes Memory reserved at scrape time
+# TYPE yarn_reservation_memory_reserved_bytes gauge
+yarn_reservation_memory_reserved_bytes{id="reservation_1600000000000_0001",name="nightly",queue="dedicated",user="etl"} 8.589934592e+09
+# HELP yarn_reservation_allocation_memory_bytes Memory of a current or future reservation allocation
+# TYPE yarn_reservation_allocation_memory_bytes gauge
+yarn_reservation_allocation_memory_bytes{allocation="1",id="reservation_1600000000000_0001",name="nightly",queue="dedicated",user="etl"} 8.589934592e+09
+yarn_reservation_allocation_memory_bytes{allocation="2",id="reservation_1600000000000_0001",name="nightly",queue="dedicated",user="etl"} 4.294967296e+09
+`
+	err := testutil.CollectAndCompare(yarn.WithNaming(c, yarn.NamingV2), strings.NewReader(expected),
+		"yarn_reservation_start_timestamp_seconds", "yarn_reservation_memory_reserved_bytes", "yarn_reservation_allocation_memory_bytes",
+		"yarn_reservation_start_time", "yarn_reservation_reserved_memory", "yarn_reservation_allocation_memory")
+	if err != nil {
+		t.Error(err)
+	}
+}
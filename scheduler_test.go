@@ -0,0 +1,76 @@
+package main
+
+import (
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"yarn-prometheus-exporter/yarn"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestLeafQueueLimits(t *testing.T) {
+	server := httptest.NewServer(replayHandler(filepath.Join("testdata", "fixtures", "hadoop-3.3")))
+	defer server.Close()
+
+	// 嵌套的队列按深度优先展开，queuePath 是完整路径；父队列 prod 不输出应用数限制、AM 资源和用户限制，
+	// 它下面的叶子队列 prod.etl、prod.reporting 和 default 一样输出
+	expected := `
+# HELP yarn_max_applications max applications of the queue
+# TYPE yarn_max_applications gauge
+yarn_max_applications{queueName="default",queuePath="root.default",type="capacitySchedulerLeafQueueInfo"} 4000
+yarn_max_applications{queueName="etl",queuePath="root.prod.etl",type="capacitySchedulerLeafQueueInfo"} 4000
+yarn_max_applications{queueName="reporting",queuePath="root.prod.reporting",type="capacitySchedulerLeafQueueInfo"} 2000
+# HELP yarn_am_resource_limit_memory application master memory limit
+# TYPE yarn_am_resource_limit_memory gauge
+yarn_am_resource_limit_memory{queueName="default",queuePath="root.default",type="capacitySchedulerLeafQueueInfo"} 3072
+yarn_am_resource_limit_memory{queueName="etl",queuePath="root.prod.etl",type="capacitySchedulerLeafQueueInfo"} 3072
+yarn_am_resource_limit_memory{queueName="reporting",queuePath="root.prod.reporting",type="capacitySchedulerLeafQueueInfo"} 1024
+# HELP yarn_used_am_resource_memory application master used memory
+# TYPE yarn_used_am_resource_memory gauge
+yarn_used_am_resource_memory{queueName="default",queuePath="root.default",type="capacitySchedulerLeafQueueInfo"} 1024
+yarn_used_am_resource_memory{queueName="etl",queuePath="root.prod.etl",type="capacitySchedulerLeafQueueInfo"} 1024
+yarn_used_am_resource_memory{queueName="reporting",queuePath="root.prod.reporting",type="capacitySchedulerLeafQueueInfo"} 0
+# HELP yarn_user_resource_limit_memory user limit memory
+# TYPE yarn_user_resource_limit_memory gauge
+yarn_user_resource_limit_memory{queueName="default",queuePath="root.default",type="capacitySchedulerLeafQueueInfo",user="alice"} 39321
+yarn_user_resource_limit_memory{queueName="etl",queuePath="root.prod.etl",type="capacitySchedulerLeafQueueInfo",user="etl"} 39321
+# HELP yarn_user_num_active_applications active number applications per user
+# TYPE yarn_user_num_active_applications gauge
+yarn_user_num_active_applications{queueName="default",queuePath="root.default",type="capacitySchedulerLeafQueueInfo",user="alice"} 1
+yarn_user_num_active_applications{queueName="etl",queuePath="root.prod.etl",type="capacitySchedulerLeafQueueInfo",user="etl"} 1
+`
+	c := yarn.NewSchedulerCollector(parseEndpoint(server.URL + "/ws/v1/cluster/scheduler"))
+	err := testutil.CollectAndCompare(c, strings.NewReader(expected),
+		"yarn_max_applications", "yarn_am_resource_limit_memory", "yarn_used_am_resource_memory",
+		"yarn_user_resource_limit_memory", "yarn_user_num_active_applications")
+	if err != nil {
+		t.Error(err)
+	}
+}
+
+func TestParentQueuePreemption(t *testing.T) {
+	server := httptest.NewServer(replayHandler(filepath.Join("testdata", "fixtures", "hadoop-3.3")))
+	defer server.Close()
+
+	// 抢占和容器数对父队列同样有效
+	expected := `
+# HELP yarn_preemption_disabled 1 if preemption is disabled for the queue
+# TYPE yarn_preemption_disabled gauge
+yarn_preemption_disabled{queueName="default",queuePath="root.default",type="capacitySchedulerLeafQueueInfo"} 1
+yarn_preemption_disabled{queueName="etl",queuePath="root.prod.etl",type="capacitySchedulerLeafQueueInfo"} 0
+yarn_preemption_disabled{queueName="prod",queuePath="root.prod",type=""} 0
+yarn_preemption_disabled{queueName="reporting",queuePath="root.prod.reporting",type="capacitySchedulerLeafQueueInfo"} 1
+# HELP yarn_pending_containers queue pending containers
+# TYPE yarn_pending_containers gauge
+yarn_pending_containers{queueName="default",queuePath="root.default",type="capacitySchedulerLeafQueueInfo"} 6
+yarn_pending_containers{queueName="etl",queuePath="root.prod.etl",type="capacitySchedulerLeafQueueInfo"} 6
+yarn_pending_containers{queueName="prod",queuePath="root.prod",type=""} 6
+yarn_pending_containers{queueName="reporting",queuePath="root.prod.reporting",type="capacitySchedulerLeafQueueInfo"} 0
+`
+	c := yarn.NewSchedulerCollector(parseEndpoint(server.URL + "/ws/v1/cluster/scheduler"))
+	if err := testutil.CollectAndCompare(c, strings.NewReader(expected), "yarn_preemption_disabled", "yarn_pending_containers"); err != nil {
+		t.Error(err)
+	}
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"yarn-prometheus-exporter/yarn"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestSparkCollector(t *testing.T) {
+	var appsRequests int32
+	var server *httptest.Server
+	server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/ws/v1/cluster/apps":
+			atomic.AddInt32(&appsRequests, 1)
+			w.Write([]byte(`{"apps": {"app": [
+				{"id": "application_1700000000000_0001", "queue": "default", "user": "alice", "applicationType": "SPARK",
+					"state": "RUNNING", "startedTime": 1700000000000, "trackingUrl": "` + server.URL + `/proxy/application_1700000000000_0001/"},
+				{"id": "application_1700000000000_0002", "queue": "default", "user": "alice", "applicationType": "MAPREDUCE",
+					"state": "RUNNING", "startedTime": 1700000000000},
+				{"id": "application_1700000000000_0003", "queue": "default", "user": "alice", "applicationType": "SPARK",
+					"state": "FINISHED", "startedTime": 1700000000000, "finishedTime": 1700000600000}]}}`))
+		case "/proxy/application_1700000000000_0001/api/v1/applications/application_1700000000000_0001":
+			w.Write([]byte(`{"attempts": [{"attemptId": ""}]}`))
+		case "/proxy/application_1700000000000_0001/api/v1/applications/application_1700000000000_0001/allexecutors":
+			// executor 2 已经退出，它完成的任务仍然计入
+			w.Write([]byte(`[
+				{"id": "driver", "isActive": true},
+				{"id": "1", "isActive": true, "completedTasks": 30, "failedTasks": 1, "totalGCTime": 1500},
+				{"id": "2", "isActive": false, "completedTasks": 12, "totalShuffleRead": 2048}]`))
+		case "/proxy/application_1700000000000_0001/api/v1/applications/application_1700000000000_0001/stages":
+			w.Write([]byte(`[{"status": "ACTIVE"}, {"status": "COMPLETE"}, {"status": "COMPLETE"}]`))
+		default:
+			t.Errorf("unexpected request %s", r.URL)
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	apps, err := yarn.NewAppsCollector(parseEndpoint(server.URL+"/ws/v1/cluster/apps"), yarn.DefaultAppTags, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sc := yarn.NewSparkCollector(apps, nil)
+
+	expected := `
+# HELP yarn_spark_executors active executors of the Spark application
+# TYPE yarn_spark_executors gauge
+yarn_spark_executors{id="application_1700000000000_0001",queue="default",user="alice"} 1
+# HELP yarn_spark_completed_tasks_total completed tasks of the Spark application
+# TYPE yarn_spark_completed_tasks_total counter
+yarn_spark_completed_tasks_total{id="application_1700000000000_0001",queue="default",user="alice"} 42
+# HELP yarn_spark_shuffle_read_bytes_total shuffle bytes read by the Spark application
+# TYPE yarn_spark_shuffle_read_bytes_total counter
+yarn_spark_shuffle_read_bytes_total{id="application_1700000000000_0001",queue="default",user="alice"} 2048
+# HELP yarn_spark_gc_time_seconds_total executor GC time of the Spark application
+# TYPE yarn_spark_gc_time_seconds_total counter
+yarn_spark_gc_time_seconds_total{id="application_1700000000000_0001",queue="default",user="alice"} 1.5
+# HELP yarn_spark_stages stages of the Spark application per status
+# TYPE yarn_spark_stages gauge
+yarn_spark_stages{id="application_1700000000000_0001",queue="default",status="ACTIVE",user="alice"} 1
+yarn_spark_stages{id="application_1700000000000_0001",queue="default",status="COMPLETE",user="alice"} 2
+`
+	// apps 和 spark 注册在同一个 registry 中，一次采集只请求一次 /apps
+	registry := prometheus.NewRegistry()
+	registry.MustRegister(apps, sc)
+	err = testutil.GatherAndCompare(registry, strings.NewReader(expected),
+		"yarn_spark_executors", "yarn_spark_completed_tasks_total", "yarn_spark_shuffle_read_bytes_total",
+		"yarn_spark_gc_time_seconds_total", "yarn_spark_stages")
+	if err != nil {
+		t.Error(err)
+	}
+	if n := atomic.LoadInt32(&appsRequests); n != 1 {
+		t.Errorf("expected one apps request, got %d", n)
+	}
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+	"yarn-prometheus-exporter/yarn"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+func TestStateStores(t *testing.T) {
+	dir := t.TempDir()
+	fileStore, err := yarn.NewFileStateStore(filepath.Join(dir, "state"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	boltStore, err := yarn.NewBoltStateStore(filepath.Join(dir, "state.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer boltStore.Close()
+
+	for name, store := range map[string]yarn.StateStore{"file": fileStore, "bolt": boltStore} {
+		data, err := store.Load("cluster")
+		if err != nil || data != nil {
+			t.Errorf("%s: expected no state, got %q, %v", name, data, err)
+		}
+		if err := store.Save("cluster", []byte(`{"failureCount":3}`)); err != nil {
+			t.Fatal(err)
+		}
+
+		c := yarn.NewClusterCollector(nil, nil)
+		if _, err := yarn.NewCheckpointer(store, 0, c); err != nil {
+			t.Fatal(err)
+		}
+		testValue(t, name+" FailureCount", 3, c.FailureCount)
+	}
+}
+
+func TestClusterRestoreCreated(t *testing.T) {
+	server := httptest.NewServer(http.NotFoundHandler())
+	defer server.Close()
+
+	// 失败次数和 created 一起恢复，created 不是本次进程的启动时间
+	c := yarn.NewClusterCollector(parseEndpoint(server.URL+"/ws/v1/cluster/metrics"), parseEndpoint(server.URL+"/ws/v1/cluster/info"))
+	if err := c.Restore([]byte(`{"failureCount":3,"created":1700000000000}`)); err != nil {
+		t.Fatal(err)
+	}
+	registry := prometheus.NewPedanticRegistry()
+	registry.MustRegister(c)
+	families, err := registry.Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, family := range families {
+		if family.GetName() != "yarn_scrape_failures_total" {
+			continue
+		}
+		counter := family.Metric[0].Counter
+		testValue(t, "scrape failures", 4, int(counter.GetValue()))
+		if created := counter.CreatedTimestamp.AsTime(); !created.Equal(time.UnixMilli(1700000000000)) {
+			t.Errorf("expected the restored created timestamp, got %s", created)
+		}
+		return
+	}
+	t.Error("yarn_scrape_failures_total not collected")
+}
@@ -0,0 +1,161 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+	"yarn-prometheus-exporter/yarn"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestTimelineFlowsAcrossDays(t *testing.T) {
+	var mu sync.Mutex
+	runRequests := make(map[string]int)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/ws/v2/timeline/flows":
+			// 两天的 flow activity，etl 两天都有 run，每天各一条
+			w.Write([]byte(`[
+				{"id": "1700092800000/alice@etl", "type": "YARN_FLOW_ACTIVITY", "info": {"SYSTEM_INFO_USER": "alice", "SYSTEM_INFO_FLOW_NAME": "etl"}},
+				{"id": "1700092800000/bob@report", "type": "YARN_FLOW_ACTIVITY", "info": {"SYSTEM_INFO_USER": "bob", "SYSTEM_INFO_FLOW_NAME": "report"}},
+				{"id": "1700006400000/alice@etl", "type": "YARN_FLOW_ACTIVITY", "info": {"SYSTEM_INFO_USER": "alice", "SYSTEM_INFO_FLOW_NAME": "etl"}}]`))
+		case "/ws/v2/timeline/users/alice/flows/etl/runs":
+			mu.Lock()
+			runRequests["etl"]++
+			mu.Unlock()
+			w.Write([]byte(`[
+				{"id": "alice@etl/1700010000000", "type": "YARN_FLOW_RUN", "metrics": [
+					{"id": "YARN_APPLICATION_MEMORY", "values": {"1700010000000": 1000, "1700013600000": 4000}},
+					{"id": "YARN_APPLICATION_CPU", "values": {"1700013600000": 2}}]},
+				{"id": "alice@etl/1700096400000", "type": "YARN_FLOW_RUN", "metrics": [
+					{"id": "YARN_APPLICATION_MEMORY", "values": {"1700100000000": 6000}},
+					{"id": "YARN_APPLICATION_CPU", "values": {"1700100000000": 3}}]}]`))
+		case "/ws/v2/timeline/users/alice/flows/etl/apps":
+			mu.Lock()
+			runRequests["etl/apps"]++
+			mu.Unlock()
+			w.Write([]byte(`[
+				{"id": "application_1700000000000_0001", "type": "YARN_APPLICATION", "info": {"YARN_APPLICATION_FINAL_STATUS": "SUCCEEDED"}},
+				{"id": "application_1700000000000_0002", "type": "YARN_APPLICATION", "info": {"YARN_APPLICATION_FINAL_STATUS": "FAILED"}},
+				{"id": "application_1700000000000_0003", "type": "YARN_APPLICATION", "info": {"YARN_APPLICATION_FINAL_STATUS": "SUCCEEDED"}}]`))
+		case "/ws/v2/timeline/users/bob/flows/report/apps":
+			mu.Lock()
+			runRequests["report/apps"]++
+			mu.Unlock()
+			w.Write([]byte(`[{"id": "application_1700000000000_0004", "type": "YARN_APPLICATION", "info": {}}]`))
+		case "/ws/v2/timeline/users/bob/flows/report/runs":
+			mu.Lock()
+			runRequests["report"]++
+			mu.Unlock()
+			w.Write([]byte(`[{"id": "bob@report/1700096400000", "type": "YARN_FLOW_RUN", "metrics": [
+				{"id": "YARN_APPLICATION_MEMORY", "values": {"1700100000000": 512}}]}]`))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	expected := `
+# HELP yarn_timeline_up Able to contact the Timeline Reader on the last poll
+# TYPE yarn_timeline_up gauge
+yarn_timeline_up 1
+# HELP yarn_timeline_flow_apps applications of the flow created in the lookback window
+# TYPE yarn_timeline_flow_apps gauge
+yarn_timeline_flow_apps{finalStatus="FAILED",flow="etl",user="alice"} 1
+yarn_timeline_flow_apps{finalStatus="SUCCEEDED",flow="etl",user="alice"} 2
+yarn_timeline_flow_apps{finalStatus="UNDEFINED",flow="report",user="bob"} 1
+# HELP yarn_timeline_flow_runs flow runs created in the lookback window
+# TYPE yarn_timeline_flow_runs gauge
+yarn_timeline_flow_runs{flow="etl",user="alice"} 2
+yarn_timeline_flow_runs{flow="report",user="bob"} 1
+# HELP yarn_timeline_flow_memory_seconds memory seconds of flow runs in the lookback window :MB
+# TYPE yarn_timeline_flow_memory_seconds gauge
+yarn_timeline_flow_memory_seconds{flow="etl",user="alice"} 10000
+yarn_timeline_flow_memory_seconds{flow="report",user="bob"} 512
+# HELP yarn_timeline_flow_v_core_seconds core seconds of flow runs in the lookback window
+# TYPE yarn_timeline_flow_v_core_seconds gauge
+yarn_timeline_flow_v_core_seconds{flow="etl",user="alice"} 5
+yarn_timeline_flow_v_core_seconds{flow="report",user="bob"} 0
+`
+	// pedantic registry 检查没有重复的序列
+	c := yarn.NewTimelineCollector(parseEndpoint(server.URL+"/ws/v2/timeline"), 2, 100, time.Minute)
+	registry := prometheus.NewPedanticRegistry()
+	registry.MustRegister(c)
+	if err := c.Poll(); err != nil {
+		t.Fatal(err)
+	}
+	if err := testutil.GatherAndCompare(registry, strings.NewReader(expected)); err != nil {
+		t.Error(err)
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	for flow, n := range runRequests {
+		if n != 1 {
+			t.Errorf("expected one request for %s, got %d", flow, n)
+		}
+	}
+
+	// scrape 不请求 Timeline Reader
+	if err := testutil.GatherAndCompare(registry, strings.NewReader(expected)); err != nil {
+		t.Error(err)
+	}
+	for flow, n := range runRequests {
+		if n != 1 {
+			t.Errorf("expected scrapes not to request %s, got %d requests", flow, n)
+		}
+	}
+
+	// v2 名称中 MB-seconds 换算为 byte-seconds
+	expected = `
+# HELP yarn_timeline_flow_memory_byte_seconds Memory seconds of flow runs in the lookback window
+# TYPE yarn_timeline_flow_memory_byte_seconds gauge
+yarn_timeline_flow_memory_byte_seconds{flow="etl",user="alice"} 1.048576e+10
+yarn_timeline_flow_memory_byte_seconds{flow="report",user="bob"} 5.36870912e+08
+`
+	if err := testutil.CollectAndCompare(yarn.WithNaming(c, yarn.NamingV2), strings.NewReader(expected), "yarn_timeline_flow_memory_byte_seconds", "yarn_timeline_flow_memory_seconds"); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestTimelineDownKeepsLastPoll(t *testing.T) {
+	var down bool
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if down {
+			http.Error(w, "unavailable", http.StatusServiceUnavailable)
+			return
+		}
+		switch r.URL.Path {
+		case "/flows":
+			w.Write([]byte(`[{"id": "1700092800000/alice@etl", "type": "YARN_FLOW_ACTIVITY", "info": {"SYSTEM_INFO_USER": "alice", "SYSTEM_INFO_FLOW_NAME": "etl"}}]`))
+		default:
+			w.Write([]byte(`[]`))
+		}
+	}))
+	defer server.Close()
+
+	c := yarn.NewTimelineCollector(parseEndpoint(server.URL), 1, 100, time.Minute)
+	if err := c.Poll(); err != nil {
+		t.Fatal(err)
+	}
+	down = true
+	if err := c.Poll(); err == nil {
+		t.Fatal("expected an error from an unavailable Timeline Reader")
+	}
+
+	expected := `
+# HELP yarn_timeline_up Able to contact the Timeline Reader on the last poll
+# TYPE yarn_timeline_up gauge
+yarn_timeline_up 0
+# HELP yarn_timeline_flow_runs flow runs created in the lookback window
+# TYPE yarn_timeline_flow_runs gauge
+yarn_timeline_flow_runs{flow="etl",user="alice"} 0
+`
+	if err := testutil.CollectAndCompare(c, strings.NewReader(expected), "yarn_timeline_up", "yarn_timeline_flow_runs"); err != nil {
+		t.Error(err)
+	}
+}
@@ -0,0 +1,59 @@
+package yarn
+
+import (
+	"encoding/json"
+	"os"
+	"regexp"
+)
+
+/**
+NameRule 把应用名改写为 job_name，去掉名称中的日期、UUID 等每次运行都不同的部分。
+规则按顺序匹配，第一个匹配 Pattern 的规则把匹配部分替换为 Replacement（支持 $1 等分组引用）；
+没有规则匹配时 job_name 等于应用名。
+例如 {"pattern": "_\\d{4}-\\d{2}-\\d{2}_[0-9a-z]+$", "replacement": ""} 把 etl_2026-10-17_abc123 改写为 etl
+*/
+
+type NameRule struct {
+	Pattern     string `json:"pattern"`
+	Replacement string `json:"replacement"`
+
+	pattern *regexp.Regexp
+}
+
+/**
+从 JSON 文件加载规则，文件内容为 NameRule 数组
+*/
+
+func LoadNameRules(path string) ([]*NameRule, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var rules []*NameRule
+	if err := json.NewDecoder(f).Decode(&rules); err != nil {
+		return nil, err
+	}
+	return rules, nil
+}
+
+func compileNameRules(rules []*NameRule) error {
+	for _, rule := range rules {
+		pattern, err := regexp.Compile(rule.Pattern)
+		if err != nil {
+			return err
+		}
+		rule.pattern = pattern
+	}
+	return nil
+}
+
+func jobName(rules []*NameRule, name string) string {
+	for _, rule := range rules {
+		if rule.pattern.MatchString(name) {
+			return rule.pattern.ReplaceAllString(name, rule.Replacement)
+		}
+	}
+	return name
+}
@@ -2,13 +2,14 @@ package yarn
 
 import (
 	"encoding/json"
-	"errors"
 	"fmt"
 	"github.com/prometheus/client_golang/prometheus"
-	"io"
 	"log"
-	"net/http"
 	"net/url"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
 )
 
 /**
@@ -30,6 +31,8 @@ type application struct {
 	VCoreSeconds           int     `json:"vcoreSeconds"`
 	QueueUsagePercentage   float64 `json:"queueUsagePercentage"`
 	ClusterUsagePercentage float64 `json:"clusterUsagePercentage"`
+	// 按分区的资源使用，包含自定义资源类型
+	ResourceInfo queueResources `json:"resourceInfo"`
 	// 标签
 	Id              string `json:"id"`
 	User            string `json:"user"`
@@ -39,6 +42,113 @@ type application struct {
 	FinalStatus     string `json:"finalStatus"`
 	ApplicationType string `json:"applicationType"`
 	ApplicationTags string `json:"applicationTags"`
+	// 非标签
+	TrackingUrl  string `json:"trackingUrl"`
+	StartedTime  int64  `json:"startedTime"`
+	FinishedTime int64  `json:"finishedTime"`
+}
+
+/**
+exemplar 指向具体的应用，标签总长度超过限制时去掉 tracking_url
+*/
+
+func (a *application) exemplar() prometheus.Labels {
+	exemplar := prometheus.Labels{"application_id": a.Id, "tracking_url": a.TrackingUrl}
+	runes := 0
+	for name, value := range exemplar {
+		runes += utf8.RuneCountInString(name) + utf8.RuneCountInString(value)
+	}
+	if runes > prometheus.ExemplarMaxRunes {
+		delete(exemplar, "tracking_url")
+	}
+	return exemplar
+}
+
+/**
+AppTags 配置如何解析 applicationTags。YARN 以逗号分隔多个 tag，例如 "team:data,pipeline:etl"；
+Keys 中的 key 会成为单独的标签（标签名中的非法字符替换为 _），KeepRaw 为 false 时不再输出原始的 applicationTags 标签
+*/
+
+type AppTags struct {
+	Keys      []string
+	Separator string
+	KeepRaw   bool
+}
+
+var DefaultAppTags = AppTags{Separator: ":", KeepRaw: true}
+
+func (t AppTags) labelNames() []string {
+	names := make([]string, 0, len(t.Keys))
+	for _, key := range t.Keys {
+		names = append(names, tagLabelName(key))
+	}
+	return names
+}
+
+func tagLabelName(key string) string {
+	return strings.Map(func(r rune) rune {
+		if r == '_' || r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' {
+			return r
+		}
+		return '_'
+	}, key)
+}
+
+// appLabels 是应用和汇总指标已经使用的标签，tag 不能使用这些标签名
+var appLabels = []string{"id", "user", "name", "queue", "state", "finalStatus", "applicationType", "applicationTags", "job_name", "le"}
+
+/**
+Validate 检查 Keys 转换后的标签名：不能以数字开头或以 __ 开头，不能与应用指标已有的标签、
+ConstLabels 或其它 key 重名，否则注册或采集时才会失败
+*/
+
+func (t AppTags) Validate() error {
+	used := make(map[string]string)
+	for _, label := range appLabels {
+		used[label] = "an existing label"
+	}
+	for label := range ConstLabels {
+		used[label] = "a const label"
+	}
+	for _, key := range t.Keys {
+		label := tagLabelName(key)
+		if label == "" || label[0] >= '0' && label[0] <= '9' || strings.HasPrefix(label, "__") {
+			return fmt.Errorf("app tag %q: %q is not a valid label name", key, label)
+		}
+		if owner, ok := used[label]; ok {
+			return fmt.Errorf("app tag %q: label %q clashes with %s", key, label, owner)
+		}
+		used[label] = fmt.Sprintf("app tag %q", key)
+	}
+	return nil
+}
+
+/**
+解析 applicationTags，没有分隔符的 tag 忽略，同一个 key 出现多次时取第一个
+*/
+
+func (t AppTags) parse(raw string) map[string]string {
+	tags := make(map[string]string)
+	for _, tag := range strings.Split(raw, ",") {
+		kv := strings.SplitN(tag, t.Separator, 2)
+		if len(kv) != 2 {
+			continue
+		}
+		key := strings.TrimSpace(kv[0])
+		if _, ok := tags[key]; !ok {
+			tags[key] = strings.TrimSpace(kv[1])
+		}
+	}
+	return tags
+}
+
+// values 按 Keys 的顺序返回 tag 的值，缺少的 key 为空字符串
+func (t AppTags) values(tags map[string]string) []string {
+	values := make([]string, 0, len(t.Keys))
+	for _, key := range t.Keys {
+		values = append(values, tags[key])
+	}
+	return values
 }
 
 /**
@@ -47,11 +157,48 @@ type application struct {
 
 func (ac *ApplicationCollector) labels() []string {
 	var labels []string
-	return append(labels, "id", "user", "name", "queue", "state", "finalStatus", "applicationType", "applicationTags")
+	labels = append(labels, "id", "user", "name", "queue", "state", "finalStatus", "applicationType")
+	if ac.Tags.KeepRaw {
+		labels = append(labels, "applicationTags")
+	}
+	return append(labels, ac.rollupLabels()...)
+}
+
+func (ac *ApplicationCollector) labelValues(a *application) []string {
+	labelValues := make([]string, 0, len(ac.labels()))
+	labelValues = append(labelValues, a.Id, a.User, a.Name, a.Queue, a.State, a.FinalStatus, a.ApplicationType)
+	if ac.Tags.KeepRaw {
+		labelValues = append(labelValues, a.ApplicationTags)
+	}
+	return append(labelValues, ac.rollupValues(a)...)
+}
+
+/**
+汇总指标（耗时、失败数、chargeback）在 queue、user 等之外额外使用的标签：
+配置了改写规则时的 job_name，以及提升为标签的 applicationTags
+*/
+
+func (ac *ApplicationCollector) rollupLabels() []string {
+	var labels []string
+	if len(ac.NameRules) > 0 {
+		labels = append(labels, "job_name")
+	}
+	return append(labels, ac.Tags.labelNames()...)
+}
+
+func (ac *ApplicationCollector) rollupValues(a *application) []string {
+	var values []string
+	if len(ac.NameRules) > 0 {
+		values = append(values, jobName(ac.NameRules, a.Name))
+	}
+	return append(values, ac.Tags.values(ac.Tags.parse(a.ApplicationTags))...)
 }
 
 type ApplicationCollector struct {
+	variants
 	ApplicationEndpoint    *url.URL
+	Tags                   AppTags
+	NameRules              []*NameRule
 	ElapsedTime            *prometheus.Desc
 	AllocatedMB            *prometheus.Desc
 	AllocatedVCores        *prometheus.Desc
@@ -60,29 +207,54 @@ type ApplicationCollector struct {
 	VCoreSeconds           *prometheus.Desc
 	QueueUsagePercentage   *prometheus.Desc
 	ClusterUsagePercentage *prometheus.Desc
+	AllocatedResource      *prometheus.Desc
+	// 已结束应用的耗时和失败数，带有指向应用的 exemplar
+	Durations *prometheus.Desc
+	Failures  *prometheus.Desc
+
+	mu     sync.Mutex
+	state  appsState
+	totals map[string]*appTotals
+
+	// 最近一次 /apps 请求的结果，Spark、chargeback 和作业 SLA 在 CacheTTL 内复用
+	CacheTTL  time.Duration
+	fetchMu   sync.Mutex
+	fetchedAt time.Time
+	lastApps  []*application
+	lastErr   error
 }
 
+// 同一次采集中各个 collector 共用一次 /apps 请求
+const appsCacheTTL = 5 * time.Second
+
 /**
 收集指标
 */
 
 func (ac *ApplicationCollector) Collect(ch chan<- prometheus.Metric) {
-	metrics, err := ac.fetch(ac.ApplicationEndpoint)
+	metrics, err := ac.latest()
 	if err != nil {
 		log.Println("Error while collecting data from YARN: " + err.Error())
 		return
 	}
+	ac.observeFinished(metrics)
+	ac.collectFinished(ch)
 	for _, a := range metrics {
-		labelValues := make([]string, 0, len(ac.labels()))
-		labelValues = append(labelValues, a.Id, a.User, a.Name, a.Queue, a.State, a.FinalStatus, a.ApplicationType, a.ApplicationTags)
+		labelValues := ac.labelValues(a)
 		ch <- prometheus.MustNewConstMetric(ac.ElapsedTime, prometheus.GaugeValue, float64(a.ElapsedTime), labelValues...)
 		ch <- prometheus.MustNewConstMetric(ac.AllocatedMB, prometheus.GaugeValue, float64(a.AllocatedMB), labelValues...)
 		ch <- prometheus.MustNewConstMetric(ac.AllocatedVCores, prometheus.GaugeValue, float64(a.AllocatedVCores), labelValues...)
 		ch <- prometheus.MustNewConstMetric(ac.RunningContainers, prometheus.GaugeValue, float64(a.RunningContainers), labelValues...)
-		ch <- prometheus.MustNewConstMetric(ac.MemorySeconds, prometheus.GaugeValue, float64(a.MemorySeconds), labelValues...)
-		ch <- prometheus.MustNewConstMetric(ac.VCoreSeconds, prometheus.GaugeValue, float64(a.VCoreSeconds), labelValues...)
+		// 资源用量在应用生命周期内单调递增
+		started := time.Time{}
+		if a.StartedTime > 0 {
+			started = time.UnixMilli(a.StartedTime)
+		}
+		ch <- newCumulativeMetric(ac.MemorySeconds, prometheus.GaugeValue, float64(a.MemorySeconds), started, labelValues...)
+		ch <- newCumulativeMetric(ac.VCoreSeconds, prometheus.GaugeValue, float64(a.VCoreSeconds), started, labelValues...)
 		ch <- prometheus.MustNewConstMetric(ac.QueueUsagePercentage, prometheus.GaugeValue, a.QueueUsagePercentage, labelValues...)
 		ch <- prometheus.MustNewConstMetric(ac.ClusterUsagePercentage, prometheus.GaugeValue, a.ClusterUsagePercentage, labelValues...)
+		collectResources(ch, ac.AllocatedResource, a.allocatedResource(), labelValues...)
 	}
 
 }
@@ -100,59 +272,249 @@ func (ac *ApplicationCollector) Describe(ch chan<- *prometheus.Desc) {
 	ch <- ac.VCoreSeconds
 	ch <- ac.QueueUsagePercentage
 	ch <- ac.ClusterUsagePercentage
+	ch <- ac.AllocatedResource
+	ch <- ac.Durations
+	ch <- ac.Failures
 }
 
-/*
-*
-请求数据源
+// 应用耗时直方图的桶上界，单位秒
+var appDurationBuckets = prometheus.ExponentialBuckets(60, 2, 12)
+
+/**
+appsState 是需要持久化的状态：Finished 是上次采集时已经结束的应用，为 nil 表示还没有采集过；
+Durations 和 Failures 是按标签值累加的耗时直方图和失败数，Labels 按 Describe 中的标签顺序保存。
+持久化 Finished 后，停机期间结束的应用在重启后计入一次，重启前已经计入的应用不会重复计入
 */
-func (ac *ApplicationCollector) fetch(u *url.URL) ([]*application, error) {
-	req := http.Request{
-		Method:     "GET",
-		URL:        u,
-		Proto:      "HTTP/1.1",
-		ProtoMajor: 1,
-		ProtoMinor: 1,
-		Header:     make(http.Header),
-		Host:       u.Host,
-	}
-	resp, err := http.DefaultClient.Do(&req)
-	if err != nil {
-		return nil, err
+
+type appsState struct {
+	Finished  map[string]bool `json:"finished"`
+	Durations []*appTotals    `json:"durations"`
+	Failures  []*appTotals    `json:"failures"`
+}
+type appTotals struct {
+	Labels []string `json:"labels"`
+	Count  uint64   `json:"count"`
+	// 耗时直方图，Buckets 与 appDurationBuckets 对应，不累计；失败数只使用 Count
+	Sum     float64  `json:"sum,omitempty"`
+	Buckets []uint64 `json:"buckets,omitempty"`
+	Created int64    `json:"created"`
+	// 最近一个应用的 exemplar，不持久化
+	exemplar *prometheus.Exemplar
+}
+
+/**
+对新结束的应用记录耗时和失败数。第一次采集时 RM 中已经结束的应用只记为已见过，不计入指标
+*/
+
+func (ac *ApplicationCollector) observeFinished(apps []*application) {
+	ac.mu.Lock()
+	defer ac.mu.Unlock()
+
+	now := time.Now()
+	finished := make(map[string]bool)
+	for _, a := range apps {
+		if a.FinishedTime == 0 {
+			continue
+		}
+		finished[a.Id] = true
+		if ac.state.Finished == nil || ac.state.Finished[a.Id] {
+			continue
+		}
+		rollup := ac.rollupValues(a)
+		labels, finishedAt := a.exemplar(), time.UnixMilli(a.FinishedTime)
+		// 启动之前就被 kill 的应用 startedTime 为 0，没有耗时
+		if a.StartedTime > 0 {
+			duration := float64(a.FinishedTime-a.StartedTime) / 1000
+			d := ac.totalsOf(&ac.state.Durations, "duration", append([]string{a.Queue, a.ApplicationType, a.FinalStatus}, rollup...), now)
+			d.Count++
+			d.Sum += duration
+			for i, upperBound := range appDurationBuckets {
+				if duration <= upperBound {
+					d.Buckets[i]++
+					break
+				}
+			}
+			d.exemplar = &prometheus.Exemplar{Value: duration, Labels: labels, Timestamp: finishedAt}
+		}
+		if a.FinalStatus == "FAILED" {
+			f := ac.totalsOf(&ac.state.Failures, "failures", append([]string{a.Queue, a.User, a.ApplicationType}, rollup...), now)
+			f.Count++
+			f.exemplar = &prometheus.Exemplar{Value: 1, Labels: labels, Timestamp: finishedAt}
+		}
 	}
+	ac.state.Finished = finished
+}
+
+// kind 区分直方图和失败数，两者的标签值可能相同
+func totalsKey(kind string, labelValues []string) string {
+	return kind + "\xff" + strings.Join(labelValues, "\xff")
+}
 
-	defer func(Body io.ReadCloser) {
-		err := Body.Close()
-		if err != nil {
-			log.Fatal("response body error: " + err.Error())
+func (ac *ApplicationCollector) totalsOf(list *[]*appTotals, kind string, labelValues []string, now time.Time) *appTotals {
+	key := totalsKey(kind, labelValues)
+	if t, ok := ac.totals[key]; ok {
+		return t
+	}
+	t := &appTotals{Labels: labelValues, Created: now.UnixMilli()}
+	if kind == "duration" {
+		t.Buckets = make([]uint64, len(appDurationBuckets))
+	}
+	ac.totals[key] = t
+	*list = append(*list, t)
+	return t
+}
+
+func (ac *ApplicationCollector) collectFinished(ch chan<- prometheus.Metric) {
+	ac.mu.Lock()
+	defer ac.mu.Unlock()
+
+	for _, d := range ac.state.Durations {
+		buckets := make(map[float64]uint64, len(appDurationBuckets))
+		var cumulative uint64
+		for i, upperBound := range appDurationBuckets {
+			cumulative += d.Buckets[i]
+			buckets[upperBound] = cumulative
 		}
-	}(resp.Body)
+		m := prometheus.MustNewConstHistogramWithCreatedTimestamp(ac.Durations, d.Count, d.Sum, buckets, time.UnixMilli(d.Created), d.Labels...)
+		ch <- withExemplar(m, d.exemplar)
+	}
+	for _, f := range ac.state.Failures {
+		m := newCounterMetric(ac.Failures, float64(f.Count), time.UnixMilli(f.Created), f.Labels...)
+		ch <- withExemplar(m, f.exemplar)
+	}
+}
 
-	if resp.StatusCode != 200 {
-		return nil, errors.New(fmt.Sprintf("unexpected HTTP status: %v", resp.StatusCode))
+func withExemplar(m prometheus.Metric, exemplar *prometheus.Exemplar) prometheus.Metric {
+	if exemplar == nil {
+		return m
 	}
+	return prometheus.MustNewMetricWithExemplars(m, *exemplar)
+}
 
+func (ac *ApplicationCollector) StateKey() string {
+	return "apps"
+}
+
+func (ac *ApplicationCollector) Snapshot() ([]byte, error) {
+	ac.mu.Lock()
+	defer ac.mu.Unlock()
+	return json.Marshal(&ac.state)
+}
+
+/**
+恢复已见过的应用和累加的指标。标签数量与当前配置（job_name 改写规则、提升为标签的 tag）不一致，
+或直方图的桶与 appDurationBuckets 不一致的行无法对应到当前的指标，丢弃
+*/
+
+func (ac *ApplicationCollector) Restore(data []byte) error {
+	var state appsState
+	if err := json.Unmarshal(data, &state); err != nil {
+		return err
+	}
+	rollup := len(ac.rollupLabels())
+	restored := appsState{Finished: state.Finished}
+	totals := make(map[string]*appTotals)
+	for _, d := range state.Durations {
+		if len(d.Labels) != 3+rollup || len(d.Buckets) != len(appDurationBuckets) {
+			continue
+		}
+		totals[totalsKey("duration", d.Labels)] = d
+		restored.Durations = append(restored.Durations, d)
+	}
+	for _, f := range state.Failures {
+		if len(f.Labels) != 3+rollup {
+			continue
+		}
+		totals[totalsKey("failures", f.Labels)] = f
+		restored.Failures = append(restored.Failures, f)
+	}
+	ac.mu.Lock()
+	defer ac.mu.Unlock()
+	ac.state = restored
+	ac.totals = totals
+	return nil
+}
+
+/**
+应用在所有分区上已分配的资源合计，按资源类型汇总
+*/
+
+func (a *application) allocatedResource() resourcesUsed {
+	var total resourcesUsed
+	index := make(map[string]*resourceInformation)
+	for _, p := range a.ResourceInfo.ResourceUsagesByPartition {
+		for _, ri := range p.Used.ResourceInformations.ResourceInformation {
+			if sum, ok := index[ri.Name]; ok {
+				sum.Value += ri.Value
+				continue
+			}
+			sum := *ri
+			index[ri.Name] = &sum
+			total.ResourceInformations.ResourceInformation = append(total.ResourceInformations.ResourceInformation, &sum)
+		}
+	}
+	return total
+}
+
+/**
+返回 CacheTTL 内最近一次拉取的应用列表，过期时重新拉取；并发调用时只发出一个请求
+*/
+
+func (ac *ApplicationCollector) latest() ([]*application, error) {
+	ac.fetchMu.Lock()
+	defer ac.fetchMu.Unlock()
+	if !ac.fetchedAt.IsZero() && time.Since(ac.fetchedAt) < ac.CacheTTL {
+		return ac.lastApps, ac.lastErr
+	}
+	ac.lastApps, ac.lastErr = ac.fetch(ac.ApplicationEndpoint)
+	ac.fetchedAt = time.Now()
+	return ac.lastApps, ac.lastErr
+}
+
+/*
+*
+请求数据源
+*/
+func (ac *ApplicationCollector) fetch(u *url.URL) ([]*application, error) {
 	var c applicationList
-	err = json.NewDecoder(resp.Body).Decode(&c)
-	if err != nil {
+	if err := fetchJSON(u, &c); err != nil {
 		return nil, err
 	}
-
 	return c.Apps.App, nil
 }
 
-func NewAppsCollector(endpoint *url.URL) *ApplicationCollector {
-	labels := new(ApplicationCollector).labels()
+func NewAppsCollector(endpoint *url.URL, tags AppTags, nameRules []*NameRule) (*ApplicationCollector, error) {
+	if tags.Separator == "" {
+		tags.Separator = DefaultAppTags.Separator
+	}
+	if err := tags.Validate(); err != nil {
+		return nil, err
+	}
+	if err := compileNameRules(nameRules); err != nil {
+		return nil, err
+	}
+	ac := &ApplicationCollector{Tags: tags, NameRules: nameRules}
+	labels := ac.labels()
+	rollupLabels := ac.rollupLabels()
+	vs := make(variants)
 	return &ApplicationCollector{
+		variants: vs,
 		// application
 		ApplicationEndpoint:    endpoint,
-		ElapsedTime:            newFuncMetric("elapsed_time", "elapsed time", labels, nil),
-		AllocatedMB:            newFuncMetric("allocated_MB", "allocated memory :MB", labels, nil),
-		AllocatedVCores:        newFuncMetric("allocated_v_cores", "allocated core", labels, nil),
-		RunningContainers:      newFuncMetric("running_containers", "running containers", labels, nil),
-		MemorySeconds:          newFuncMetric("memory_seconds", "memory seconds", labels, nil),
-		VCoreSeconds:           newFuncMetric("v_core_seconds", "core seconds", labels, nil),
-		QueueUsagePercentage:   newFuncMetric("queue_usage_percentage", "queue usage percentage", labels, nil),
-		ClusterUsagePercentage: newFuncMetric("cluster_usage_percentage", "cluster_usage_percentage", labels, nil),
-	}
+		Tags:                   tags,
+		NameRules:              nameRules,
+		CacheTTL:               appsCacheTTL,
+		ElapsedTime:            vs.newFuncMetric("elapsed_time", "elapsed time", labels, nil),
+		AllocatedMB:            vs.newFuncMetric("allocated_MB", "allocated memory :MB", labels, nil),
+		AllocatedVCores:        vs.newFuncMetric("allocated_v_cores", "allocated core", labels, nil),
+		RunningContainers:      vs.newFuncMetric("running_containers", "running containers", labels, nil),
+		MemorySeconds:          vs.newFuncMetric("memory_seconds", "memory seconds", labels, nil),
+		VCoreSeconds:           vs.newFuncMetric("v_core_seconds", "core seconds", labels, nil),
+		QueueUsagePercentage:   vs.newFuncMetric("queue_usage_percentage", "queue usage percentage", labels, nil),
+		ClusterUsagePercentage: vs.newFuncMetric("cluster_usage_percentage", "cluster_usage_percentage", labels, nil),
+		AllocatedResource:      vs.newFuncMetric("app_allocated_resource", "allocated resource per resource type", resourceLabels(labels), nil),
+		Durations:              vs.newFuncMetric("application_duration_seconds", "duration of finished applications", append([]string{"queue", "applicationType", "finalStatus"}, rollupLabels...), nil),
+		Failures:               vs.newFuncMetric("application_failures_total", "applications finished with finalStatus FAILED", append([]string{"queue", "user", "applicationType"}, rollupLabels...), nil),
+		totals:                 make(map[string]*appTotals),
+	}, nil
 }
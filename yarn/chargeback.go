@@ -0,0 +1,278 @@
+package yarn
+
+import (
+	"encoding/json"
+	"github.com/prometheus/client_golang/prometheus"
+	"log"
+	"strings"
+	"sync"
+	"time"
+)
+
+/**
+chargebackState 是需要持久化的累加状态：
+Baseline 是第一次采集的时间（毫秒），之前启动的应用只累加 Baseline 之后的增量；
+Apps 记录每个应用上次采集时的 memorySeconds 和 vcoreSeconds，用于计算运行中应用的增量；
+Usage 是按 queue、user、applicationType、job_name 和提升为标签的 applicationTags 累加的用量；
+FailureCount 是 ScrapeFailures 的计数
+*/
+
+type chargebackState struct {
+	Baseline     int64                `json:"baseline"`
+	Apps         map[string]*appUsage `json:"apps"`
+	Usage        []*chargebackUsage   `json:"usage"`
+	FailureCount int                  `json:"failureCount"`
+}
+type appUsage struct {
+	MemorySeconds int `json:"memorySeconds"`
+	VCoreSeconds  int `json:"vcoreSeconds"`
+}
+type chargebackUsage struct {
+	Queue           string            `json:"queue"`
+	User            string            `json:"user"`
+	ApplicationType string            `json:"applicationType"`
+	JobName         string            `json:"jobName,omitempty"`
+	Tags            map[string]string `json:"tags,omitempty"`
+	MemorySeconds   float64           `json:"memorySeconds"`
+	VCoreSeconds    float64           `json:"vcoreSeconds"`
+	CostUnits       float64           `json:"costUnits"`
+	Created         int64             `json:"created"`
+}
+
+func (cb *ChargebackCollector) labels() []string {
+	var labels []string
+	labels = append(labels, "queue", "user", "applicationType")
+	if cb.Apps != nil {
+		labels = append(labels, cb.Apps.rollupLabels()...)
+	}
+	return labels
+}
+
+/**
+ChargebackCollector 每次采集时拉取全部应用，把 memorySeconds 和 vcoreSeconds 的增量
+累加到按 queue、user、applicationType 划分的计数器中，并按单价换算为 cost units。
+累加状态通过 Stateful 接口由 Checkpointer 持久化
+*/
+
+type ChargebackCollector struct {
+	Apps       *ApplicationCollector
+	MemoryRate float64
+	VCoreRate  float64
+
+	mu             sync.Mutex
+	state          chargebackState
+	index          map[string]*chargebackUsage
+	MemorySeconds  *prometheus.Desc
+	VCoreSeconds   *prometheus.Desc
+	CostUnits      *prometheus.Desc
+	ScrapeFailures *prometheus.Desc
+}
+
+func (cb *ChargebackCollector) Collect(ch chan<- prometheus.Metric) {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+
+	if err := cb.poll(time.Now()); err != nil {
+		cb.state.FailureCount++
+		log.Println("Error while collecting data from YARN: " + err.Error())
+	}
+	ch <- prometheus.MustNewConstMetric(cb.ScrapeFailures, prometheus.CounterValue, float64(cb.state.FailureCount))
+	for _, u := range cb.state.Usage {
+		labelValues := cb.labelValues(u)
+		created := time.UnixMilli(u.Created)
+		ch <- newCounterMetric(cb.MemorySeconds, u.MemorySeconds, created, labelValues...)
+		ch <- newCounterMetric(cb.VCoreSeconds, u.VCoreSeconds, created, labelValues...)
+		ch <- newCounterMetric(cb.CostUnits, u.CostUnits, created, labelValues...)
+	}
+}
+
+func (cb *ChargebackCollector) labelValues(u *chargebackUsage) []string {
+	labelValues := []string{u.Queue, u.User, u.ApplicationType}
+	if len(cb.Apps.NameRules) > 0 {
+		labelValues = append(labelValues, u.JobName)
+	}
+	return append(labelValues, cb.Apps.Tags.values(u.Tags)...)
+}
+
+func (cb *ChargebackCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- cb.MemorySeconds
+	ch <- cb.VCoreSeconds
+	ch <- cb.CostUnits
+	ch <- cb.ScrapeFailures
+}
+
+/**
+拉取应用并累加增量。第一次采集只记录各应用当前的用量作为基线，不计入；
+之后第一次见到的应用在基线之后启动时按全部用量计入，否则同样只记录基线。
+RM 不再返回的应用从 Apps 中移除
+*/
+
+func (cb *ChargebackCollector) poll(now time.Time) error {
+	apps, err := cb.Apps.latest()
+	if err != nil {
+		return err
+	}
+
+	first := cb.state.Baseline == 0
+	if first {
+		cb.state.Baseline = now.UnixMilli()
+	}
+	seen := make(map[string]*appUsage, len(apps))
+	for _, a := range apps {
+		current := &appUsage{MemorySeconds: a.MemorySeconds, VCoreSeconds: a.VCoreSeconds}
+		seen[a.Id] = current
+		if first {
+			continue
+		}
+
+		memoryDelta, vcoreDelta := current.MemorySeconds, current.VCoreSeconds
+		if last, ok := cb.state.Apps[a.Id]; ok {
+			memoryDelta -= last.MemorySeconds
+			vcoreDelta -= last.VCoreSeconds
+		} else if a.StartedTime <= cb.state.Baseline {
+			continue
+		}
+		if memoryDelta <= 0 && vcoreDelta <= 0 {
+			continue
+		}
+		if memoryDelta < 0 {
+			memoryDelta = 0
+		}
+		if vcoreDelta < 0 {
+			vcoreDelta = 0
+		}
+		u := cb.usage(a.Queue, a.User, a.ApplicationType, cb.jobName(a), cb.promotedTags(a), now)
+		u.MemorySeconds += float64(memoryDelta)
+		u.VCoreSeconds += float64(vcoreDelta)
+		u.CostUnits += float64(memoryDelta)*cb.MemoryRate + float64(vcoreDelta)*cb.VCoreRate
+	}
+	cb.state.Apps = seen
+	return nil
+}
+
+func (cb *ChargebackCollector) jobName(a *application) string {
+	if len(cb.Apps.NameRules) == 0 {
+		return ""
+	}
+	return jobName(cb.Apps.NameRules, a.Name)
+}
+
+// promotedTags 只保留提升为标签的 tag
+func (cb *ChargebackCollector) promotedTags(a *application) map[string]string {
+	if len(cb.Apps.Tags.Keys) == 0 {
+		return nil
+	}
+	all := cb.Apps.Tags.parse(a.ApplicationTags)
+	tags := make(map[string]string)
+	for _, key := range cb.Apps.Tags.Keys {
+		if value, ok := all[key]; ok {
+			tags[key] = value
+		}
+	}
+	return tags
+}
+
+// usage 通过 index 按标签值查找用量，没有时新建一行
+func (cb *ChargebackCollector) usage(queue string, user string, applicationType string, jobName string, tags map[string]string, now time.Time) *chargebackUsage {
+	u := &chargebackUsage{Queue: queue, User: user, ApplicationType: applicationType, JobName: jobName, Tags: tags}
+	key := cb.usageKey(u)
+	if existing, ok := cb.index[key]; ok {
+		return existing
+	}
+	u.Created = now.UnixMilli()
+	cb.state.Usage = append(cb.state.Usage, u)
+	cb.index[key] = u
+	return u
+}
+
+func (cb *ChargebackCollector) usageKey(u *chargebackUsage) string {
+	return strings.Join(cb.labelValues(u), "\xff")
+}
+
+func (cb *ChargebackCollector) promoted(key string) bool {
+	for _, k := range cb.Apps.Tags.Keys {
+		if k == key {
+			return true
+		}
+	}
+	return false
+}
+
+func (cb *ChargebackCollector) StateKey() string {
+	return "chargeback"
+}
+
+func (cb *ChargebackCollector) Snapshot() ([]byte, error) {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+	return json.Marshal(&cb.state)
+}
+
+func (cb *ChargebackCollector) Restore(data []byte) error {
+	var state chargebackState
+	if err := json.Unmarshal(data, &state); err != nil {
+		return err
+	}
+	// 旧版本保存的状态没有 created，按恢复时间处理，避免 created 为 1970 年
+	now := time.Now().UnixMilli()
+	for _, u := range state.Usage {
+		if u.Created == 0 {
+			u.Created = now
+		}
+	}
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+	state.Usage, cb.index = cb.merge(state.Usage)
+	cb.state = state
+	return nil
+}
+
+/**
+合并标签值相同的用量并重建 index。保存状态后去掉了某个 tag key 或全部改写规则时，原来不同的几行会得到相同的标签，
+直接输出会因为重复的指标导致整个 scrape 失败，因此累加到最早的一行，created 取最早的时间；
+不再提升为标签的 tag 和不再使用的 job_name 同时从状态中删除
+*/
+
+func (cb *ChargebackCollector) merge(usage []*chargebackUsage) ([]*chargebackUsage, map[string]*chargebackUsage) {
+	merged := make([]*chargebackUsage, 0, len(usage))
+	index := make(map[string]*chargebackUsage, len(usage))
+	for _, u := range usage {
+		for key := range u.Tags {
+			if !cb.promoted(key) {
+				delete(u.Tags, key)
+			}
+		}
+		if len(cb.Apps.NameRules) == 0 {
+			u.JobName = ""
+		}
+		key := cb.usageKey(u)
+		m, ok := index[key]
+		if !ok {
+			index[key] = u
+			merged = append(merged, u)
+			continue
+		}
+		m.MemorySeconds += u.MemorySeconds
+		m.VCoreSeconds += u.VCoreSeconds
+		m.CostUnits += u.CostUnits
+		if u.Created < m.Created {
+			m.Created = u.Created
+		}
+	}
+	return merged, index
+}
+
+func NewChargebackCollector(apps *ApplicationCollector, memoryRate float64, vcoreRate float64) *ChargebackCollector {
+	labels := (&ChargebackCollector{Apps: apps}).labels()
+	return &ChargebackCollector{
+		Apps:           apps,
+		MemoryRate:     memoryRate,
+		VCoreRate:      vcoreRate,
+		state:          chargebackState{Apps: make(map[string]*appUsage)},
+		index:          make(map[string]*chargebackUsage),
+		MemorySeconds:  newFuncMetric("chargeback_memory_seconds_total", "memory seconds consumed by applications :MB", labels, nil),
+		VCoreSeconds:   newFuncMetric("chargeback_v_core_seconds_total", "core seconds consumed by applications", labels, nil),
+		CostUnits:      newFuncMetric("cost_units_total", "cost units of memory and core seconds consumed by applications", labels, nil),
+		ScrapeFailures: newFuncMetric("chargeback_scrape_failures_total", "Number of errors while accumulating chargeback usage", nil, nil),
+	}
+}
@@ -2,19 +2,17 @@ package yarn
 
 import (
 	"encoding/json"
-	"errors"
-	"fmt"
 	"github.com/prometheus/client_golang/prometheus"
-	"io"
 	"log"
-	"net/http"
 	"net/url"
+	"sync"
+	"time"
 )
 
 func (cc *ClusterCollector) labels() []string {
 	var labels []string
 	// 给指标添加公共标签
-	return append(labels)
+	return labels
 }
 
 type Cluster struct {
@@ -47,11 +45,31 @@ type metrics struct {
 	RebootedNodes         int `json:"rebootedNodes"`
 	ActiveNodes           int `json:"activeNodes"`
 	ShutdownNodes         int `json:"shutdownNodes"`
+	// 所有分区的资源合计，包含自定义资源类型
+	TotalUsedResourcesAcrossPartition    resourcesUsed `json:"totalUsedResourcesAcrossPartition"`
+	TotalClusterResourcesAcrossPartition resourcesUsed `json:"totalClusterResourcesAcrossPartition"`
+}
+
+/**
+/ws/v1/cluster/info 的响应，startedOn 用于识别 RM 重启
+*/
+
+type clusterInfoResponse struct {
+	ClusterInfo clusterInfo `json:"clusterInfo"`
+}
+
+type clusterInfo struct {
+	StartedOn int64  `json:"startedOn"`
+	HAState   string `json:"haState"`
 }
 
 type ClusterCollector struct {
+	variants
 	ClusterEndpoint *url.URL
+	InfoEndpoint    *url.URL
 	Up              *prometheus.Desc
+	// RM 启动时间，作为累计指标的 created 时间戳
+	ResourceManagerStartTime *prometheus.Desc
 	// cluster info metrics
 	ApplicationsSubmitted *prometheus.Desc
 	ApplicationsCompleted *prometheus.Desc
@@ -79,11 +97,18 @@ type ClusterCollector struct {
 	NodesActive           *prometheus.Desc
 	NodesShutdown         *prometheus.Desc
 	ScrapeFailures        *prometheus.Desc
-	FailureCount          int
+	// resource types
+	ResourceTotal *prometheus.Desc
+	ResourceUsed  *prometheus.Desc
+	FailureCount  int
+	mu            sync.Mutex
+	created       time.Time
+	startedOn     time.Time
 }
 
 func (cc *ClusterCollector) Describe(ch chan<- *prometheus.Desc) {
 	ch <- cc.Up
+	ch <- cc.ResourceManagerStartTime
 	ch <- cc.ApplicationsSubmitted
 	ch <- cc.ApplicationsCompleted
 	ch <- cc.ApplicationsPending
@@ -110,31 +135,40 @@ func (cc *ClusterCollector) Describe(ch chan<- *prometheus.Desc) {
 	ch <- cc.NodesActive
 	ch <- cc.NodesShutdown
 	ch <- cc.ScrapeFailures
+	ch <- cc.ResourceTotal
+	ch <- cc.ResourceUsed
 }
 
 func (cc *ClusterCollector) Collect(ch chan<- prometheus.Metric) {
 	up := 1.0
 	metrics, err := cc.fetch(cc.ClusterEndpoint)
 	labelValues := make([]string, 0, len(cc.labels()))
-	labelValues = append(labelValues)
+	cc.mu.Lock()
 	if err != nil {
 		up = 0.0
 		cc.FailureCount++
 		log.Println("Error while collecting data from YARN: " + err.Error())
 	}
+	failureCount := cc.FailureCount
+	cc.mu.Unlock()
 	ch <- prometheus.MustNewConstMetric(cc.Up, prometheus.GaugeValue, up, labelValues...)
-	ch <- prometheus.MustNewConstMetric(cc.ScrapeFailures, prometheus.CounterValue, float64(cc.FailureCount), labelValues...)
+	ch <- prometheus.MustNewConstMetricWithCreatedTimestamp(cc.ScrapeFailures, prometheus.CounterValue, float64(failureCount), cc.created, labelValues...)
 
 	if up == 0.0 {
 		return
 	}
 
-	ch <- prometheus.MustNewConstMetric(cc.ApplicationsSubmitted, prometheus.CounterValue, float64(metrics.AppsSubmitted), labelValues...)
-	ch <- prometheus.MustNewConstMetric(cc.ApplicationsCompleted, prometheus.CounterValue, float64(metrics.AppsCompleted), labelValues...)
+	// 应用计数从 RM 启动开始累计，RM 重启后归零，以启动时间作为 created 时间戳让重置可以被识别
+	startedOn := cc.resourceManagerStartTime()
+	if !startedOn.IsZero() {
+		ch <- prometheus.MustNewConstMetric(cc.ResourceManagerStartTime, prometheus.GaugeValue, float64(startedOn.Unix()), labelValues...)
+	}
+	ch <- newCumulativeMetric(cc.ApplicationsSubmitted, prometheus.CounterValue, float64(metrics.AppsSubmitted), startedOn, labelValues...)
+	ch <- newCumulativeMetric(cc.ApplicationsCompleted, prometheus.CounterValue, float64(metrics.AppsCompleted), startedOn, labelValues...)
 	ch <- prometheus.MustNewConstMetric(cc.ApplicationsPending, prometheus.GaugeValue, float64(metrics.AppsPending), labelValues...)
 	ch <- prometheus.MustNewConstMetric(cc.ApplicationsRunning, prometheus.GaugeValue, float64(metrics.AppsRunning), labelValues...)
-	ch <- prometheus.MustNewConstMetric(cc.ApplicationsFailed, prometheus.CounterValue, float64(metrics.AppsFailed), labelValues...)
-	ch <- prometheus.MustNewConstMetric(cc.ApplicationsKilled, prometheus.CounterValue, float64(metrics.AppsKilled), labelValues...)
+	ch <- newCumulativeMetric(cc.ApplicationsFailed, prometheus.CounterValue, float64(metrics.AppsFailed), startedOn, labelValues...)
+	ch <- newCumulativeMetric(cc.ApplicationsKilled, prometheus.CounterValue, float64(metrics.AppsKilled), startedOn, labelValues...)
 	ch <- prometheus.MustNewConstMetric(cc.MemoryReserved, prometheus.GaugeValue, float64(metrics.ReservedMB), labelValues...)
 	ch <- prometheus.MustNewConstMetric(cc.MemoryAvailable, prometheus.GaugeValue, float64(metrics.AvailableMB), labelValues...)
 	ch <- prometheus.MustNewConstMetric(cc.MemoryAllocated, prometheus.GaugeValue, float64(metrics.AllocatedMB), labelValues...)
@@ -154,75 +188,119 @@ func (cc *ClusterCollector) Collect(ch chan<- prometheus.Metric) {
 	ch <- prometheus.MustNewConstMetric(cc.NodesRebooted, prometheus.GaugeValue, float64(metrics.RebootedNodes), labelValues...)
 	ch <- prometheus.MustNewConstMetric(cc.NodesActive, prometheus.GaugeValue, float64(metrics.ActiveNodes), labelValues...)
 	ch <- prometheus.MustNewConstMetric(cc.NodesShutdown, prometheus.GaugeValue, float64(metrics.ShutdownNodes), labelValues...)
+	collectResources(ch, cc.ResourceTotal, metrics.TotalClusterResourcesAcrossPartition, labelValues...)
+	collectResources(ch, cc.ResourceUsed, metrics.TotalUsedResourcesAcrossPartition, labelValues...)
 
 }
 
-func NewClusterCollector(clusterEP *url.URL) *ClusterCollector {
-	labels := new(ClusterCollector).labels()
-	return &ClusterCollector{
-		ClusterEndpoint: clusterEP,
-		Up:              newFuncMetric("up", "Able to contact YARN", labels, nil),
-		// cluster info metrics
-		ApplicationsSubmitted: newFuncMetric("applications_submitted", "Total applications submitted", labels, nil),
-		ApplicationsCompleted: newFuncMetric("applications_completed", "Total applications completed", labels, nil),
-		ApplicationsPending:   newFuncMetric("applications_pending", "Applications pending", labels, nil),
-		ApplicationsRunning:   newFuncMetric("applications_running", "Applications running", labels, nil),
-		ApplicationsFailed:    newFuncMetric("applications_failed", "Total application failed", labels, nil),
-		ApplicationsKilled:    newFuncMetric("applications_killed", "Total application killed", labels, nil),
-		MemoryReserved:        newFuncMetric("memory_reserved", "Memory reserved", labels, nil),
-		MemoryAvailable:       newFuncMetric("memory_available", "Memory available", labels, nil),
-		MemoryAllocated:       newFuncMetric("memory_allocated", "Memory allocated", labels, nil),
-		MemoryTotal:           newFuncMetric("memory_total", "Total memory", labels, nil),
-		VirtualCoresReserved:  newFuncMetric("virtual_cores_reserved", "Virtual cores reserved", labels, nil),
-		VirtualCoresAvailable: newFuncMetric("virtual_cores_available", "Virtual cores available", labels, nil),
-		VirtualCoresAllocated: newFuncMetric("virtual_cores_allocated", "Virtual cores allocated", labels, nil),
-		VirtualCoresTotal:     newFuncMetric("virtual_cores_total", "Total virtual cores", labels, nil),
-		ContainersAllocated:   newFuncMetric("containers_allocated", "Containers allocated", labels, nil),
-		ContainersReserved:    newFuncMetric("containers_reserved", "Containers reserved", labels, nil),
-		ContainersPending:     newFuncMetric("containers_pending", "Containers pending", labels, nil),
-		NodesTotal:            newFuncMetric("nodes_total", "Nodes total", labels, nil),
-		NodesLost:             newFuncMetric("nodes_lost", "Nodes lost", labels, nil),
-		NodesUnhealthy:        newFuncMetric("nodes_unhealthy", "Nodes unhealthy", labels, nil),
-		NodesDecommissioned:   newFuncMetric("nodes_decommissioned", "Nodes decommissioned", labels, nil),
-		NodesDecommissioning:  newFuncMetric("nodes_decommissioning", "Nodes decommissioning", labels, nil),
-		NodesRebooted:         newFuncMetric("nodes_rebooted", "Nodes rebooted", labels, nil),
-		NodesActive:           newFuncMetric("nodes_active", "Nodes active", labels, nil),
-		NodesShutdown:         newFuncMetric("nodes_shutdown", "Nodes shutdown", labels, nil),
-		ScrapeFailures:        newFuncMetric("scrape_failures_total", "Number of errors while scraping YARN metrics", labels, nil),
+/**
+读取 RM 启动时间，启动时间变化说明 RM 重启或发生了主备切换。读取失败时返回零值，累计指标不带 created 时间戳
+*/
+
+func (cc *ClusterCollector) resourceManagerStartTime() time.Time {
+	if cc.InfoEndpoint == nil {
+		return time.Time{}
+	}
+	var r clusterInfoResponse
+	if err := fetchJSON(cc.InfoEndpoint, &r); err != nil {
+		log.Println("Error while collecting cluster info from YARN: " + err.Error())
+		return time.Time{}
+	}
+	if r.ClusterInfo.StartedOn == 0 {
+		return time.Time{}
+	}
+	startedOn := time.UnixMilli(r.ClusterInfo.StartedOn)
+
+	cc.mu.Lock()
+	defer cc.mu.Unlock()
+	if !cc.startedOn.IsZero() && !cc.startedOn.Equal(startedOn) {
+		log.Printf("ResourceManager restarted at %s (%s), cumulative metrics are reset", startedOn.Format(time.RFC3339), r.ClusterInfo.HAState)
 	}
+	cc.startedOn = startedOn
+	return startedOn
 }
 
-func (cc *ClusterCollector) fetch(u *url.URL) (*metrics, error) {
-	req := http.Request{
-		Method:     "GET",
-		URL:        u,
-		Proto:      "HTTP/1.1",
-		ProtoMajor: 1,
-		ProtoMinor: 1,
-		Header:     make(http.Header),
-		Host:       u.Host,
+/**
+需要持久化的状态
+*/
+
+type clusterState struct {
+	FailureCount int   `json:"failureCount"`
+	Created      int64 `json:"created"`
+}
+
+func (cc *ClusterCollector) StateKey() string {
+	return "cluster"
+}
+
+func (cc *ClusterCollector) Snapshot() ([]byte, error) {
+	cc.mu.Lock()
+	defer cc.mu.Unlock()
+	return json.Marshal(&clusterState{FailureCount: cc.FailureCount, Created: cc.created.UnixMilli()})
+}
+
+func (cc *ClusterCollector) Restore(data []byte) error {
+	var state clusterState
+	if err := json.Unmarshal(data, &state); err != nil {
+		return err
 	}
-	resp, err := http.DefaultClient.Do(&req)
-	if err != nil {
-		return nil, err
+	cc.mu.Lock()
+	defer cc.mu.Unlock()
+	cc.FailureCount = state.FailureCount
+	// 旧版本保存的状态没有 created，沿用进程启动时间
+	if state.Created > 0 {
+		cc.created = time.UnixMilli(state.Created)
 	}
+	return nil
+}
 
-	defer func(Body io.ReadCloser) {
-		err := Body.Close()
-		if err != nil {
-			log.Fatal("response body error: " + err.Error())
-		}
-	}(resp.Body)
-
-	if resp.StatusCode != 200 {
-		return nil, errors.New(fmt.Sprintf("unexpected HTTP status: %v", resp.StatusCode))
+func NewClusterCollector(clusterEP *url.URL, infoEP *url.URL) *ClusterCollector {
+	labels := new(ClusterCollector).labels()
+	vs := make(variants)
+	return &ClusterCollector{
+		variants:                 vs,
+		ClusterEndpoint:          clusterEP,
+		InfoEndpoint:             infoEP,
+		created:                  time.Now(),
+		Up:                       vs.newFuncMetric("up", "Able to contact YARN", labels, nil),
+		ResourceManagerStartTime: vs.newFuncMetric("resourcemanager_start_time_seconds", "Start time of the active ResourceManager, in unix seconds", labels, nil),
+		// cluster info metrics
+		ApplicationsSubmitted: vs.newFuncMetric("applications_submitted", "Total applications submitted", labels, nil),
+		ApplicationsCompleted: vs.newFuncMetric("applications_completed", "Total applications completed", labels, nil),
+		ApplicationsPending:   vs.newFuncMetric("applications_pending", "Applications pending", labels, nil),
+		ApplicationsRunning:   vs.newFuncMetric("applications_running", "Applications running", labels, nil),
+		ApplicationsFailed:    vs.newFuncMetric("applications_failed", "Total application failed", labels, nil),
+		ApplicationsKilled:    vs.newFuncMetric("applications_killed", "Total application killed", labels, nil),
+		MemoryReserved:        vs.newFuncMetric("memory_reserved", "Memory reserved", labels, nil),
+		MemoryAvailable:       vs.newFuncMetric("memory_available", "Memory available", labels, nil),
+		MemoryAllocated:       vs.newFuncMetric("memory_allocated", "Memory allocated", labels, nil),
+		MemoryTotal:           vs.newFuncMetric("memory_total", "Total memory", labels, nil),
+		VirtualCoresReserved:  vs.newFuncMetric("virtual_cores_reserved", "Virtual cores reserved", labels, nil),
+		VirtualCoresAvailable: vs.newFuncMetric("virtual_cores_available", "Virtual cores available", labels, nil),
+		VirtualCoresAllocated: vs.newFuncMetric("virtual_cores_allocated", "Virtual cores allocated", labels, nil),
+		VirtualCoresTotal:     vs.newFuncMetric("virtual_cores_total", "Total virtual cores", labels, nil),
+		ContainersAllocated:   vs.newFuncMetric("containers_allocated", "Containers allocated", labels, nil),
+		ContainersReserved:    vs.newFuncMetric("containers_reserved", "Containers reserved", labels, nil),
+		ContainersPending:     vs.newFuncMetric("containers_pending", "Containers pending", labels, nil),
+		NodesTotal:            vs.newFuncMetric("nodes_total", "Nodes total", labels, nil),
+		NodesLost:             vs.newFuncMetric("nodes_lost", "Nodes lost", labels, nil),
+		NodesUnhealthy:        vs.newFuncMetric("nodes_unhealthy", "Nodes unhealthy", labels, nil),
+		NodesDecommissioned:   vs.newFuncMetric("nodes_decommissioned", "Nodes decommissioned", labels, nil),
+		NodesDecommissioning:  vs.newFuncMetric("nodes_decommissioning", "Nodes decommissioning", labels, nil),
+		NodesRebooted:         vs.newFuncMetric("nodes_rebooted", "Nodes rebooted", labels, nil),
+		NodesActive:           vs.newFuncMetric("nodes_active", "Nodes active", labels, nil),
+		NodesShutdown:         vs.newFuncMetric("nodes_shutdown", "Nodes shutdown", labels, nil),
+		ScrapeFailures:        vs.newFuncMetric("scrape_failures_total", "Number of errors while scraping YARN metrics", labels, nil),
+		// resource types
+		ResourceTotal: vs.newFuncMetric("cluster_total_resource", "Total cluster resource per resource type", resourceLabels(labels), nil),
+		ResourceUsed:  vs.newFuncMetric("cluster_used_resource", "Used cluster resource per resource type", resourceLabels(labels), nil),
 	}
+}
 
+func (cc *ClusterCollector) fetch(u *url.URL) (*metrics, error) {
 	var c Cluster
-	err = json.NewDecoder(resp.Body).Decode(&c)
-	if err != nil {
+	if err := fetchJSON(u, &c); err != nil {
 		return nil, err
 	}
-
 	return &c.ClusterMetrics, nil
 }
@@ -1,11 +1,143 @@
 package yarn
 
 import (
+	"encoding/json"
+	"errors"
+	"fmt"
 	"github.com/prometheus/client_golang/prometheus"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
 )
 
 const metricsNamespace = "yarn"
 
+/**
+ConstLabels 会加到所有 collector 创建的指标上，例如 env、datacenter、cluster，需要在创建 collector 之前设置
+*/
+
+var ConstLabels prometheus.Labels
+
+// withConstLabels 合并 ConstLabels 和指标自身的常量标签
+func withConstLabels(labels prometheus.Labels) prometheus.Labels {
+	if len(ConstLabels) == 0 {
+		return labels
+	}
+	merged := make(prometheus.Labels, len(ConstLabels)+len(labels))
+	for k, v := range ConstLabels {
+		merged[k] = v
+	}
+	for k, v := range labels {
+		merged[k] = v
+	}
+	return merged
+}
+
 func newFuncMetric(metricName string, docString string, variableLabels []string, constLabels prometheus.Labels) *prometheus.Desc {
-	return prometheus.NewDesc(prometheus.BuildFQName(metricsNamespace, "", metricName), docString, variableLabels, constLabels)
+	return prometheus.NewDesc(prometheus.BuildFQName(metricsNamespace, "", metricName), docString, variableLabels, withConstLabels(constLabels))
+}
+
+/**
+创建累计指标，created 不为零时带上 created 时间戳，便于识别计数重置
+*/
+
+func newCounterMetric(desc *prometheus.Desc, value float64, created time.Time, labelValues ...string) prometheus.Metric {
+	if created.IsZero() {
+		return prometheus.MustNewConstMetric(desc, prometheus.CounterValue, value, labelValues...)
+	}
+	return prometheus.MustNewConstMetricWithCreatedTimestamp(desc, prometheus.CounterValue, value, created, labelValues...)
+}
+
+/**
+v1 名称的累计值保持最初的类型：集群的应用计数是 counter，应用的 memory_seconds、v_core_seconds 是 gauge，
+都不带 created，避免改变已有用户看到的指标。cumulativeMetric 额外记录 created，换算为 v2 的 _total counter 时使用
+*/
+
+type cumulativeMetric struct {
+	prometheus.Metric
+	created time.Time
+}
+
+func newCumulativeMetric(desc *prometheus.Desc, valueType prometheus.ValueType, value float64, created time.Time, labelValues ...string) prometheus.Metric {
+	m := prometheus.MustNewConstMetric(desc, valueType, value, labelValues...)
+	if created.IsZero() {
+		return m
+	}
+	return &cumulativeMetric{Metric: m, created: created}
+}
+
+/**
+HTTPClient 用于请求所有数据源，Timeout 避免一个无响应的数据源让采集一直阻塞
+*/
+
+var HTTPClient = &http.Client{Timeout: 30 * time.Second}
+
+/**
+FetchHook 不为空时，每次请求数据源后都会以原始响应体和错误调用，
+dump 子命令用它打印原始响应并判断是否有采集失败
+*/
+
+var FetchHook func(u *url.URL, body []byte, err error)
+
+/**
+请求数据源，并将响应体解析到 v 中
+*/
+
+func fetchJSON(u *url.URL, v interface{}) error {
+	body, err := fetchBody(u)
+	if err == nil {
+		err = json.Unmarshal(body, v)
+	}
+	if FetchHook != nil {
+		FetchHook(u, body, err)
+	}
+	return err
+}
+
+func fetchBody(u *url.URL) ([]byte, error) {
+	req := http.Request{
+		Method:     "GET",
+		URL:        u,
+		Proto:      "HTTP/1.1",
+		ProtoMajor: 1,
+		ProtoMinor: 1,
+		Header:     make(http.Header),
+		Host:       u.Host,
+	}
+	req.Header.Set("Accept", "application/json")
+	resp, err := HTTPClient.Do(&req)
+	if err != nil {
+		return nil, err
+	}
+
+	defer func(Body io.ReadCloser) {
+		err := Body.Close()
+		if err != nil {
+			log.Println("response body error: " + err.Error())
+		}
+	}(resp.Body)
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != 200 {
+		return body, errors.New(fmt.Sprintf("unexpected HTTP status: %v", resp.StatusCode))
+	}
+
+	return body, nil
+}
+
+/**
+在 u 的路径后追加 path，并去掉查询参数
+*/
+
+func joinPath(u *url.URL, path string) *url.URL {
+	endpoint := *u
+	endpoint.Path = strings.TrimSuffix(endpoint.Path, "/") + "/" + path
+	endpoint.RawQuery = ""
+	return &endpoint
 }
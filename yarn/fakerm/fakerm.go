@@ -0,0 +1,790 @@
+/**
+fakerm 模拟一个使用 Capacity Scheduler 的 ResourceManager，提供 /ws/v1/cluster 下的
+info、metrics、apps、scheduler、nodes 和 get-node-labels 接口，以及 /jmx 中的 ClusterMetrics、
+QueueMetrics 和 JvmMetrics，用于在没有 Hadoop 的环境中测试和演示。
+
+集群状态由 Step 推进：应用不断提交、排队、运行和结束，节点偶尔变为 UNHEALTHY 再恢复，
+队列在负载高时被占满。相同的 seed 产生相同的状态序列。
+*/
+
+package fakerm
+
+import (
+	"encoding/json"
+	"fmt"
+	"math/rand"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	nodeMemoryMB      = 16384
+	nodeVCores        = 8
+	containerMemoryMB = 2048
+	containerVCores   = 1
+	// 保留的已结束应用数量
+	finishedAppsLimit = 100
+)
+
+var (
+	users     = []string{"alice", "bob", "carol", "dave"}
+	appNames  = []string{"daily-etl", "hourly-aggregation", "adhoc-query", "model-training", "report-export"}
+	appTypes  = []string{"SPARK", "MAPREDUCE", "TEZ"}
+	teams     = []string{"data", "ml", "bi"}
+	finalRoll = []string{"SUCCEEDED", "SUCCEEDED", "SUCCEEDED", "SUCCEEDED", "SUCCEEDED", "SUCCEEDED", "SUCCEEDED", "SUCCEEDED", "FAILED", "KILLED"}
+)
+
+type node struct {
+	id               int
+	state            string
+	lastHealthUpdate time.Time
+	usedMB           int
+	usedVCores       int
+	containers       int
+}
+
+type queue struct {
+	name        string
+	capacity    float64
+	maxCapacity float64
+}
+
+type app struct {
+	seq           int
+	user          string
+	name          string
+	queue         *queue
+	appType       string
+	tags          string
+	state         string
+	finalStatus   string
+	started       time.Time
+	finished      time.Time
+	wanted        int
+	remaining     int
+	containers    map[int]int
+	memorySeconds float64
+	vcoreSeconds  float64
+}
+
+type Cluster struct {
+	mu        sync.Mutex
+	rand      *rand.Rand
+	startedOn time.Time
+	now       time.Time
+	nodes     []*node
+	queues    []*queue
+	apps      []*app
+	nextApp   int
+	submitted int
+	completed int
+	failed    int
+	killed    int
+}
+
+/**
+New 创建一个包含 nodes 个节点的集群，queues 为叶子队列名称，容量平均分配，最大容量为两倍容量
+*/
+
+func New(seed int64, nodes int, queues ...string) *Cluster {
+	if len(queues) == 0 {
+		queues = []string{"default"}
+	}
+	now := time.Now()
+	c := &Cluster{
+		rand:      rand.New(rand.NewSource(seed)),
+		startedOn: now,
+		now:       now,
+		nextApp:   1,
+	}
+	for i := 0; i < nodes; i++ {
+		c.nodes = append(c.nodes, &node{id: i + 1, state: "RUNNING", lastHealthUpdate: now})
+	}
+	capacity := 100 / float64(len(queues))
+	for _, name := range queues {
+		maxCapacity := capacity * 2
+		if maxCapacity > 100 {
+			maxCapacity = 100
+		}
+		c.queues = append(c.queues, &queue{name: name, capacity: capacity, maxCapacity: maxCapacity})
+	}
+	return c
+}
+
+/**
+Step 把集群推进到 now：结算运行中应用的资源用量，结束到期的应用，变更节点健康状态，提交新应用并分配容器
+*/
+
+func (c *Cluster) Step(now time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	elapsed := now.Sub(c.now).Seconds()
+	if elapsed < 0 {
+		elapsed = 0
+	}
+	c.now = now
+
+	for _, a := range c.apps {
+		if a.state != "RUNNING" {
+			continue
+		}
+		n := a.allocated()
+		a.memorySeconds += float64(n*containerMemoryMB) * elapsed
+		a.vcoreSeconds += float64(n*containerVCores) * elapsed
+		a.remaining--
+		if a.remaining <= 0 {
+			c.finish(a, finalRoll[c.rand.Intn(len(finalRoll))])
+		}
+	}
+
+	for _, n := range c.nodes {
+		switch {
+		case n.state == "RUNNING" && c.rand.Float64() < 0.02:
+			n.state = "UNHEALTHY"
+			n.lastHealthUpdate = now
+			c.evict(n)
+		case n.state == "UNHEALTHY" && c.rand.Float64() < 0.3:
+			n.state = "RUNNING"
+			n.lastHealthUpdate = now
+		}
+	}
+
+	// 提交速度有波动，高峰时队列会被占满
+	for i := c.rand.Intn(4); i > 0; i-- {
+		c.submit()
+	}
+	c.schedule()
+	c.prune()
+}
+
+/**
+Run 每隔 interval 调用一次 Step，直到 stop 关闭
+*/
+
+func (c *Cluster) Run(interval time.Duration, stop <-chan struct{}) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stop:
+			return
+		case now := <-ticker.C:
+			c.Step(now)
+		}
+	}
+}
+
+func (c *Cluster) submit() {
+	team := teams[c.rand.Intn(len(teams))]
+	name := appNames[c.rand.Intn(len(appNames))]
+	a := &app{
+		seq:        c.nextApp,
+		user:       users[c.rand.Intn(len(users))],
+		name:       name,
+		queue:      c.queues[c.rand.Intn(len(c.queues))],
+		appType:    appTypes[c.rand.Intn(len(appTypes))],
+		tags:       "team:" + team + ",pipeline:" + name,
+		state:      "ACCEPTED",
+		started:    c.now,
+		wanted:     1 + c.rand.Intn(8),
+		remaining:  3 + c.rand.Intn(18),
+		containers: map[int]int{},
+	}
+	c.nextApp++
+	c.submitted++
+	c.apps = append(c.apps, a)
+}
+
+func (c *Cluster) finish(a *app, finalStatus string) {
+	for id, n := range a.containers {
+		c.release(c.nodes[id-1], n)
+	}
+	a.containers = map[int]int{}
+	a.finished = c.now
+	a.finalStatus = finalStatus
+	switch finalStatus {
+	case "FAILED":
+		a.state = "FAILED"
+		c.failed++
+	case "KILLED":
+		a.state = "KILLED"
+		c.killed++
+	default:
+		a.state = "FINISHED"
+	}
+	c.completed++
+}
+
+// evict 释放不健康节点上的所有容器，对应应用会重新申请
+func (c *Cluster) evict(n *node) {
+	for _, a := range c.apps {
+		if count, ok := a.containers[n.id]; ok {
+			c.release(n, count)
+			delete(a.containers, n.id)
+		}
+	}
+}
+
+func (c *Cluster) release(n *node, count int) {
+	n.containers -= count
+	n.usedMB -= count * containerMemoryMB
+	n.usedVCores -= count * containerVCores
+}
+
+// schedule 按提交顺序为应用分配容器，队列已用资源不超过最大容量
+func (c *Cluster) schedule() {
+	total := c.healthyNodes() * nodeMemoryMB
+	for _, a := range c.apps {
+		if a.state != "ACCEPTED" && a.state != "RUNNING" {
+			continue
+		}
+		limit := int(float64(total) * a.queue.maxCapacity / 100)
+		for a.allocated() < a.wanted && c.queueUsedMB(a.queue)+containerMemoryMB <= limit {
+			n := c.freeNode()
+			if n == nil {
+				return
+			}
+			n.containers++
+			n.usedMB += containerMemoryMB
+			n.usedVCores += containerVCores
+			a.containers[n.id]++
+		}
+		if a.state == "ACCEPTED" && a.allocated() > 0 {
+			a.state = "RUNNING"
+		}
+	}
+}
+
+func (c *Cluster) freeNode() *node {
+	for _, n := range c.nodes {
+		if n.state == "RUNNING" && n.usedMB+containerMemoryMB <= nodeMemoryMB && n.usedVCores+containerVCores <= nodeVCores {
+			return n
+		}
+	}
+	return nil
+}
+
+func (c *Cluster) prune() {
+	finished := 0
+	for i := len(c.apps) - 1; i >= 0; i-- {
+		if c.apps[i].finished.IsZero() {
+			continue
+		}
+		finished++
+		if finished > finishedAppsLimit {
+			c.apps = append(c.apps[:i], c.apps[i+1:]...)
+		}
+	}
+}
+
+func (a *app) allocated() int {
+	n := 0
+	for _, count := range a.containers {
+		n += count
+	}
+	return n
+}
+
+func (c *Cluster) healthyNodes() int {
+	n := 0
+	for _, node := range c.nodes {
+		if node.state == "RUNNING" {
+			n++
+		}
+	}
+	return n
+}
+
+func (c *Cluster) queueUsedMB(q *queue) int {
+	used := 0
+	for _, a := range c.apps {
+		if a.queue == q {
+			used += a.allocated() * containerMemoryMB
+		}
+	}
+	return used
+}
+
+func (c *Cluster) appId(a *app) string {
+	return fmt.Sprintf("application_%d_%04d", c.startedOn.UnixMilli(), a.seq)
+}
+
+/**
+ServeHTTP 提供 ResourceManager REST API 的子集，其余路径返回 404
+*/
+
+func (c *Cluster) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	var body interface{}
+	switch strings.TrimSuffix(r.URL.Path, "/") {
+	case "/ws/v1/cluster", "/ws/v1/cluster/info":
+		body = c.info()
+	case "/ws/v1/cluster/metrics":
+		body = c.metrics()
+	case "/ws/v1/cluster/apps":
+		body = c.applications(r.URL.Query().Get("states"))
+	case "/ws/v1/cluster/scheduler":
+		body = c.scheduler()
+	case "/ws/v1/cluster/nodes":
+		body = c.nodeList()
+	case "/ws/v1/cluster/get-node-labels":
+		// 模拟集群只有默认分区
+		body = map[string]interface{}{"nodeLabelInfo": []interface{}{}}
+	case "/jmx":
+		body = c.jmx()
+	default:
+		http.NotFound(w, r)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(body)
+}
+
+type resource struct {
+	Memory               int `json:"memory"`
+	VCores               int `json:"vCores"`
+	ResourceInformations struct {
+		ResourceInformation []*resourceInformation `json:"resourceInformation"`
+	} `json:"resourceInformations"`
+}
+
+type resourceInformation struct {
+	Name         string `json:"name"`
+	ResourceType string `json:"resourceType"`
+	Units        string `json:"units"`
+	Value        int    `json:"value"`
+}
+
+// newResource 按 Hadoop 3 的格式同时返回 memory、vCores 和 resourceInformations
+func newResource(memory int, vcores int) resource {
+	r := resource{Memory: memory, VCores: vcores}
+	r.ResourceInformations.ResourceInformation = []*resourceInformation{
+		{Name: "memory-mb", ResourceType: "COUNTABLE", Units: "Mi", Value: memory},
+		{Name: "vcores", ResourceType: "COUNTABLE", Value: vcores},
+	}
+	return r
+}
+
+func (c *Cluster) info() interface{} {
+	return map[string]interface{}{
+		"clusterInfo": map[string]interface{}{
+			"id":                     c.startedOn.UnixMilli(),
+			"startedOn":              c.startedOn.UnixMilli(),
+			"state":                  "STARTED",
+			"haState":                "ACTIVE",
+			"resourceManagerVersion": "3.3.6-fakerm",
+			"hadoopVersion":          "3.3.6-fakerm",
+		},
+	}
+}
+
+func (c *Cluster) metrics() interface{} {
+	m := map[string]interface{}{
+		"appsSubmitted": c.submitted,
+		"appsCompleted": c.completed,
+		"appsFailed":    c.failed,
+		"appsKilled":    c.killed,
+		"totalNodes":    len(c.nodes),
+	}
+	counts := map[string]int{}
+	for _, a := range c.apps {
+		switch a.state {
+		case "ACCEPTED":
+			counts["appsPending"]++
+			counts["containersPending"] += a.wanted
+		case "RUNNING":
+			counts["appsRunning"]++
+			counts["containersPending"] += a.wanted - a.allocated()
+		}
+	}
+	for _, n := range c.nodes {
+		if n.state == "RUNNING" {
+			counts["activeNodes"]++
+			counts["totalMB"] += nodeMemoryMB
+			counts["totalVirtualCores"] += nodeVCores
+			counts["availableMB"] += nodeMemoryMB - n.usedMB
+			counts["availableVirtualCores"] += nodeVCores - n.usedVCores
+		} else {
+			counts["unhealthyNodes"]++
+		}
+		counts["allocatedMB"] += n.usedMB
+		counts["allocatedVirtualCores"] += n.usedVCores
+		counts["containersAllocated"] += n.containers
+	}
+	for k, v := range counts {
+		m[k] = v
+	}
+	m["totalUsedResourcesAcrossPartition"] = newResource(counts["allocatedMB"], counts["allocatedVirtualCores"])
+	m["totalClusterResourcesAcrossPartition"] = newResource(counts["totalMB"], counts["totalVirtualCores"])
+	return map[string]interface{}{"clusterMetrics": m}
+}
+
+type application struct {
+	Id                     string  `json:"id"`
+	User                   string  `json:"user"`
+	Name                   string  `json:"name"`
+	Queue                  string  `json:"queue"`
+	State                  string  `json:"state"`
+	FinalStatus            string  `json:"finalStatus"`
+	ApplicationType        string  `json:"applicationType"`
+	ApplicationTags        string  `json:"applicationTags"`
+	TrackingUrl            string  `json:"trackingUrl"`
+	StartedTime            int64   `json:"startedTime"`
+	FinishedTime           int64   `json:"finishedTime"`
+	ElapsedTime            int64   `json:"elapsedTime"`
+	AllocatedMB            int     `json:"allocatedMB"`
+	AllocatedVCores        int     `json:"allocatedVCores"`
+	RunningContainers      int     `json:"runningContainers"`
+	MemorySeconds          int64   `json:"memorySeconds"`
+	VcoreSeconds           int64   `json:"vcoreSeconds"`
+	QueueUsagePercentage   float64 `json:"queueUsagePercentage"`
+	ClusterUsagePercentage float64 `json:"clusterUsagePercentage"`
+}
+
+func (c *Cluster) applications(states string) interface{} {
+	filter := map[string]bool{}
+	for _, s := range strings.Split(states, ",") {
+		if s != "" {
+			filter[strings.ToUpper(s)] = true
+		}
+	}
+
+	total := float64(c.healthyNodes() * nodeMemoryMB)
+	list := []*application{}
+	for _, a := range c.apps {
+		if len(filter) > 0 && !filter[a.state] {
+			continue
+		}
+		end := c.now
+		if !a.finished.IsZero() {
+			end = a.finished
+		}
+		finalStatus := a.finalStatus
+		if finalStatus == "" {
+			finalStatus = "UNDEFINED"
+		}
+		id := c.appId(a)
+		app := &application{
+			Id:              id,
+			User:            a.user,
+			Name:            a.name,
+			Queue:           a.queue.name,
+			State:           a.state,
+			FinalStatus:     finalStatus,
+			ApplicationType: a.appType,
+			ApplicationTags: a.tags,
+			TrackingUrl:     "http://fakerm:8088/proxy/" + id + "/",
+			StartedTime:     a.started.UnixMilli(),
+			ElapsedTime:     end.Sub(a.started).Milliseconds(),
+			MemorySeconds:   int64(a.memorySeconds),
+			VcoreSeconds:    int64(a.vcoreSeconds),
+		}
+		if !a.finished.IsZero() {
+			app.FinishedTime = a.finished.UnixMilli()
+		}
+		if a.state == "RUNNING" {
+			n := a.allocated()
+			app.AllocatedMB = n * containerMemoryMB
+			app.AllocatedVCores = n * containerVCores
+			app.RunningContainers = n
+			if total > 0 {
+				app.ClusterUsagePercentage = float64(app.AllocatedMB) / total * 100
+				app.QueueUsagePercentage = app.ClusterUsagePercentage / a.queue.capacity * 100
+			}
+		} else if !a.finished.IsZero() {
+			app.AllocatedMB, app.AllocatedVCores, app.RunningContainers = -1, -1, -1
+		}
+		list = append(list, app)
+	}
+	return map[string]interface{}{"apps": map[string]interface{}{"app": list}}
+}
+
+type queueUser struct {
+	Username               string   `json:"username"`
+	ResourcesUsed          resource `json:"resourcesUsed"`
+	AMResourceUsed         resource `json:"AMResourceUsed"`
+	UserResourceLimit      resource `json:"userResourceLimit"`
+	NumActiveApplications  int      `json:"numActiveApplications"`
+	NumPendingApplications int      `json:"numPendingApplications"`
+}
+
+type partitionCapacities struct {
+	PartitionName        string  `json:"partitionName"`
+	Capacity             float64 `json:"capacity"`
+	UsedCapacity         float64 `json:"usedCapacity"`
+	MaxCapacity          float64 `json:"maxCapacity"`
+	AbsoluteCapacity     float64 `json:"absoluteCapacity"`
+	AbsoluteUsedCapacity float64 `json:"absoluteUsedCapacity"`
+	AbsoluteMaxCapacity  float64 `json:"absoluteMaxCapacity"`
+}
+
+type partitionResourceUsage struct {
+	PartitionName string   `json:"partitionName"`
+	Used          resource `json:"used"`
+	Reserved      resource `json:"reserved"`
+}
+
+type leafQueue struct {
+	Type                   string   `json:"type"`
+	QueueName              string   `json:"queueName"`
+	State                  string   `json:"state"`
+	Capacity               float64  `json:"capacity"`
+	UsedCapacity           float64  `json:"usedCapacity"`
+	MaxCapacity            float64  `json:"maxCapacity"`
+	AbsoluteCapacity       float64  `json:"absoluteCapacity"`
+	AbsoluteUsedCapacity   float64  `json:"absoluteUsedCapacity"`
+	AbsoluteMaxCapacity    float64  `json:"absoluteMaxCapacity"`
+	NumApplications        int      `json:"numApplications"`
+	NumActiveApplications  int      `json:"numActiveApplications"`
+	NumPendingApplications int      `json:"numPendingApplications"`
+	NumContainers          int      `json:"numContainers"`
+	MaxApplications        int      `json:"maxApplications"`
+	MaxApplicationsPerUser int      `json:"maxApplicationsPerUser"`
+	PreemptionDisabled     bool     `json:"preemptionDisabled"`
+	PendingContainers      int      `json:"pendingContainers"`
+	ReservedContainers     int      `json:"reservedContainers"`
+	ResourcesUsed          resource `json:"resourcesUsed"`
+	AMResourceLimit        resource `json:"AMResourceLimit"`
+	UsedAMResource         resource `json:"usedAMResource"`
+	Users                  struct {
+		User []*queueUser `json:"user"`
+	} `json:"users"`
+	Capacities struct {
+		QueueCapacitiesByPartition []*partitionCapacities `json:"queueCapacitiesByPartition"`
+	} `json:"capacities"`
+	Resources struct {
+		ResourceUsagesByPartition []*partitionResourceUsage `json:"resourceUsagesByPartition"`
+	} `json:"resources"`
+}
+
+func (c *Cluster) scheduler() interface{} {
+	totalMB := c.healthyNodes() * nodeMemoryMB
+	totalVCores := c.healthyNodes() * nodeVCores
+	rootUsed := 0
+	queues := []*leafQueue{}
+	for _, q := range c.queues {
+		capacityMB := float64(totalMB) * q.capacity / 100
+		lq := &leafQueue{
+			Type:                   "capacitySchedulerLeafQueueInfo",
+			QueueName:              q.name,
+			State:                  "RUNNING",
+			Capacity:               q.capacity,
+			MaxCapacity:            q.maxCapacity,
+			AbsoluteCapacity:       q.capacity,
+			AbsoluteMaxCapacity:    q.maxCapacity,
+			MaxApplications:        10000,
+			MaxApplicationsPerUser: 10000,
+			PreemptionDisabled:     true,
+			AMResourceLimit:        resource{Memory: int(capacityMB / 10), VCores: int(float64(totalVCores) * q.capacity / 1000)},
+		}
+		byUser := map[string]*queueUser{}
+		for _, a := range c.apps {
+			if a.queue != q || (a.state != "ACCEPTED" && a.state != "RUNNING") {
+				continue
+			}
+			u := byUser[a.user]
+			if u == nil {
+				u = &queueUser{
+					Username:          a.user,
+					UserResourceLimit: resource{Memory: int(float64(totalMB) * q.maxCapacity / 100), VCores: int(float64(totalVCores) * q.maxCapacity / 100)},
+				}
+				byUser[a.user] = u
+				lq.Users.User = append(lq.Users.User, u)
+			}
+			n := a.allocated()
+			lq.NumApplications++
+			if a.state == "RUNNING" {
+				lq.NumActiveApplications++
+				u.NumActiveApplications++
+				lq.UsedAMResource.Memory += containerMemoryMB
+				lq.UsedAMResource.VCores += containerVCores
+				u.AMResourceUsed.Memory += containerMemoryMB
+				u.AMResourceUsed.VCores += containerVCores
+			} else {
+				lq.NumPendingApplications++
+				u.NumPendingApplications++
+			}
+			lq.NumContainers += n
+			lq.PendingContainers += a.wanted - n
+			lq.ResourcesUsed.Memory += n * containerMemoryMB
+			lq.ResourcesUsed.VCores += n * containerVCores
+			u.ResourcesUsed.Memory += n * containerMemoryMB
+			u.ResourcesUsed.VCores += n * containerVCores
+		}
+		sort.Slice(lq.Users.User, func(i, j int) bool { return lq.Users.User[i].Username < lq.Users.User[j].Username })
+		if capacityMB > 0 {
+			lq.UsedCapacity = float64(lq.ResourcesUsed.Memory) / capacityMB * 100
+		}
+		if totalMB > 0 {
+			lq.AbsoluteUsedCapacity = float64(lq.ResourcesUsed.Memory) / float64(totalMB) * 100
+		}
+		// 模拟集群只有默认分区，分区指标与队列指标相同
+		lq.ResourcesUsed = newResource(lq.ResourcesUsed.Memory, lq.ResourcesUsed.VCores)
+		for _, u := range lq.Users.User {
+			u.ResourcesUsed = newResource(u.ResourcesUsed.Memory, u.ResourcesUsed.VCores)
+		}
+		lq.Capacities.QueueCapacitiesByPartition = []*partitionCapacities{{
+			Capacity:             lq.Capacity,
+			UsedCapacity:         lq.UsedCapacity,
+			MaxCapacity:          lq.MaxCapacity,
+			AbsoluteCapacity:     lq.AbsoluteCapacity,
+			AbsoluteUsedCapacity: lq.AbsoluteUsedCapacity,
+			AbsoluteMaxCapacity:  lq.AbsoluteMaxCapacity,
+		}}
+		lq.Resources.ResourceUsagesByPartition = []*partitionResourceUsage{{
+			Used:     lq.ResourcesUsed,
+			Reserved: newResource(0, 0),
+		}}
+		rootUsed += lq.ResourcesUsed.Memory
+		queues = append(queues, lq)
+	}
+
+	usedCapacity := 0.0
+	if totalMB > 0 {
+		usedCapacity = float64(rootUsed) / float64(totalMB) * 100
+	}
+	return map[string]interface{}{
+		"scheduler": map[string]interface{}{
+			"schedulerInfo": map[string]interface{}{
+				"type":         "capacityScheduler",
+				"queueName":    "root",
+				"capacity":     100.0,
+				"maxCapacity":  100.0,
+				"usedCapacity": usedCapacity,
+				"queues":       map[string]interface{}{"queue": queues},
+			},
+		},
+	}
+}
+
+type nodeInfo struct {
+	Id                    string   `json:"id"`
+	Rack                  string   `json:"rack"`
+	State                 string   `json:"state"`
+	NodeHostName          string   `json:"nodeHostName"`
+	NodeHTTPAddress       string   `json:"nodeHTTPAddress"`
+	HealthReport          string   `json:"healthReport"`
+	Version               string   `json:"version"`
+	LastHealthUpdate      int64    `json:"lastHealthUpdate"`
+	NumContainers         int      `json:"numContainers"`
+	UsedMemoryMB          int      `json:"usedMemoryMB"`
+	AvailMemoryMB         int      `json:"availMemoryMB"`
+	UsedVirtualCores      int      `json:"usedVirtualCores"`
+	AvailableVirtualCores int      `json:"availableVirtualCores"`
+	TotalResource         resource `json:"totalResource"`
+	UsedResource          resource `json:"usedResource"`
+	AvailableResource     resource `json:"availableResource"`
+}
+
+func (c *Cluster) nodeList() interface{} {
+	list := []*nodeInfo{}
+	for _, n := range c.nodes {
+		host := fmt.Sprintf("worker-%d", n.id)
+		info := &nodeInfo{
+			Id:                    host + ":45454",
+			Rack:                  fmt.Sprintf("/rack-%d", (n.id-1)/4+1),
+			State:                 n.state,
+			NodeHostName:          host,
+			NodeHTTPAddress:       host + ":8042",
+			Version:               "3.3.6-fakerm",
+			LastHealthUpdate:      n.lastHealthUpdate.UnixMilli(),
+			NumContainers:         n.containers,
+			UsedMemoryMB:          n.usedMB,
+			AvailMemoryMB:         nodeMemoryMB - n.usedMB,
+			UsedVirtualCores:      n.usedVCores,
+			AvailableVirtualCores: nodeVCores - n.usedVCores,
+			TotalResource:         newResource(nodeMemoryMB, nodeVCores),
+			UsedResource:          newResource(n.usedMB, n.usedVCores),
+			AvailableResource:     newResource(nodeMemoryMB-n.usedMB, nodeVCores-n.usedVCores),
+		}
+		if n.state == "UNHEALTHY" {
+			info.HealthReport = "1/1 local-dirs usable space is below configured utilization percentage"
+		}
+		list = append(list, info)
+	}
+	return map[string]interface{}{"nodes": map[string]interface{}{"node": list}}
+}
+
+/**
+jmx 返回 ClusterMetrics、JvmMetrics 和每个队列及用户的 QueueMetrics
+*/
+
+func (c *Cluster) jmx() interface{} {
+	active, unhealthy := 0, 0
+	for _, n := range c.nodes {
+		if n.state == "RUNNING" {
+			active++
+		} else {
+			unhealthy++
+		}
+	}
+	beans := []map[string]interface{}{
+		{
+			"name":            "Hadoop:service=ResourceManager,name=ClusterMetrics",
+			"modelerType":     "ClusterMetrics",
+			"NumActiveNMs":    active,
+			"NumUnhealthyNMs": unhealthy,
+		},
+		{
+			"name":              "Hadoop:service=ResourceManager,name=JvmMetrics",
+			"modelerType":       "JvmMetrics",
+			"MemHeapUsedM":      256 + len(c.apps),
+			"MemHeapCommittedM": 1024,
+			"MemHeapMaxM":       4096,
+			"GcCount":           c.submitted,
+			"GcTimeMillis":      c.submitted * 7,
+		},
+	}
+	for _, q := range c.queues {
+		byUser := map[string]map[string]interface{}{}
+		bean := map[string]interface{}{
+			"name":        "Hadoop:service=ResourceManager,name=QueueMetrics,q0=root,q1=" + q.name,
+			"modelerType": "QueueMetrics,q0=root,q1=" + q.name,
+		}
+		for _, a := range c.apps {
+			if a.queue != q {
+				continue
+			}
+			u := byUser[a.user]
+			if u == nil {
+				u = map[string]interface{}{
+					"name":        "Hadoop:service=ResourceManager,name=QueueMetrics,q0=root,q1=" + q.name + ",user=" + a.user,
+					"modelerType": "QueueMetrics,q0=root,q1=" + q.name + ",user=" + a.user,
+				}
+				byUser[a.user] = u
+			}
+			for _, m := range []map[string]interface{}{bean, u} {
+				m["AppsSubmitted"] = count(m["AppsSubmitted"]) + 1
+				switch a.state {
+				case "ACCEPTED":
+					m["AppsPending"] = count(m["AppsPending"]) + 1
+				case "RUNNING":
+					m["AppsRunning"] = count(m["AppsRunning"]) + 1
+					m["AllocatedMB"] = count(m["AllocatedMB"]) + a.allocated()*containerMemoryMB
+					m["AllocatedContainers"] = count(m["AllocatedContainers"]) + a.allocated()
+				}
+			}
+		}
+		beans = append(beans, bean)
+		names := make([]string, 0, len(byUser))
+		for name := range byUser {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			beans = append(beans, byUser[name])
+		}
+	}
+	return map[string]interface{}{"beans": beans}
+}
+
+func count(v interface{}) int {
+	n, _ := v.(int)
+	return n
+}
@@ -0,0 +1,342 @@
+package yarn
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/prometheus/client_golang/prometheus"
+	"log"
+	"net/url"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"unicode"
+)
+
+/**
+定义 response body
+*/
+
+type jmxBeans struct {
+	Beans []map[string]interface{} `json:"beans"`
+}
+
+/**
+JmxRule 描述如何把一组 bean 的属性映射为 Prometheus 指标：
+Bean 是匹配 bean name 的正则；Attributes 为空时导出所有数值属性；
+指标名为 yarn_jmx_<Name>_<属性名的 snake_case>，Name 为空时使用 bean name 中 name= 的值；
+Labels 是从 bean name 中提取为标签的 key，例如 QueueMetrics 的 q0、q1、user，
+队列层级比规则中最深的 qN 更深时，更深的层级用 . 连接到该标签中；
+Type 为 gauge（默认）或 counter，counter 的指标名以 _total 结尾，以 Millis 结尾的毫秒属性换算为 _seconds_total。
+生成相同指标名的规则必须使用相同的 Labels。
+*/
+
+type JmxRule struct {
+	Bean       string   `json:"bean"`
+	Attributes []string `json:"attributes"`
+	Name       string   `json:"name"`
+	Labels     []string `json:"labels"`
+	Type       string   `json:"type"`
+
+	beanPattern *regexp.Regexp
+}
+
+/**
+默认导出的 bean：JVM 堆和 GC、RPC 队列、队列指标、集群指标和 RMNMInfo
+*/
+
+var DefaultJmxRules = []*JmxRule{
+	{Bean: `^Hadoop:service=ResourceManager,name=JvmMetrics$`, Name: "jvm", Attributes: []string{"MemHeapUsedM", "MemHeapCommittedM", "MemHeapMaxM", "MemNonHeapUsedM", "ThreadsRunnable", "ThreadsBlocked", "ThreadsWaiting"}},
+	{Bean: `^Hadoop:service=ResourceManager,name=JvmMetrics$`, Name: "jvm", Attributes: []string{"GcCount", "GcTimeMillis"}, Type: "counter"},
+	{Bean: `^Hadoop:service=ResourceManager,name=RpcActivityForPort\d+$`, Name: "rpc", Labels: []string{"name"}, Attributes: []string{"RpcQueueTimeAvgTime", "RpcProcessingTimeAvgTime", "CallQueueLength", "NumOpenConnections"}},
+	{Bean: `^Hadoop:service=ResourceManager,name=RpcActivityForPort\d+$`, Name: "rpc", Labels: []string{"name"}, Attributes: []string{"RpcQueueTimeNumOps", "RpcAuthenticationFailures", "RpcAuthorizationFailures"}, Type: "counter"},
+	{Bean: `^Hadoop:service=ResourceManager,name=QueueMetrics,`, Name: "queue", Labels: []string{"q0", "q1", "q2", "q3", "user"}},
+	{Bean: `^Hadoop:service=ResourceManager,name=ClusterMetrics$`, Name: "cluster"},
+	{Bean: `^Hadoop:service=ResourceManager,name=RMNMInfo$`, Name: "rmnm_info", Attributes: []string{"LiveNodeManagers"}},
+}
+
+/**
+从 JSON 文件加载规则，文件内容为 JmxRule 数组
+*/
+
+func LoadJmxRules(path string) ([]*JmxRule, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var rules []*JmxRule
+	if err := json.NewDecoder(f).Decode(&rules); err != nil {
+		return nil, err
+	}
+	return rules, nil
+}
+
+type JmxCollector struct {
+	JmxEndpoint *url.URL
+	Rules       []*JmxRule
+
+	mu        sync.Mutex
+	descs     map[string]*prometheus.Desc
+	labels    map[string][]string
+	conflicts map[string]bool
+}
+
+func (jc *JmxCollector) Collect(ch chan<- prometheus.Metric) {
+	beans, err := jc.fetch(jc.JmxEndpoint)
+	if err != nil {
+		log.Println("Error while collecting data from YARN: " + err.Error())
+		return
+	}
+	for _, bean := range beans {
+		name, _ := bean["name"].(string)
+		properties := beanProperties(name)
+		for _, rule := range jc.Rules {
+			if !rule.beanPattern.MatchString(name) {
+				continue
+			}
+			prefix := rule.Name
+			if prefix == "" {
+				prefix = snakeCase(properties["name"])
+			}
+			labelValues := make([]string, 0, len(rule.Labels))
+			for _, l := range rule.Labels {
+				labelValues = append(labelValues, labelValue(properties, rule.Labels, l))
+			}
+			valueType := prometheus.GaugeValue
+			if rule.Type == "counter" {
+				valueType = prometheus.CounterValue
+			}
+			for attribute, raw := range bean {
+				if len(rule.Attributes) > 0 && !contains(rule.Attributes, attribute) {
+					continue
+				}
+				value, ok := jmxValue(raw)
+				if !ok {
+					continue
+				}
+				metricName, scale := rule.metricName(prefix, attribute)
+				desc := jc.desc(metricName, name+" "+attribute, rule.Labels)
+				if desc == nil {
+					continue
+				}
+				ch <- prometheus.MustNewConstMetric(desc, valueType, value*scale, labelValues...)
+			}
+		}
+	}
+}
+
+/**
+导出的指标由 bean 决定，无法预先描述，因此 Describe 不发送任何 Desc
+*/
+
+func (jc *JmxCollector) Describe(ch chan<- *prometheus.Desc) {
+}
+
+/**
+指标名和换算比例。counter 加上 _total 后缀，毫秒计数换算为秒
+*/
+
+func (rule *JmxRule) metricName(prefix string, attribute string) (string, float64) {
+	name := "jmx_" + prefix + "_" + snakeCase(attribute)
+	if rule.Type != "counter" {
+		return name, 1
+	}
+	if strings.HasSuffix(name, "_millis") {
+		return strings.TrimSuffix(name, "_millis") + "_seconds_total", 0.001
+	}
+	if strings.HasSuffix(name, "_total") {
+		return name, 1
+	}
+	return name + "_total", 1
+}
+
+/**
+同一个指标名只创建一个 Desc。Name 为空的规则只有见到 bean 之后才知道指标名，
+与已有 Desc 的标签不同时记录一次日志并跳过，避免整个 scrape 失败
+*/
+
+func (jc *JmxCollector) desc(metricName string, docString string, labels []string) *prometheus.Desc {
+	jc.mu.Lock()
+	defer jc.mu.Unlock()
+	if desc, ok := jc.descs[metricName]; ok {
+		if strings.Join(jc.labels[metricName], ",") == strings.Join(labels, ",") {
+			return desc
+		}
+		if !jc.conflicts[metricName] {
+			jc.conflicts[metricName] = true
+			log.Printf("jmx metric %s is produced with different labels: %v and %v, skipping the latter", metricName, jc.labels[metricName], labels)
+		}
+		return nil
+	}
+	desc := newFuncMetric(metricName, docString, labels, nil)
+	jc.descs[metricName] = desc
+	jc.labels[metricName] = labels
+	return desc
+}
+
+func (jc *JmxCollector) fetch(u *url.URL) ([]map[string]interface{}, error) {
+	var c jmxBeans
+	if err := fetchJSON(u, &c); err != nil {
+		return nil, err
+	}
+	return c.Beans, nil
+}
+
+/**
+解析 bean name 中的 key=value，例如 Hadoop:service=ResourceManager,name=QueueMetrics,q0=root
+*/
+
+func beanProperties(name string) map[string]string {
+	properties := make(map[string]string)
+	if i := strings.Index(name, ":"); i >= 0 {
+		name = name[i+1:]
+	}
+	for _, pair := range strings.Split(name, ",") {
+		if kv := strings.SplitN(pair, "=", 2); len(kv) == 2 {
+			properties[kv[0]] = kv[1]
+		}
+	}
+	return properties
+}
+
+/**
+取标签的值。label 是 Labels 中最深的队列层级 qN 时，把 bean name 中更深的层级用 . 连接进来，
+例如 Labels 只到 q3 时 q3=a,q4=b 得到 a.b，否则深层队列会与上级队列得到相同的标签
+*/
+
+func labelValue(properties map[string]string, labels []string, label string) string {
+	value := properties[label]
+	level, ok := queueLevel(label)
+	if !ok {
+		return value
+	}
+	for _, l := range labels {
+		if other, ok := queueLevel(l); ok && other > level {
+			return value
+		}
+	}
+	for level++; ; level++ {
+		next, ok := properties["q"+strconv.Itoa(level)]
+		if !ok {
+			return value
+		}
+		value += "." + next
+	}
+}
+
+// queueLevel 解析 q0、q1 这样的队列层级
+func queueLevel(label string) (int, bool) {
+	if !strings.HasPrefix(label, "q") {
+		return 0, false
+	}
+	level, err := strconv.Atoi(label[1:])
+	return level, err == nil && level >= 0
+}
+
+/**
+数值和布尔属性直接导出；值为 JSON 数组的字符串属性（如 RMNMInfo 的 LiveNodeManagers）导出数组长度
+*/
+
+func jmxValue(raw interface{}) (float64, bool) {
+	switch v := raw.(type) {
+	case float64:
+		return v, true
+	case bool:
+		if v {
+			return 1, true
+		}
+		return 0, true
+	case string:
+		var items []interface{}
+		if strings.HasPrefix(v, "[") && json.Unmarshal([]byte(v), &items) == nil {
+			return float64(len(items)), true
+		}
+	}
+	return 0, false
+}
+
+/**
+把 JMX 的驼峰属性名转换为 snake_case，例如 MemHeapUsedM 转为 mem_heap_used_m
+*/
+
+func snakeCase(s string) string {
+	runes := []rune(s)
+	var b strings.Builder
+	for i, r := range runes {
+		if !unicode.IsLetter(r) && !unicode.IsDigit(r) {
+			b.WriteRune('_')
+			continue
+		}
+		if unicode.IsUpper(r) && i > 0 {
+			prev := runes[i-1]
+			nextLower := i+1 < len(runes) && unicode.IsLower(runes[i+1])
+			if unicode.IsLower(prev) || unicode.IsDigit(prev) || (unicode.IsUpper(prev) && nextLower) {
+				b.WriteRune('_')
+			}
+		}
+		b.WriteRune(unicode.ToLower(r))
+	}
+	return b.String()
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+/**
+rules 可能是共享的 DefaultJmxRules，编译时使用副本。
+生成相同指标名的规则共用一个 Desc，标签不同会导致采集失败，因此 Name 相同的规则按最终的指标名检查标签；
+没有列出 Attributes 的规则可能生成该前缀下的任意指标名。Name 为空的规则在采集时检查
+*/
+
+func NewJmxCollector(endpoint *url.URL, rules []*JmxRule) (*JmxCollector, error) {
+	compiled := make([]*JmxRule, 0, len(rules))
+	for _, r := range rules {
+		rule := *r
+		pattern, err := regexp.Compile(rule.Bean)
+		if err != nil {
+			return nil, err
+		}
+		rule.beanPattern = pattern
+		for _, other := range compiled {
+			if name, ok := rule.conflicts(other); ok {
+				return nil, fmt.Errorf("jmx rules producing %s have different labels: %v and %v", name, other.Labels, rule.Labels)
+			}
+		}
+		compiled = append(compiled, &rule)
+	}
+	return &JmxCollector{
+		JmxEndpoint: endpoint,
+		Rules:       compiled,
+		descs:       make(map[string]*prometheus.Desc),
+		labels:      make(map[string][]string),
+		conflicts:   make(map[string]bool),
+	}, nil
+}
+
+// conflicts 返回两个规则都会生成、但标签不同的指标名
+func (rule *JmxRule) conflicts(other *JmxRule) (string, bool) {
+	if rule.Name == "" || rule.Name != other.Name || strings.Join(rule.Labels, ",") == strings.Join(other.Labels, ",") {
+		return "", false
+	}
+	if len(rule.Attributes) == 0 || len(other.Attributes) == 0 {
+		return "yarn_jmx_" + rule.Name + "_*", true
+	}
+	for _, a := range rule.Attributes {
+		name, _ := rule.metricName(rule.Name, a)
+		for _, b := range other.Attributes {
+			if otherName, _ := other.metricName(other.Name, b); otherName == name {
+				return "yarn_" + name, true
+			}
+		}
+	}
+	return "", false
+}
@@ -0,0 +1,329 @@
+package yarn
+
+import (
+	"encoding/json"
+	"github.com/prometheus/client_golang/prometheus"
+	"log"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+/**
+定义 response body
+*/
+
+type historyJobList struct {
+	Jobs historyJobs `json:"jobs"`
+}
+type historyJobs struct {
+	Job []*historyJob `json:"job"`
+}
+type historyJob struct {
+	SubmitTime           int64 `json:"submitTime"`
+	StartTime            int64 `json:"startTime"`
+	FinishTime           int64 `json:"finishTime"`
+	MapsTotal            int   `json:"mapsTotal"`
+	ReducesTotal         int   `json:"reducesTotal"`
+	FailedMapAttempts    int   `json:"failedMapAttempts"`
+	KilledMapAttempts    int   `json:"killedMapAttempts"`
+	FailedReduceAttempts int   `json:"failedReduceAttempts"`
+	KilledReduceAttempts int   `json:"killedReduceAttempts"`
+	// 标签
+	Id    string `json:"id"`
+	Queue string `json:"queue"`
+	User  string `json:"user"`
+	State string `json:"state"`
+}
+type historyJobDetail struct {
+	Job historyJob `json:"job"`
+}
+
+// 作业耗时直方图的桶上界，单位秒
+var jobDurationBuckets = prometheus.ExponentialBuckets(60, 2, 12)
+
+func (hc *JobHistoryCollector) labels() []string {
+	var labels []string
+	return append(labels, "queue", "user")
+}
+
+/**
+jobHistoryState 是需要持久化的状态：拉取游标、失败次数和按 queue、user 累加的作业指标
+*/
+
+type jobHistoryState struct {
+	FinishedBegin int64               `json:"finishedBegin"`
+	SeenAtBegin   map[string]bool     `json:"seenAtBegin"`
+	FailureCount  int                 `json:"failureCount"`
+	Totals        []*jobHistoryTotals `json:"totals"`
+}
+type jobHistoryTotals struct {
+	Queue         string             `json:"queue"`
+	User          string             `json:"user"`
+	JobsCompleted map[string]float64 `json:"jobsCompleted"`
+	MapTasks      float64            `json:"mapTasks"`
+	ReduceTasks   float64            `json:"reduceTasks"`
+	FailedMaps    float64            `json:"failedMaps"`
+	KilledMaps    float64            `json:"killedMaps"`
+	FailedReduces float64            `json:"failedReduces"`
+	KilledReduces float64            `json:"killedReduces"`
+	// 耗时直方图，Buckets 与 jobDurationBuckets 对应，不累计
+	DurationCount   uint64   `json:"durationCount"`
+	DurationSum     float64  `json:"durationSum"`
+	DurationBuckets []uint64 `json:"durationBuckets"`
+	Created         int64    `json:"created"`
+}
+
+/**
+JobHistoryCollector 在后台每隔 Interval 拉取上次之后完成的作业（finishedTimeBegin），
+并把结果累加到计数器和直方图中，因此指标只覆盖 exporter 启动之后完成的作业；
+Collect 只输出已经累加的指标，不请求 JHS。累加结果和游标通过 Stateful 接口一起持久化
+*/
+
+type JobHistoryCollector struct {
+	JobsEndpoint *url.URL
+	Interval     time.Duration
+
+	mu             sync.Mutex
+	state          jobHistoryState
+	totals         map[[2]string]*jobHistoryTotals
+	JobsCompleted  *prometheus.Desc
+	MapTasks       *prometheus.Desc
+	ReduceTasks    *prometheus.Desc
+	FailedMaps     *prometheus.Desc
+	KilledMaps     *prometheus.Desc
+	FailedReduces  *prometheus.Desc
+	KilledReduces  *prometheus.Desc
+	JobDuration    *prometheus.Desc
+	ScrapeFailures *prometheus.Desc
+}
+
+func (hc *JobHistoryCollector) Collect(ch chan<- prometheus.Metric) {
+	hc.mu.Lock()
+	defer hc.mu.Unlock()
+
+	ch <- prometheus.MustNewConstMetric(hc.ScrapeFailures, prometheus.CounterValue, float64(hc.state.FailureCount))
+	for _, t := range hc.state.Totals {
+		created := time.UnixMilli(t.Created)
+		for state, count := range t.JobsCompleted {
+			ch <- newCounterMetric(hc.JobsCompleted, count, created, t.Queue, t.User, state)
+		}
+		ch <- newCounterMetric(hc.MapTasks, t.MapTasks, created, t.Queue, t.User)
+		ch <- newCounterMetric(hc.ReduceTasks, t.ReduceTasks, created, t.Queue, t.User)
+		ch <- newCounterMetric(hc.FailedMaps, t.FailedMaps, created, t.Queue, t.User)
+		ch <- newCounterMetric(hc.KilledMaps, t.KilledMaps, created, t.Queue, t.User)
+		ch <- newCounterMetric(hc.FailedReduces, t.FailedReduces, created, t.Queue, t.User)
+		ch <- newCounterMetric(hc.KilledReduces, t.KilledReduces, created, t.Queue, t.User)
+		if t.DurationCount == 0 {
+			continue
+		}
+		buckets := make(map[float64]uint64, len(jobDurationBuckets))
+		var cumulative uint64
+		for i, upperBound := range jobDurationBuckets {
+			cumulative += t.DurationBuckets[i]
+			buckets[upperBound] = cumulative
+		}
+		ch <- prometheus.MustNewConstHistogramWithCreatedTimestamp(hc.JobDuration, t.DurationCount, t.DurationSum, buckets, created, t.Queue, t.User)
+	}
+}
+
+func (hc *JobHistoryCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- hc.JobsCompleted
+	ch <- hc.MapTasks
+	ch <- hc.ReduceTasks
+	ch <- hc.FailedMaps
+	ch <- hc.KilledMaps
+	ch <- hc.FailedReduces
+	ch <- hc.KilledReduces
+	ch <- hc.JobDuration
+	ch <- hc.ScrapeFailures
+}
+
+/**
+立即拉取一次，之后按 Interval 定期拉取，直到 stop 被关闭
+*/
+
+func (hc *JobHistoryCollector) Run(stop <-chan struct{}) {
+	ticker := time.NewTicker(hc.Interval)
+	defer ticker.Stop()
+	for {
+		if err := hc.Poll(); err != nil {
+			hc.mu.Lock()
+			hc.state.FailureCount++
+			hc.mu.Unlock()
+			log.Println("Error while collecting data from JobHistory Server: " + err.Error())
+		}
+		select {
+		case <-ticker.C:
+		case <-stop:
+			return
+		}
+	}
+}
+
+/**
+拉取新完成的作业并累加指标。finishedTimeBegin 是闭区间，
+同一毫秒完成的作业通过 seenAtBegin 去重。请求 JHS 时不持有锁，
+只有 Run 调用 Poll，游标不会被并发推进
+*/
+
+func (hc *JobHistoryCollector) Poll() error {
+	hc.mu.Lock()
+	finishedBegin, seenAtBegin := hc.state.FinishedBegin, hc.state.SeenAtBegin
+	hc.mu.Unlock()
+
+	jobs, err := hc.fetch(hc.JobsEndpoint, finishedBegin)
+	if err != nil {
+		return err
+	}
+	sort.Slice(jobs, func(i, k int) bool { return jobs[i].FinishTime < jobs[k].FinishTime })
+
+	for _, j := range jobs {
+		if j.FinishTime < finishedBegin || (j.FinishTime == finishedBegin && seenAtBegin[j.Id]) {
+			continue
+		}
+		detail, err := hc.fetchJob(hc.JobsEndpoint, j.Id)
+		if err != nil {
+			return err
+		}
+
+		// 逐个推进游标，中途失败时下次从失败的作业继续；指标和游标一起更新，快照保持一致
+		hc.mu.Lock()
+		hc.observe(detail, time.Now())
+		if j.FinishTime > hc.state.FinishedBegin {
+			hc.state.FinishedBegin = j.FinishTime
+			hc.state.SeenAtBegin = make(map[string]bool)
+		}
+		if j.FinishTime == hc.state.FinishedBegin {
+			hc.state.SeenAtBegin[j.Id] = true
+		}
+		hc.mu.Unlock()
+	}
+	return nil
+}
+
+func (hc *JobHistoryCollector) observe(j *historyJob, now time.Time) {
+	t := hc.totalsOf(j.Queue, j.User, now)
+	t.JobsCompleted[j.State]++
+	t.MapTasks += float64(j.MapsTotal)
+	t.ReduceTasks += float64(j.ReducesTotal)
+	t.FailedMaps += float64(j.FailedMapAttempts)
+	t.KilledMaps += float64(j.KilledMapAttempts)
+	t.FailedReduces += float64(j.FailedReduceAttempts)
+	t.KilledReduces += float64(j.KilledReduceAttempts)
+	if j.StartTime > 0 && j.FinishTime >= j.StartTime {
+		duration := float64(j.FinishTime-j.StartTime) / 1000
+		t.DurationCount++
+		t.DurationSum += duration
+		for i, upperBound := range jobDurationBuckets {
+			if duration <= upperBound {
+				t.DurationBuckets[i]++
+				break
+			}
+		}
+	}
+}
+
+func (hc *JobHistoryCollector) totalsOf(queue string, user string, now time.Time) *jobHistoryTotals {
+	key := [2]string{queue, user}
+	if t, ok := hc.totals[key]; ok {
+		return t
+	}
+	t := &jobHistoryTotals{
+		Queue:           queue,
+		User:            user,
+		JobsCompleted:   make(map[string]float64),
+		DurationBuckets: make([]uint64, len(jobDurationBuckets)),
+		Created:         now.UnixNano() / int64(time.Millisecond),
+	}
+	hc.totals[key] = t
+	hc.state.Totals = append(hc.state.Totals, t)
+	return t
+}
+
+func (hc *JobHistoryCollector) fetch(u *url.URL, finishedBegin int64) ([]*historyJob, error) {
+	q := u.Query()
+	q.Set("finishedTimeBegin", strconv.FormatInt(finishedBegin, 10))
+	endpoint := *u
+	endpoint.RawQuery = q.Encode()
+
+	var c historyJobList
+	if err := fetchJSON(&endpoint, &c); err != nil {
+		return nil, err
+	}
+	return c.Jobs.Job, nil
+}
+
+func (hc *JobHistoryCollector) fetchJob(u *url.URL, id string) (*historyJob, error) {
+	endpoint := *u
+	endpoint.Path = strings.TrimSuffix(endpoint.Path, "/") + "/" + id
+	endpoint.RawQuery = ""
+
+	var c historyJobDetail
+	if err := fetchJSON(&endpoint, &c); err != nil {
+		return nil, err
+	}
+	return &c.Job, nil
+}
+
+func (hc *JobHistoryCollector) StateKey() string {
+	return "jobhistory"
+}
+
+func (hc *JobHistoryCollector) Snapshot() ([]byte, error) {
+	hc.mu.Lock()
+	defer hc.mu.Unlock()
+	return json.Marshal(&hc.state)
+}
+
+func (hc *JobHistoryCollector) Restore(data []byte) error {
+	var state jobHistoryState
+	if err := json.Unmarshal(data, &state); err != nil {
+		return err
+	}
+	if state.SeenAtBegin == nil {
+		state.SeenAtBegin = make(map[string]bool)
+	}
+	// 直方图的桶与当前 jobDurationBuckets 不一致时丢弃，计数器照常恢复
+	totals := make(map[[2]string]*jobHistoryTotals, len(state.Totals))
+	for _, t := range state.Totals {
+		if t.JobsCompleted == nil {
+			t.JobsCompleted = make(map[string]float64)
+		}
+		if len(t.DurationBuckets) != len(jobDurationBuckets) {
+			t.DurationCount, t.DurationSum = 0, 0
+			t.DurationBuckets = make([]uint64, len(jobDurationBuckets))
+		}
+		totals[[2]string{t.Queue, t.User}] = t
+	}
+	hc.mu.Lock()
+	defer hc.mu.Unlock()
+	hc.state = state
+	hc.totals = totals
+	return nil
+}
+
+func NewJobHistoryCollector(endpoint *url.URL, interval time.Duration) *JobHistoryCollector {
+	labels := new(JobHistoryCollector).labels()
+	return &JobHistoryCollector{
+		JobsEndpoint: endpoint,
+		Interval:     interval,
+		state: jobHistoryState{
+			FinishedBegin: time.Now().UnixNano() / int64(time.Millisecond),
+			SeenAtBegin:   make(map[string]bool),
+		},
+		totals:         make(map[[2]string]*jobHistoryTotals),
+		JobsCompleted:  newFuncMetric("jhs_jobs_completed_total", "MapReduce jobs completed", append(labels, "state"), nil),
+		MapTasks:       newFuncMetric("jhs_map_tasks_total", "map tasks of completed jobs", labels, nil),
+		ReduceTasks:    newFuncMetric("jhs_reduce_tasks_total", "reduce tasks of completed jobs", labels, nil),
+		FailedMaps:     newFuncMetric("jhs_failed_map_attempts_total", "failed map attempts of completed jobs", labels, nil),
+		KilledMaps:     newFuncMetric("jhs_killed_map_attempts_total", "killed map attempts of completed jobs", labels, nil),
+		FailedReduces:  newFuncMetric("jhs_failed_reduce_attempts_total", "failed reduce attempts of completed jobs", labels, nil),
+		KilledReduces:  newFuncMetric("jhs_killed_reduce_attempts_total", "killed reduce attempts of completed jobs", labels, nil),
+		JobDuration:    newFuncMetric("jhs_job_duration_seconds", "duration of completed jobs", labels, nil),
+		ScrapeFailures: newFuncMetric("jhs_scrape_failures_total", "Number of errors while polling the JobHistory Server", nil, nil),
+	}
+}
@@ -0,0 +1,323 @@
+package yarn
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/prometheus/client_golang/prometheus"
+	"log"
+	"os"
+	"regexp"
+	"sync"
+	"time"
+)
+
+/**
+JobSLA 声明一个周期性作业：名称匹配 Pattern 的应用（Queue、User 不为空时也要相同）都是该作业的运行。
+Interval 是预期的成功间隔，例如 "24h"；设置了 Deadline（"06:00"，按 Timezone 解释，默认本地时区）时，
+每个截止时间之前的一个 Interval 内必须有一次成功，否则只要求最近一次成功在 Interval 以内。
+MaxDuration 是单次运行的最长耗时，最近一次成功或正在运行的实例超过它时同样视为违约
+*/
+
+type JobSLA struct {
+	Name        string `json:"name"`
+	Pattern     string `json:"pattern"`
+	Queue       string `json:"queue"`
+	User        string `json:"user"`
+	Interval    string `json:"interval"`
+	Deadline    string `json:"deadline"`
+	Timezone    string `json:"timezone"`
+	MaxDuration string `json:"maxDuration"`
+
+	pattern     *regexp.Regexp
+	interval    time.Duration
+	deadline    time.Duration
+	hasDeadline bool
+	location    *time.Location
+	maxDuration time.Duration
+}
+
+/**
+从 JSON 文件加载作业，文件内容为 JobSLA 数组，作业名不能重复
+*/
+
+func LoadJobSLAs(path string) ([]*JobSLA, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var jobs []*JobSLA
+	if err := json.NewDecoder(f).Decode(&jobs); err != nil {
+		return nil, err
+	}
+	if err := checkJobNames(jobs); err != nil {
+		return nil, err
+	}
+	return jobs, nil
+}
+
+// checkJobNames 拒绝重复的作业名，否则同一个 job 标签会输出多次，状态也会互相覆盖
+func checkJobNames(jobs []*JobSLA) error {
+	names := make(map[string]bool, len(jobs))
+	for _, j := range jobs {
+		if names[j.Name] {
+			return fmt.Errorf("job %s: duplicate name", j.Name)
+		}
+		names[j.Name] = true
+	}
+	return nil
+}
+
+func (j *JobSLA) compile() error {
+	var err error
+	if j.Name == "" {
+		return fmt.Errorf("job without name")
+	}
+	if j.pattern, err = regexp.Compile(j.Pattern); err != nil {
+		return fmt.Errorf("job %s: %s", j.Name, err)
+	}
+	if j.Interval != "" {
+		if j.interval, err = time.ParseDuration(j.Interval); err != nil || j.interval <= 0 {
+			return fmt.Errorf("job %s: invalid interval %q", j.Name, j.Interval)
+		}
+	}
+	if j.MaxDuration != "" {
+		if j.maxDuration, err = time.ParseDuration(j.MaxDuration); err != nil {
+			return fmt.Errorf("job %s: invalid maxDuration %q", j.Name, j.MaxDuration)
+		}
+	}
+	j.location = time.Local
+	if j.Timezone != "" {
+		if j.location, err = time.LoadLocation(j.Timezone); err != nil {
+			return fmt.Errorf("job %s: %s", j.Name, err)
+		}
+	}
+	if j.Deadline != "" {
+		t, err := time.Parse("15:04", j.Deadline)
+		if err != nil || j.interval == 0 {
+			return fmt.Errorf("job %s: deadline %q needs the HH:MM format and an interval", j.Name, j.Deadline)
+		}
+		j.deadline = time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute
+		j.hasDeadline = true
+	}
+	return nil
+}
+
+func (j *JobSLA) matches(a *application) bool {
+	return j.pattern.MatchString(a.Name) && (j.Queue == "" || j.Queue == a.Queue) && (j.User == "" || j.User == a.User)
+}
+
+/**
+不晚于 now 的最近一个截止时间。截止时间从 1970-01-01 当地的 Deadline 起每隔一个 Interval 出现一次，
+所以 48h 这样的间隔隔天生效，不整除一天的间隔也不会在午夜重新对齐。
+Interval 是整天时按日历天平移，夏令时切换的那天截止时间依然是当地的 Deadline
+*/
+
+func (j *JobSLA) lastDeadline(now time.Time) time.Time {
+	hour, minute := int(j.deadline/time.Hour), int(j.deadline%time.Hour/time.Minute)
+	if days := j.days(); days > 0 {
+		y, m, d := now.In(j.location).Date()
+		due := time.Date(y, m, d, hour, minute, 0, 0, j.location)
+		if due.After(now) {
+			due = due.AddDate(0, 0, -1)
+		}
+		y, m, d = due.Date()
+		epochDay := int(time.Date(y, m, d, 0, 0, 0, 0, time.UTC).Unix() / 86400)
+		return due.AddDate(0, 0, -(epochDay % days))
+	}
+	epoch := time.Date(1970, 1, 1, hour, minute, 0, 0, j.location)
+	return epoch.Add(now.Sub(epoch) / j.interval * j.interval)
+}
+
+// days 是整天的 Interval 对应的天数，不是整天时为 0
+func (j *JobSLA) days() int {
+	if j.interval%(24*time.Hour) != 0 {
+		return 0
+	}
+	return int(j.interval / (24 * time.Hour))
+}
+
+// windowStart 是截止时间 due 之前一个 Interval 的时刻
+func (j *JobSLA) windowStart(due time.Time) time.Time {
+	if j.hasDeadline && j.days() > 0 {
+		return due.AddDate(0, 0, -j.days())
+	}
+	return due.Add(-j.interval)
+}
+
+/**
+没有按时成功，或最近一次成功、正在运行的实例超过 MaxDuration 时违约。迟到的成功会让违约恢复
+*/
+
+func (j *JobSLA) breached(now time.Time, s *jobState, running []*application) bool {
+	if j.interval > 0 {
+		due := now
+		if j.hasDeadline {
+			due = j.lastDeadline(now)
+		}
+		if s.LastSuccess == 0 || !time.UnixMilli(s.LastSuccess).After(j.windowStart(due)) {
+			return true
+		}
+	}
+	if j.maxDuration > 0 {
+		if s.LastSuccess > 0 && s.LastDuration > j.maxDuration.Seconds() {
+			return true
+		}
+		for _, a := range running {
+			if time.Duration(a.ElapsedTime)*time.Millisecond > j.maxDuration {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+/**
+需要持久化的状态：RM 只保留有限数量的已结束应用，最近一次成功需要记下来
+*/
+
+type jobState struct {
+	LastSuccess  int64   `json:"lastSuccess"`
+	LastDuration float64 `json:"lastDuration"`
+}
+
+// 保存的快照，旧版本只保存了 Jobs
+type jobSLAState struct {
+	Jobs         map[string]*jobState `json:"jobs"`
+	FailureCount int                  `json:"failureCount"`
+}
+
+/**
+JobSLACollector 按作业输出最近一次成功和是否违约。拉取应用失败时不知道作业是否按时成功，
+只输出已记录的最近一次成功并增加 ScrapeFailures，不输出 breached。Now 可以在测试中替换
+*/
+
+type JobSLACollector struct {
+	Apps *ApplicationCollector
+	Jobs []*JobSLA
+	Now  func() time.Time
+
+	LastSuccess    *prometheus.Desc
+	LastDuration   *prometheus.Desc
+	Breached       *prometheus.Desc
+	ScrapeFailures *prometheus.Desc
+
+	mu           sync.Mutex
+	state        map[string]*jobState
+	FailureCount int
+}
+
+func (jc *JobSLACollector) labels() []string {
+	var labels []string
+	return append(labels, "job")
+}
+
+func (jc *JobSLACollector) Collect(ch chan<- prometheus.Metric) {
+	apps, err := jc.Apps.latest()
+	now := jc.Now()
+
+	jc.mu.Lock()
+	defer jc.mu.Unlock()
+	if err != nil {
+		jc.FailureCount++
+		log.Println("Error while collecting data from YARN: " + err.Error())
+	}
+	ch <- prometheus.MustNewConstMetric(jc.ScrapeFailures, prometheus.CounterValue, float64(jc.FailureCount))
+	for _, j := range jc.Jobs {
+		s := jc.jobState(j.Name)
+		var running []*application
+		for _, a := range apps {
+			if !j.matches(a) {
+				continue
+			}
+			if a.State == "RUNNING" {
+				running = append(running, a)
+			}
+			if a.FinalStatus == "SUCCEEDED" && a.FinishedTime > s.LastSuccess {
+				s.LastSuccess = a.FinishedTime
+				s.LastDuration = float64(a.FinishedTime-a.StartedTime) / 1000
+			}
+		}
+
+		if s.LastSuccess > 0 {
+			ch <- prometheus.MustNewConstMetric(jc.LastSuccess, prometheus.GaugeValue, float64(s.LastSuccess)/1000, j.Name)
+			ch <- prometheus.MustNewConstMetric(jc.LastDuration, prometheus.GaugeValue, s.LastDuration, j.Name)
+		}
+		if err != nil {
+			continue
+		}
+		breached := 0.0
+		if j.breached(now, s, running) {
+			breached = 1
+		}
+		ch <- prometheus.MustNewConstMetric(jc.Breached, prometheus.GaugeValue, breached, j.Name)
+	}
+}
+
+func (jc *JobSLACollector) jobState(name string) *jobState {
+	s, ok := jc.state[name]
+	if !ok {
+		s = &jobState{}
+		jc.state[name] = s
+	}
+	return s
+}
+
+func (jc *JobSLACollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- jc.LastSuccess
+	ch <- jc.LastDuration
+	ch <- jc.Breached
+	ch <- jc.ScrapeFailures
+}
+
+func (jc *JobSLACollector) StateKey() string {
+	return "jobs"
+}
+
+func (jc *JobSLACollector) Snapshot() ([]byte, error) {
+	jc.mu.Lock()
+	defer jc.mu.Unlock()
+	return json.Marshal(&jobSLAState{Jobs: jc.state, FailureCount: jc.FailureCount})
+}
+
+func (jc *JobSLACollector) Restore(data []byte) error {
+	var state jobSLAState
+	if err := json.Unmarshal(data, &state); err != nil || state.Jobs == nil {
+		// 旧版本的快照是按作业名索引的 map
+		state = jobSLAState{}
+		if err := json.Unmarshal(data, &state.Jobs); err != nil {
+			return err
+		}
+		if state.Jobs == nil {
+			state.Jobs = make(map[string]*jobState)
+		}
+	}
+	jc.mu.Lock()
+	defer jc.mu.Unlock()
+	jc.state = state.Jobs
+	jc.FailureCount = state.FailureCount
+	return nil
+}
+
+func NewJobSLACollector(apps *ApplicationCollector, jobs []*JobSLA) (*JobSLACollector, error) {
+	if err := checkJobNames(jobs); err != nil {
+		return nil, err
+	}
+	for _, j := range jobs {
+		if err := j.compile(); err != nil {
+			return nil, err
+		}
+	}
+	labels := new(JobSLACollector).labels()
+	return &JobSLACollector{
+		Apps:           apps,
+		Jobs:           jobs,
+		Now:            time.Now,
+		state:          make(map[string]*jobState),
+		LastSuccess:    newFuncMetric("job_last_success_timestamp_seconds", "finish time of the last successful run of the job, in unix seconds", labels, nil),
+		LastDuration:   newFuncMetric("job_last_duration_seconds", "duration of the last successful run of the job", labels, nil),
+		Breached:       newFuncMetric("job_sla_breached", "1 if the job missed its schedule or exceeded its max duration", labels, nil),
+		ScrapeFailures: newFuncMetric("job_sla_scrape_failures_total", "Number of errors while fetching applications for job SLAs", nil, nil),
+	}, nil
+}
@@ -0,0 +1,313 @@
+package yarn
+
+import (
+	"fmt"
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	"time"
+)
+
+/**
+指标命名方案。v1 是最初的名称；v2 按 collector 加上 cluster_、queue_、app_ 前缀，
+内存换算为字节，百分比换算为 0-1 的比例，毫秒换算为秒，累计值为以 _total 结尾的 counter。
+迁移期间可以用 NamingBoth 同时输出两套名称
+*/
+
+type Naming int
+
+const (
+	NamingV1 Naming = iota
+	NamingV2
+	NamingBoth
+)
+
+func ParseNaming(s string) (Naming, error) {
+	switch s {
+	case "", "v1":
+		return NamingV1, nil
+	case "v2":
+		return NamingV2, nil
+	case "both":
+		return NamingBoth, nil
+	}
+	return NamingV1, fmt.Errorf("unknown metric naming %q, expected v1, v2 or both", s)
+}
+
+const (
+	bytesPerMB   = 1024 * 1024
+	percentRatio = 0.01
+	secondsPerMs = 0.001
+	noScale      = 1.0
+	gaugeValue   = prometheus.GaugeValue
+	counterValue = prometheus.CounterValue
+)
+
+type v2Name struct {
+	name      string
+	help      string
+	scale     float64
+	valueType prometheus.ValueType
+}
+
+/**
+v1 名称到 v2 名称的映射，不在表中的指标两种方案下名称相同
+*/
+
+var v2Names = map[string]v2Name{
+	// ClusterCollector
+	"applications_submitted":  {"cluster_applications_submitted_total", "Total applications submitted", noScale, counterValue},
+	"applications_completed":  {"cluster_applications_completed_total", "Total applications completed", noScale, counterValue},
+	"applications_pending":    {"cluster_applications_pending", "Applications pending", noScale, gaugeValue},
+	"applications_running":    {"cluster_applications_running", "Applications running", noScale, gaugeValue},
+	"applications_failed":     {"cluster_applications_failed_total", "Total applications failed", noScale, counterValue},
+	"applications_killed":     {"cluster_applications_killed_total", "Total applications killed", noScale, counterValue},
+	"memory_reserved":         {"cluster_memory_reserved_bytes", "Memory reserved", bytesPerMB, gaugeValue},
+	"memory_available":        {"cluster_memory_available_bytes", "Memory available", bytesPerMB, gaugeValue},
+	"memory_allocated":        {"cluster_memory_allocated_bytes", "Memory allocated", bytesPerMB, gaugeValue},
+	"memory_total":            {"cluster_memory_capacity_bytes", "Total memory", bytesPerMB, gaugeValue},
+	"virtual_cores_reserved":  {"cluster_v_cores_reserved", "Virtual cores reserved", noScale, gaugeValue},
+	"virtual_cores_available": {"cluster_v_cores_available", "Virtual cores available", noScale, gaugeValue},
+	"virtual_cores_allocated": {"cluster_v_cores_allocated", "Virtual cores allocated", noScale, gaugeValue},
+	"virtual_cores_total":     {"cluster_v_cores_capacity", "Total virtual cores", noScale, gaugeValue},
+	"containers_allocated":    {"cluster_containers_allocated", "Containers allocated", noScale, gaugeValue},
+	"containers_reserved":     {"cluster_containers_reserved", "Containers reserved", noScale, gaugeValue},
+	"containers_pending":      {"cluster_containers_pending", "Containers pending", noScale, gaugeValue},
+	"nodes_total":             {"cluster_nodes", "Nodes total", noScale, gaugeValue},
+	"nodes_lost":              {"cluster_nodes_lost", "Nodes lost", noScale, gaugeValue},
+	"nodes_unhealthy":         {"cluster_nodes_unhealthy", "Nodes unhealthy", noScale, gaugeValue},
+	"nodes_decommissioned":    {"cluster_nodes_decommissioned", "Nodes decommissioned", noScale, gaugeValue},
+	"nodes_decommissioning":   {"cluster_nodes_decommissioning", "Nodes decommissioning", noScale, gaugeValue},
+	"nodes_rebooted":          {"cluster_nodes_rebooted", "Nodes rebooted", noScale, gaugeValue},
+	"nodes_active":            {"cluster_nodes_active", "Nodes active", noScale, gaugeValue},
+	"nodes_shutdown":          {"cluster_nodes_shutdown", "Nodes shutdown", noScale, gaugeValue},
+	"cluster_total_resource":  {"cluster_resource_capacity", "Total cluster resource per resource type", noScale, gaugeValue},
+	"cluster_used_resource":   {"cluster_resource_used", "Used cluster resource per resource type", noScale, gaugeValue},
+
+	// SchedulerCollector
+	"capacity":                         {"queue_capacity_ratio", "Configured capacity of the queue relative to its parent", percentRatio, gaugeValue},
+	"max_capacity":                     {"queue_max_capacity_ratio", "Maximum capacity of the queue relative to its parent", percentRatio, gaugeValue},
+	"used_capacity":                    {"queue_used_capacity_ratio", "Used capacity of the queue relative to its capacity", percentRatio, gaugeValue},
+	"absolute_capacity":                {"queue_absolute_capacity_ratio", "Configured capacity of the queue relative to the cluster", percentRatio, gaugeValue},
+	"absolute_max_capacity":            {"queue_absolute_max_capacity_ratio", "Maximum capacity of the queue relative to the cluster", percentRatio, gaugeValue},
+	"absolute_used_capacity":           {"queue_absolute_used_capacity_ratio", "Used capacity of the queue relative to the cluster", percentRatio, gaugeValue},
+	"num_applications":                 {"queue_applications", "Applications in the queue", noScale, gaugeValue},
+	"resources_used_memory":            {"queue_memory_used_bytes", "Memory used by the queue", bytesPerMB, gaugeValue},
+	"resources_used_v_cores":           {"queue_v_cores_used", "Cores used by the queue", noScale, gaugeValue},
+	"partition_capacity":               {"queue_partition_capacity_ratio", "Configured capacity per partition", percentRatio, gaugeValue},
+	"partition_used_capacity":          {"queue_partition_used_capacity_ratio", "Used capacity per partition", percentRatio, gaugeValue},
+	"partition_max_capacity":           {"queue_partition_max_capacity_ratio", "Maximum capacity per partition", percentRatio, gaugeValue},
+	"partition_absolute_capacity":      {"queue_partition_absolute_capacity_ratio", "Absolute capacity per partition", percentRatio, gaugeValue},
+	"partition_absolute_used_capacity": {"queue_partition_absolute_used_capacity_ratio", "Absolute used capacity per partition", percentRatio, gaugeValue},
+	"partition_absolute_max_capacity":  {"queue_partition_absolute_max_capacity_ratio", "Absolute maximum capacity per partition", percentRatio, gaugeValue},
+	"partition_resources_used_memory":  {"queue_partition_memory_used_bytes", "Memory used per partition", bytesPerMB, gaugeValue},
+	"partition_resources_used_v_cores": {"queue_partition_v_cores_used", "Cores used per partition", noScale, gaugeValue},
+	"partition_reserved_memory":        {"queue_partition_memory_reserved_bytes", "Memory reserved per partition", bytesPerMB, gaugeValue},
+	"partition_reserved_v_cores":       {"queue_partition_v_cores_reserved", "Cores reserved per partition", noScale, gaugeValue},
+	"queue_used_resource":              {"queue_resource_used", "Used resource per resource type", noScale, gaugeValue},
+	"partition_used_resource":          {"queue_partition_resource_used", "Used resource per partition and resource type", noScale, gaugeValue},
+	"partition_reserved_resource":      {"queue_partition_resource_reserved", "Reserved resource per partition and resource type", noScale, gaugeValue},
+	"user_used_resource":               {"queue_user_resource_used", "Used resource per user and resource type", noScale, gaugeValue},
+	"max_applications":                 {"queue_max_applications", "Maximum applications of the queue", noScale, gaugeValue},
+	"max_applications_per_user":        {"queue_max_applications_per_user", "Maximum applications per user of the queue", noScale, gaugeValue},
+	"num_pending_applications":         {"queue_applications_pending", "Pending applications in the queue", noScale, gaugeValue},
+	"num_active_applications":          {"queue_applications_active", "Active applications in the queue", noScale, gaugeValue},
+	"num_containers":                   {"queue_containers", "Containers in the queue", noScale, gaugeValue},
+	"am_resource_limit_memory":         {"queue_am_memory_limit_bytes", "Application master memory limit", bytesPerMB, gaugeValue},
+	"am_resource_limit_v_cores":        {"queue_am_v_cores_limit", "Application master cores limit", noScale, gaugeValue},
+	"used_am_resource_memory":          {"queue_am_memory_used_bytes", "Memory used by application masters", bytesPerMB, gaugeValue},
+	"used_am_resource_v_cores":         {"queue_am_v_cores_used", "Cores used by application masters", noScale, gaugeValue},
+	"user_resources_used_memory":       {"queue_user_memory_used_bytes", "Memory used per user", bytesPerMB, gaugeValue},
+	"user_resources_used_v_cores":      {"queue_user_v_cores_used", "Cores used per user", noScale, gaugeValue},
+	"user_am_resource_used_memory":     {"queue_user_am_memory_used_bytes", "Memory used by application masters per user", bytesPerMB, gaugeValue},
+	"user_am_resource_used_v_cores":    {"queue_user_am_v_cores_used", "Cores used by application masters per user", noScale, gaugeValue},
+	"user_resource_limit_memory":       {"queue_user_memory_limit_bytes", "User limit memory", bytesPerMB, gaugeValue},
+	"user_resource_limit_v_cores":      {"queue_user_v_cores_limit", "User limit cores", noScale, gaugeValue},
+	"user_num_active_applications":     {"queue_user_applications_active", "Active applications per user", noScale, gaugeValue},
+	"user_num_pending_applications":    {"queue_user_applications_pending", "Pending applications per user", noScale, gaugeValue},
+	"preemption_disabled":              {"queue_preemption_disabled", "1 if preemption is disabled for the queue", noScale, gaugeValue},
+	"pending_containers":               {"queue_containers_pending", "Pending containers in the queue", noScale, gaugeValue},
+	"reserved_containers":              {"queue_containers_reserved", "Reserved containers in the queue", noScale, gaugeValue},
+
+	// ApplicationCollector
+	"elapsed_time":             {"app_elapsed_seconds", "Elapsed time of the application", secondsPerMs, gaugeValue},
+	"allocated_MB":             {"app_memory_allocated_bytes", "Memory allocated to the application", bytesPerMB, gaugeValue},
+	"allocated_v_cores":        {"app_v_cores_allocated", "Cores allocated to the application", noScale, gaugeValue},
+	"running_containers":       {"app_containers_running", "Running containers of the application", noScale, gaugeValue},
+	"memory_seconds":           {"app_memory_byte_seconds_total", "Memory seconds consumed by the application", bytesPerMB, counterValue},
+	"v_core_seconds":           {"app_v_core_seconds_total", "Core seconds consumed by the application", noScale, counterValue},
+	"queue_usage_percentage":   {"app_queue_usage_ratio", "Share of the queue used by the application", percentRatio, gaugeValue},
+	"cluster_usage_percentage": {"app_cluster_usage_ratio", "Share of the cluster used by the application", percentRatio, gaugeValue},
+	"app_allocated_resource":   {"app_resource_allocated", "Allocated resource per resource type", noScale, gaugeValue},
+
+	// NodesCollector
+	"node_used_memory":        {"node_memory_used_bytes", "Used memory of the node", bytesPerMB, gaugeValue},
+	"node_available_memory":   {"node_memory_available_bytes", "Available memory of the node", bytesPerMB, gaugeValue},
+	"node_last_health_update": {"node_last_health_update_timestamp_seconds", "Last health update of the node", noScale, gaugeValue},
+
+	// NodeLabelsCollector
+	"node_label_resource_available_memory": {"node_label_memory_available_bytes", "Memory available in the node label partition", bytesPerMB, gaugeValue},
+
+	// NodeManagerCollector
+	"nodemanager_last_node_update_time":           {"nodemanager_last_node_update_timestamp_seconds", "Last node health update", noScale, gaugeValue},
+	"nodemanager_total_vmem_allocated_containers": {"nodemanager_containers_vmem_allocated_bytes", "Virtual memory allocated to containers", bytesPerMB, gaugeValue},
+	"nodemanager_total_pmem_allocated_containers": {"nodemanager_containers_pmem_allocated_bytes", "Physical memory allocated to containers", bytesPerMB, gaugeValue},
+	"nodemanager_container_allocated_memory":      {"nodemanager_container_memory_allocated_bytes", "Memory allocated to the container, not its measured usage", bytesPerMB, gaugeValue},
+
+	// ReservationCollector
+	"reservation_start_time":            {"reservation_start_timestamp_seconds", "Reservation start time", noScale, gaugeValue},
+	"reservation_end_time":              {"reservation_end_timestamp_seconds", "Reservation end time", noScale, gaugeValue},
+	"reservation_reserved_memory":       {"reservation_memory_reserved_bytes", "Memory reserved at scrape time", bytesPerMB, gaugeValue},
+	"reservation_allocation_start_time": {"reservation_allocation_start_timestamp_seconds", "Start time of a current or future reservation allocation", noScale, gaugeValue},
+	"reservation_allocation_end_time":   {"reservation_allocation_end_timestamp_seconds", "End time of a current or future reservation allocation", noScale, gaugeValue},
+	"reservation_allocation_memory":     {"reservation_allocation_memory_bytes", "Memory of a current or future reservation allocation", bytesPerMB, gaugeValue},
+
+	// TimelineCollector
+	"timeline_flow_memory_seconds": {"timeline_flow_memory_byte_seconds", "Memory seconds of flow runs in the lookback window", bytesPerMB, gaugeValue},
+}
+
+type variant struct {
+	desc           *prometheus.Desc
+	variableLabels []string
+	scale          float64
+	valueType      prometheus.ValueType
+}
+
+/**
+variants 是一个 collector 的 v1 Desc 到 v2 变体的映射，在构造 collector 时由 newFuncMetric 填写，之后只读。
+支持 v2 名称的 collector 嵌入 variants，WithNaming 通过 namingVariants 取得
+*/
+
+type variants map[*prometheus.Desc]*variant
+
+// newFuncMetric 创建 v1 Desc，v2Names 中有对应名称时同时记录 v2 变体
+func (vs variants) newFuncMetric(metricName string, docString string, variableLabels []string, constLabels prometheus.Labels) *prometheus.Desc {
+	desc := newFuncMetric(metricName, docString, variableLabels, constLabels)
+	if n, ok := v2Names[metricName]; ok {
+		vs[desc] = &variant{
+			desc:           prometheus.NewDesc(prometheus.BuildFQName(metricsNamespace, "", n.name), n.help, variableLabels, withConstLabels(constLabels)),
+			variableLabels: variableLabels,
+			scale:          n.scale,
+			valueType:      n.valueType,
+		}
+	}
+	return desc
+}
+
+func (vs variants) namingVariants() variants {
+	return vs
+}
+
+type namedCollector interface {
+	prometheus.Collector
+	namingVariants() variants
+}
+
+/**
+WithNaming 按 naming 输出 c 的指标，c 本身只需要使用 v1 名称；没有 v2 名称的 collector 原样返回
+*/
+
+func WithNaming(c prometheus.Collector, naming Naming) prometheus.Collector {
+	named, ok := c.(namedCollector)
+	if naming == NamingV1 || !ok {
+		return c
+	}
+	return &namingCollector{collector: c, naming: naming, variants: named.namingVariants()}
+}
+
+type namingCollector struct {
+	collector prometheus.Collector
+	naming    Naming
+	variants  variants
+}
+
+func (nc *namingCollector) Describe(ch chan<- *prometheus.Desc) {
+	descs := make(chan *prometheus.Desc)
+	go func() {
+		nc.collector.Describe(descs)
+		close(descs)
+	}()
+	for desc := range descs {
+		v := nc.variants[desc]
+		if v == nil || nc.naming == NamingBoth {
+			ch <- desc
+		}
+		if v != nil {
+			ch <- v.desc
+		}
+	}
+}
+
+func (nc *namingCollector) Collect(ch chan<- prometheus.Metric) {
+	metrics := make(chan prometheus.Metric)
+	go func() {
+		nc.collector.Collect(metrics)
+		close(metrics)
+	}()
+	for m := range metrics {
+		v := nc.variants[m.Desc()]
+		if v == nil || nc.naming == NamingBoth {
+			ch <- m
+		}
+		if v != nil {
+			if converted := v.convert(m); converted != nil {
+				ch <- converted
+			}
+		}
+	}
+}
+
+/**
+把 v1 指标换算为 v2 指标。YARN 用负数表示不适用（例如已结束应用的 allocatedMB 为 -1），v2 中不输出
+*/
+
+func (v *variant) convert(m prometheus.Metric) prometheus.Metric {
+	var pb dto.Metric
+	if err := m.Write(&pb); err != nil {
+		return prometheus.NewInvalidMetric(v.desc, err)
+	}
+
+	var value float64
+	var created *time.Time
+	if cm, ok := m.(*cumulativeMetric); ok {
+		created = &cm.created
+	}
+	switch {
+	case pb.Gauge != nil:
+		value = pb.Gauge.GetValue()
+	case pb.Counter != nil:
+		value = pb.Counter.GetValue()
+		if ts := pb.Counter.GetCreatedTimestamp(); ts != nil {
+			t := ts.AsTime()
+			created = &t
+		}
+	case pb.Untyped != nil:
+		value = pb.Untyped.GetValue()
+	default:
+		return prometheus.NewInvalidMetric(v.desc, fmt.Errorf("unsupported metric type for %s", v.desc))
+	}
+	if value < 0 {
+		return nil
+	}
+
+	labels := make(map[string]string, len(pb.Label))
+	for _, l := range pb.Label {
+		labels[l.GetName()] = l.GetValue()
+	}
+	labelValues := make([]string, 0, len(v.variableLabels))
+	for _, name := range v.variableLabels {
+		labelValues = append(labelValues, labels[name])
+	}
+
+	if created != nil && v.valueType == prometheus.CounterValue {
+		converted, err := prometheus.NewConstMetricWithCreatedTimestamp(v.desc, v.valueType, value*v.scale, *created, labelValues...)
+		if err != nil {
+			return prometheus.NewInvalidMetric(v.desc, err)
+		}
+		return converted
+	}
+	converted, err := prometheus.NewConstMetric(v.desc, v.valueType, value*v.scale, labelValues...)
+	if err != nil {
+		return prometheus.NewInvalidMetric(v.desc, err)
+	}
+	return converted
+}
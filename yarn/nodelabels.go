@@ -0,0 +1,90 @@
+package yarn
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"log"
+	"net/url"
+)
+
+/**
+定义 response body，兼容带 nodeLabelsInfo 根节点和不带根节点两种返回格式
+*/
+
+type nodeLabelsResponse struct {
+	NodeLabelsInfo nodeLabelsInfo `json:"nodeLabelsInfo"`
+	NodeLabelInfo  []*nodeLabel   `json:"nodeLabelInfo"`
+}
+type nodeLabelsInfo struct {
+	NodeLabelInfo []*nodeLabel `json:"nodeLabelInfo"`
+}
+type nodeLabel struct {
+	ActiveNMs     int           `json:"activeNMs"`
+	PartitionInfo partitionInfo `json:"partitionInfo"`
+	// 标签
+	Name        string `json:"name"`
+	Exclusivity bool   `json:"exclusivity"`
+}
+type partitionInfo struct {
+	ResourceAvailable resourcesUsed `json:"resourceAvailable"`
+}
+
+func (nc *NodeLabelsCollector) labels() []string {
+	var labels []string
+	return append(labels, "label", "exclusivity")
+}
+
+type NodeLabelsCollector struct {
+	variants
+	NodeLabelsEndpoint      *url.URL
+	ActiveNodes             *prometheus.Desc
+	ResourceAvailableMemory *prometheus.Desc
+	ResourceAvailableVCores *prometheus.Desc
+}
+
+func (nc *NodeLabelsCollector) Collect(ch chan<- prometheus.Metric) {
+	metrics, err := nc.fetch(nc.NodeLabelsEndpoint)
+	if err != nil {
+		log.Println("Error while collecting data from YARN: " + err.Error())
+		return
+	}
+	for _, l := range metrics {
+		labelValues := make([]string, 0, len(nc.labels()))
+		exclusivity := "false"
+		if l.Exclusivity {
+			exclusivity = "true"
+		}
+		labelValues = append(labelValues, l.Name, exclusivity)
+		ch <- prometheus.MustNewConstMetric(nc.ActiveNodes, prometheus.GaugeValue, float64(l.ActiveNMs), labelValues...)
+		ch <- prometheus.MustNewConstMetric(nc.ResourceAvailableMemory, prometheus.GaugeValue, float64(l.PartitionInfo.ResourceAvailable.Memory), labelValues...)
+		ch <- prometheus.MustNewConstMetric(nc.ResourceAvailableVCores, prometheus.GaugeValue, float64(l.PartitionInfo.ResourceAvailable.VCores), labelValues...)
+	}
+}
+
+func (nc *NodeLabelsCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- nc.ActiveNodes
+	ch <- nc.ResourceAvailableMemory
+	ch <- nc.ResourceAvailableVCores
+}
+
+func (nc *NodeLabelsCollector) fetch(u *url.URL) ([]*nodeLabel, error) {
+	var c nodeLabelsResponse
+	if err := fetchJSON(u, &c); err != nil {
+		return nil, err
+	}
+	if len(c.NodeLabelInfo) > 0 {
+		return c.NodeLabelInfo, nil
+	}
+	return c.NodeLabelsInfo.NodeLabelInfo, nil
+}
+
+func NewNodeLabelsCollector(endpoint *url.URL) *NodeLabelsCollector {
+	labels := new(NodeLabelsCollector).labels()
+	vs := make(variants)
+	return &NodeLabelsCollector{
+		variants:                vs,
+		NodeLabelsEndpoint:      endpoint,
+		ActiveNodes:             vs.newFuncMetric("node_label_active_nodes", "active node managers with the node label", labels, nil),
+		ResourceAvailableMemory: vs.newFuncMetric("node_label_resource_available_memory", "memory available in the node label partition", labels, nil),
+		ResourceAvailableVCores: vs.newFuncMetric("node_label_resource_available_v_cores", "cores available in the node label partition", labels, nil),
+	}
+}
@@ -0,0 +1,261 @@
+package yarn
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"log"
+	"net/url"
+	"strings"
+	"sync"
+)
+
+/**
+定义 response body
+*/
+
+type nodeManagerInfo struct {
+	NodeInfo nodeInfo `json:"nodeInfo"`
+}
+type nodeInfo struct {
+	NodeHealthy                    bool  `json:"nodeHealthy"`
+	LastNodeUpdateTime             int64 `json:"lastNodeUpdateTime"`
+	TotalVmemAllocatedContainersMB int   `json:"totalVmemAllocatedContainersMB"`
+	TotalPmemAllocatedContainersMB int   `json:"totalPmemAllocatedContainersMB"`
+	TotalVCoresAllocatedContainers int   `json:"totalVCoresAllocatedContainers"`
+	// 标签
+	NodeManagerVersion string `json:"nodeManagerVersion"`
+	HadoopVersion      string `json:"hadoopVersion"`
+	HealthReport       string `json:"healthReport"`
+}
+
+type nodeManagerContainers struct {
+	Containers containers `json:"containers"`
+}
+type containers struct {
+	Container []*container `json:"container"`
+}
+type container struct {
+	TotalMemoryNeededMB int `json:"totalMemoryNeededMB"`
+	TotalVCoresNeeded   int `json:"totalVCoresNeeded"`
+	// 标签
+	Id    string `json:"id"`
+	User  string `json:"user"`
+	State string `json:"state"`
+}
+
+func (nmc *NodeManagerCollector) labels() []string {
+	var labels []string
+	return append(labels, "node")
+}
+
+func (nmc *NodeManagerCollector) versionLabels() []string {
+	return append(nmc.labels(), "version", "hadoopVersion")
+}
+
+func (nmc *NodeManagerCollector) containerLabels() []string {
+	return append(nmc.labels(), "container", "user", "state")
+}
+
+func (nmc *NodeManagerCollector) stateLabels() []string {
+	return append(nmc.labels(), "state")
+}
+
+/**
+NodeManagers 为静态配置的 NM 地址（host:port），为空时通过 RM 的 nodes 接口发现 NM；
+每次采集最多同时请求 Concurrency 个 NM
+*/
+
+type NodeManagerCollector struct {
+	variants
+	NodeManagers  []string
+	NodesEndpoint *url.URL
+	Scheme        string
+	Concurrency   int
+	// node manager
+	Up                             *prometheus.Desc
+	Healthy                        *prometheus.Desc
+	Version                        *prometheus.Desc
+	LastNodeUpdateTime             *prometheus.Desc
+	TotalVmemAllocatedContainersMB *prometheus.Desc
+	TotalPmemAllocatedContainersMB *prometheus.Desc
+	TotalVCoresAllocatedContainers *prometheus.Desc
+	// container
+	Containers               *prometheus.Desc
+	ContainerMemoryAllocated *prometheus.Desc
+	ContainerVCoresAllocated *prometheus.Desc
+}
+
+func (nmc *NodeManagerCollector) Collect(ch chan<- prometheus.Metric) {
+	addresses, err := nmc.targets()
+	if err != nil {
+		log.Println("Error while discovering NodeManagers from YARN: " + err.Error())
+		return
+	}
+
+	workers := nmc.Concurrency
+	if workers <= 0 || workers > len(addresses) {
+		workers = len(addresses)
+	}
+	queue := make(chan string)
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for address := range queue {
+				nmc.collectNode(ch, address)
+			}
+		}()
+	}
+	for _, address := range addresses {
+		queue <- address
+	}
+	close(queue)
+	wg.Wait()
+}
+
+func (nmc *NodeManagerCollector) collectNode(ch chan<- prometheus.Metric, address string) {
+	up := 1.0
+	info, err := nmc.fetchInfo(address)
+	if err != nil {
+		up = 0.0
+		log.Println("Error while collecting data from NodeManager " + address + ": " + err.Error())
+	}
+	ch <- prometheus.MustNewConstMetric(nmc.Up, prometheus.GaugeValue, up, address)
+	if up == 0.0 {
+		return
+	}
+
+	healthy := 0.0
+	if info.NodeHealthy {
+		healthy = 1.0
+	}
+	ch <- prometheus.MustNewConstMetric(nmc.Healthy, prometheus.GaugeValue, healthy, address)
+	ch <- prometheus.MustNewConstMetric(nmc.Version, prometheus.GaugeValue, 1, address, info.NodeManagerVersion, info.HadoopVersion)
+	ch <- prometheus.MustNewConstMetric(nmc.LastNodeUpdateTime, prometheus.GaugeValue, float64(info.LastNodeUpdateTime)/1000, address)
+	ch <- prometheus.MustNewConstMetric(nmc.TotalVmemAllocatedContainersMB, prometheus.GaugeValue, float64(info.TotalVmemAllocatedContainersMB), address)
+	ch <- prometheus.MustNewConstMetric(nmc.TotalPmemAllocatedContainersMB, prometheus.GaugeValue, float64(info.TotalPmemAllocatedContainersMB), address)
+	ch <- prometheus.MustNewConstMetric(nmc.TotalVCoresAllocatedContainers, prometheus.GaugeValue, float64(info.TotalVCoresAllocatedContainers), address)
+
+	metrics, err := nmc.fetchContainers(address)
+	if err != nil {
+		log.Println("Error while collecting data from NodeManager " + address + ": " + err.Error())
+		return
+	}
+	// NM 只返回容器申请的资源，实际用量需要从 NM 的 ContainerResource JMX 获取
+	states := make(map[string]int)
+	for _, c := range metrics {
+		states[c.State]++
+		ch <- prometheus.MustNewConstMetric(nmc.ContainerMemoryAllocated, prometheus.GaugeValue, float64(c.TotalMemoryNeededMB), address, c.Id, c.User, c.State)
+		ch <- prometheus.MustNewConstMetric(nmc.ContainerVCoresAllocated, prometheus.GaugeValue, float64(c.TotalVCoresNeeded), address, c.Id, c.User, c.State)
+	}
+	for state, count := range states {
+		ch <- prometheus.MustNewConstMetric(nmc.Containers, prometheus.GaugeValue, float64(count), address, state)
+	}
+}
+
+func (nmc *NodeManagerCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- nmc.Up
+	ch <- nmc.Healthy
+	ch <- nmc.Version
+	ch <- nmc.LastNodeUpdateTime
+	ch <- nmc.TotalVmemAllocatedContainersMB
+	ch <- nmc.TotalPmemAllocatedContainersMB
+	ch <- nmc.TotalVCoresAllocatedContainers
+	ch <- nmc.Containers
+	ch <- nmc.ContainerMemoryAllocated
+	ch <- nmc.ContainerVCoresAllocated
+}
+
+// 发现时采集的节点状态。UNHEALTHY 的 NM 依然在运行，采集它才能让 nodemanager_healthy 报告 0
+var discoveredNodeStates = []string{"RUNNING", "UNHEALTHY", "DECOMMISSIONING"}
+
+/**
+需要采集的 NM 地址列表，去掉重复的地址，否则同一个 NM 的指标会重复导致整个 scrape 失败
+*/
+
+func (nmc *NodeManagerCollector) targets() ([]string, error) {
+	if len(nmc.NodeManagers) > 0 {
+		return uniqueAddresses(nmc.NodeManagers), nil
+	}
+	nodes, err := new(NodesCollector).fetch(nmc.NodesEndpoint)
+	if err != nil {
+		return nil, err
+	}
+	var addresses []string
+	for _, n := range nodes {
+		if contains(discoveredNodeStates, n.State) && n.NodeHTTPAddress != "" {
+			addresses = append(addresses, n.NodeHTTPAddress)
+		}
+	}
+	return uniqueAddresses(addresses), nil
+}
+
+func uniqueAddresses(addresses []string) []string {
+	seen := make(map[string]bool, len(addresses))
+	unique := make([]string, 0, len(addresses))
+	for _, address := range addresses {
+		if !seen[address] {
+			seen[address] = true
+			unique = append(unique, address)
+		}
+	}
+	return unique
+}
+
+func (nmc *NodeManagerCollector) endpoint(address string, path string) (*url.URL, error) {
+	if !strings.Contains(address, "://") {
+		address = nmc.Scheme + "://" + address
+	}
+	return url.Parse(strings.TrimSuffix(address, "/") + path)
+}
+
+func (nmc *NodeManagerCollector) fetchInfo(address string) (*nodeInfo, error) {
+	u, err := nmc.endpoint(address, "/ws/v1/node/info")
+	if err != nil {
+		return nil, err
+	}
+	var c nodeManagerInfo
+	if err := fetchJSON(u, &c); err != nil {
+		return nil, err
+	}
+	return &c.NodeInfo, nil
+}
+
+func (nmc *NodeManagerCollector) fetchContainers(address string) ([]*container, error) {
+	u, err := nmc.endpoint(address, "/ws/v1/node/containers")
+	if err != nil {
+		return nil, err
+	}
+	var c nodeManagerContainers
+	if err := fetchJSON(u, &c); err != nil {
+		return nil, err
+	}
+	return c.Containers.Container, nil
+}
+
+func NewNodeManagerCollector(nodeManagers []string, nodesEndpoint *url.URL, scheme string, concurrency int) *NodeManagerCollector {
+	labels := new(NodeManagerCollector).labels()
+	versionLabels := new(NodeManagerCollector).versionLabels()
+	containerLabels := new(NodeManagerCollector).containerLabels()
+	stateLabels := new(NodeManagerCollector).stateLabels()
+	vs := make(variants)
+	return &NodeManagerCollector{
+		variants:      vs,
+		NodeManagers:  nodeManagers,
+		NodesEndpoint: nodesEndpoint,
+		Scheme:        scheme,
+		Concurrency:   concurrency,
+		// node manager
+		Up:                             vs.newFuncMetric("nodemanager_up", "Able to contact the NodeManager", labels, nil),
+		Healthy:                        vs.newFuncMetric("nodemanager_healthy", "1 if the NodeManager reports itself healthy", labels, nil),
+		Version:                        vs.newFuncMetric("nodemanager_version_info", "NodeManager version", versionLabels, nil),
+		LastNodeUpdateTime:             vs.newFuncMetric("nodemanager_last_node_update_time", "last node health update, in unix seconds", labels, nil),
+		TotalVmemAllocatedContainersMB: vs.newFuncMetric("nodemanager_total_vmem_allocated_containers", "virtual memory allocated to containers :MB", labels, nil),
+		TotalPmemAllocatedContainersMB: vs.newFuncMetric("nodemanager_total_pmem_allocated_containers", "physical memory allocated to containers :MB", labels, nil),
+		TotalVCoresAllocatedContainers: vs.newFuncMetric("nodemanager_total_v_cores_allocated_containers", "cores allocated to containers", labels, nil),
+		// container
+		Containers:               vs.newFuncMetric("nodemanager_containers", "containers per state", stateLabels, nil),
+		ContainerMemoryAllocated: vs.newFuncMetric("nodemanager_container_allocated_memory", "memory allocated to the container, not its measured usage :MB", containerLabels, nil),
+		ContainerVCoresAllocated: vs.newFuncMetric("nodemanager_container_allocated_v_cores", "cores allocated to the container, not their measured usage", containerLabels, nil),
+	}
+}
@@ -0,0 +1,115 @@
+package yarn
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"log"
+	"net/url"
+)
+
+/**
+定义 response body
+*/
+
+type nodeList struct {
+	Nodes nodes `json:"nodes"`
+}
+type nodes struct {
+	Node []*node `json:"node"`
+}
+type node struct {
+	NumContainers         int           `json:"numContainers"`
+	UsedMemoryMB          int           `json:"usedMemoryMB"`
+	AvailMemoryMB         int           `json:"availMemoryMB"`
+	UsedVirtualCores      int           `json:"usedVirtualCores"`
+	AvailableVirtualCores int           `json:"availableVirtualCores"`
+	LastHealthUpdate      int64         `json:"lastHealthUpdate"`
+	TotalResource         resourcesUsed `json:"totalResource"`
+	UsedResource          resourcesUsed `json:"usedResource"`
+	AvailableResource     resourcesUsed `json:"availableResource"`
+	// 标签
+	Id              string `json:"id"`
+	Rack            string `json:"rack"`
+	State           string `json:"state"`
+	NodeHostName    string `json:"nodeHostName"`
+	NodeHTTPAddress string `json:"nodeHTTPAddress"`
+	HealthReport    string `json:"healthReport"`
+	Version         string `json:"version"`
+}
+
+func (nc *NodesCollector) labels() []string {
+	var labels []string
+	return append(labels, "id", "rack", "state", "nodeHostName")
+}
+
+type NodesCollector struct {
+	variants
+	NodesEndpoint     *url.URL
+	NumContainers     *prometheus.Desc
+	UsedMemory        *prometheus.Desc
+	AvailableMemory   *prometheus.Desc
+	UsedVCores        *prometheus.Desc
+	AvailableVCores   *prometheus.Desc
+	LastHealthUpdate  *prometheus.Desc
+	TotalResource     *prometheus.Desc
+	UsedResource      *prometheus.Desc
+	AvailableResource *prometheus.Desc
+}
+
+func (nc *NodesCollector) Collect(ch chan<- prometheus.Metric) {
+	metrics, err := nc.fetch(nc.NodesEndpoint)
+	if err != nil {
+		log.Println("Error while collecting data from YARN: " + err.Error())
+		return
+	}
+	for _, n := range metrics {
+		labelValues := make([]string, 0, len(nc.labels()))
+		labelValues = append(labelValues, n.Id, n.Rack, n.State, n.NodeHostName)
+		ch <- prometheus.MustNewConstMetric(nc.NumContainers, prometheus.GaugeValue, float64(n.NumContainers), labelValues...)
+		ch <- prometheus.MustNewConstMetric(nc.UsedMemory, prometheus.GaugeValue, float64(n.UsedMemoryMB), labelValues...)
+		ch <- prometheus.MustNewConstMetric(nc.AvailableMemory, prometheus.GaugeValue, float64(n.AvailMemoryMB), labelValues...)
+		ch <- prometheus.MustNewConstMetric(nc.UsedVCores, prometheus.GaugeValue, float64(n.UsedVirtualCores), labelValues...)
+		ch <- prometheus.MustNewConstMetric(nc.AvailableVCores, prometheus.GaugeValue, float64(n.AvailableVirtualCores), labelValues...)
+		ch <- prometheus.MustNewConstMetric(nc.LastHealthUpdate, prometheus.GaugeValue, float64(n.LastHealthUpdate)/1000, labelValues...)
+		collectResources(ch, nc.TotalResource, n.TotalResource, labelValues...)
+		collectResources(ch, nc.UsedResource, n.UsedResource, labelValues...)
+		collectResources(ch, nc.AvailableResource, n.AvailableResource, labelValues...)
+	}
+}
+
+func (nc *NodesCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- nc.NumContainers
+	ch <- nc.UsedMemory
+	ch <- nc.AvailableMemory
+	ch <- nc.UsedVCores
+	ch <- nc.AvailableVCores
+	ch <- nc.LastHealthUpdate
+	ch <- nc.TotalResource
+	ch <- nc.UsedResource
+	ch <- nc.AvailableResource
+}
+
+func (nc *NodesCollector) fetch(u *url.URL) ([]*node, error) {
+	var c nodeList
+	if err := fetchJSON(u, &c); err != nil {
+		return nil, err
+	}
+	return c.Nodes.Node, nil
+}
+
+func NewNodesCollector(endpoint *url.URL) *NodesCollector {
+	labels := new(NodesCollector).labels()
+	vs := make(variants)
+	return &NodesCollector{
+		variants:          vs,
+		NodesEndpoint:     endpoint,
+		NumContainers:     vs.newFuncMetric("node_num_containers", "containers running on the node", labels, nil),
+		UsedMemory:        vs.newFuncMetric("node_used_memory", "used memory of the node :MB", labels, nil),
+		AvailableMemory:   vs.newFuncMetric("node_available_memory", "available memory of the node :MB", labels, nil),
+		UsedVCores:        vs.newFuncMetric("node_used_v_cores", "used cores of the node", labels, nil),
+		AvailableVCores:   vs.newFuncMetric("node_available_v_cores", "available cores of the node", labels, nil),
+		LastHealthUpdate:  vs.newFuncMetric("node_last_health_update", "last health update of the node, in unix seconds", labels, nil),
+		TotalResource:     vs.newFuncMetric("node_total_resource", "total node resource per resource type", resourceLabels(labels), nil),
+		UsedResource:      vs.newFuncMetric("node_used_resource", "used node resource per resource type", resourceLabels(labels), nil),
+		AvailableResource: vs.newFuncMetric("node_available_resource", "available node resource per resource type", resourceLabels(labels), nil),
+	}
+}
@@ -0,0 +1,193 @@
+package yarn
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"log"
+	"net/url"
+	"sort"
+	"strconv"
+	"time"
+)
+
+/**
+定义 response body
+*/
+
+type reservationList struct {
+	Reservations []*reservation `json:"reservations"`
+}
+type reservation struct {
+	AcceptanceTime      int64                 `json:"acceptance-time"`
+	ResourceAllocations []*resourceAllocation `json:"resource-allocations"`
+	Definition          reservationDefinition `json:"reservation-definition"`
+	// 标签
+	Id   string `json:"reservation-id"`
+	User string `json:"user"`
+}
+type reservationDefinition struct {
+	Arrival  int64 `json:"arrival"`
+	Deadline int64 `json:"deadline"`
+	// 标签
+	Name string `json:"reservation-name"`
+}
+type resourceAllocation struct {
+	Resource  resourcesUsed `json:"resource"`
+	StartTime int64         `json:"startTime"`
+	EndTime   int64         `json:"endTime"`
+}
+
+/**
+预留的开始和结束时间，优先使用实际分配的时间段，没有分配时使用 arrival 和 deadline
+*/
+
+func (r *reservation) interval() (int64, int64) {
+	start, end := r.Definition.Arrival, r.Definition.Deadline
+	for i, a := range r.ResourceAllocations {
+		if i == 0 || a.StartTime < start {
+			start = a.StartTime
+		}
+		if i == 0 || a.EndTime > end {
+			end = a.EndTime
+		}
+	}
+	return start, end
+}
+
+/**
+当前时刻生效的预留资源，包括 resourceInformations 中的其它资源类型
+*/
+
+func (r *reservation) reservedAt(now int64) resourcesUsed {
+	var reserved resourcesUsed
+	for _, a := range r.ResourceAllocations {
+		if a.StartTime <= now && now < a.EndTime {
+			reserved.add(a.Resource)
+		}
+	}
+	return reserved
+}
+
+func (rc *ReservationCollector) labels() []string {
+	var labels []string
+	return append(labels, "queue")
+}
+
+func (rc *ReservationCollector) reservationLabels() []string {
+	return append(rc.labels(), "id", "name", "user")
+}
+
+/**
+分配时间段的指标在预留标签的基础上增加 allocation 标签，值为按开始时间排序后的序号
+*/
+
+func (rc *ReservationCollector) allocationLabels() []string {
+	return append(rc.reservationLabels(), "allocation")
+}
+
+type ReservationCollector struct {
+	variants
+	ReservationEndpoint *url.URL
+	PlanQueues          []string
+	Reservations        *prometheus.Desc
+	StartTime           *prometheus.Desc
+	EndTime             *prometheus.Desc
+	ReservedMemory      *prometheus.Desc
+	ReservedVCores      *prometheus.Desc
+	ReservedResource    *prometheus.Desc
+	// 当前和未来的分配时间段，用于画出预留容量随时间的变化
+	AllocationStartTime *prometheus.Desc
+	AllocationEndTime   *prometheus.Desc
+	AllocationMemory    *prometheus.Desc
+	AllocationVCores    *prometheus.Desc
+	AllocationResource  *prometheus.Desc
+}
+
+func (rc *ReservationCollector) Collect(ch chan<- prometheus.Metric) {
+	now := time.Now().UnixNano() / int64(time.Millisecond)
+	for _, queue := range rc.PlanQueues {
+		metrics, err := rc.fetch(rc.ReservationEndpoint, queue)
+		if err != nil {
+			log.Println("Error while collecting data from YARN: " + err.Error())
+			continue
+		}
+		ch <- prometheus.MustNewConstMetric(rc.Reservations, prometheus.GaugeValue, float64(len(metrics)), queue)
+		for _, r := range metrics {
+			labelValues := make([]string, 0, len(rc.reservationLabels()))
+			labelValues = append(labelValues, queue, r.Id, r.Definition.Name, r.User)
+			start, end := r.interval()
+			reserved := r.reservedAt(now)
+			ch <- prometheus.MustNewConstMetric(rc.StartTime, prometheus.GaugeValue, float64(start)/1000, labelValues...)
+			ch <- prometheus.MustNewConstMetric(rc.EndTime, prometheus.GaugeValue, float64(end)/1000, labelValues...)
+			ch <- prometheus.MustNewConstMetric(rc.ReservedMemory, prometheus.GaugeValue, float64(reserved.Memory), labelValues...)
+			ch <- prometheus.MustNewConstMetric(rc.ReservedVCores, prometheus.GaugeValue, float64(reserved.VCores), labelValues...)
+			collectResources(ch, rc.ReservedResource, reserved, labelValues...)
+
+			// 序号按开始时间排序，已经结束的分配不输出，但保留序号，避免之后的分配换标签
+			sort.SliceStable(r.ResourceAllocations, func(i, j int) bool {
+				return r.ResourceAllocations[i].StartTime < r.ResourceAllocations[j].StartTime
+			})
+			for i, a := range r.ResourceAllocations {
+				if a.EndTime <= now {
+					continue
+				}
+				allocationValues := append(labelValues[:len(labelValues):len(labelValues)], strconv.Itoa(i))
+				ch <- prometheus.MustNewConstMetric(rc.AllocationStartTime, prometheus.GaugeValue, float64(a.StartTime)/1000, allocationValues...)
+				ch <- prometheus.MustNewConstMetric(rc.AllocationEndTime, prometheus.GaugeValue, float64(a.EndTime)/1000, allocationValues...)
+				ch <- prometheus.MustNewConstMetric(rc.AllocationMemory, prometheus.GaugeValue, float64(a.Resource.Memory), allocationValues...)
+				ch <- prometheus.MustNewConstMetric(rc.AllocationVCores, prometheus.GaugeValue, float64(a.Resource.VCores), allocationValues...)
+				collectResources(ch, rc.AllocationResource, a.Resource, allocationValues...)
+			}
+		}
+	}
+}
+
+func (rc *ReservationCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- rc.Reservations
+	ch <- rc.StartTime
+	ch <- rc.EndTime
+	ch <- rc.ReservedMemory
+	ch <- rc.ReservedVCores
+	ch <- rc.ReservedResource
+	ch <- rc.AllocationStartTime
+	ch <- rc.AllocationEndTime
+	ch <- rc.AllocationMemory
+	ch <- rc.AllocationVCores
+	ch <- rc.AllocationResource
+}
+
+func (rc *ReservationCollector) fetch(u *url.URL, queue string) ([]*reservation, error) {
+	q := u.Query()
+	q.Set("queue", queue)
+	q.Set("include-resource-allocations", "true")
+	endpoint := *u
+	endpoint.RawQuery = q.Encode()
+
+	var c reservationList
+	if err := fetchJSON(&endpoint, &c); err != nil {
+		return nil, err
+	}
+	return c.Reservations, nil
+}
+
+func NewReservationCollector(endpoint *url.URL, planQueues []string) *ReservationCollector {
+	labels := new(ReservationCollector).labels()
+	reservationLabels := new(ReservationCollector).reservationLabels()
+	allocationLabels := new(ReservationCollector).allocationLabels()
+	vs := make(variants)
+	return &ReservationCollector{
+		variants:            vs,
+		ReservationEndpoint: endpoint,
+		PlanQueues:          planQueues,
+		Reservations:        vs.newFuncMetric("reservations", "reservations in the plan queue", labels, nil),
+		StartTime:           vs.newFuncMetric("reservation_start_time", "reservation start time, in unix seconds", reservationLabels, nil),
+		EndTime:             vs.newFuncMetric("reservation_end_time", "reservation end time, in unix seconds", reservationLabels, nil),
+		ReservedMemory:      vs.newFuncMetric("reservation_reserved_memory", "memory reserved at scrape time :MB", reservationLabels, nil),
+		ReservedVCores:      vs.newFuncMetric("reservation_reserved_v_cores", "cores reserved at scrape time", reservationLabels, nil),
+		ReservedResource:    vs.newFuncMetric("reservation_reserved_resource", "resource reserved at scrape time per resource type", resourceLabels(reservationLabels), nil),
+		AllocationStartTime: vs.newFuncMetric("reservation_allocation_start_time", "start time of a current or future reservation allocation, in unix seconds", allocationLabels, nil),
+		AllocationEndTime:   vs.newFuncMetric("reservation_allocation_end_time", "end time of a current or future reservation allocation, in unix seconds", allocationLabels, nil),
+		AllocationMemory:    vs.newFuncMetric("reservation_allocation_memory", "memory of a current or future reservation allocation :MB", allocationLabels, nil),
+		AllocationVCores:    vs.newFuncMetric("reservation_allocation_v_cores", "cores of a current or future reservation allocation", allocationLabels, nil),
+		AllocationResource:  vs.newFuncMetric("reservation_allocation_resource", "resource of a current or future reservation allocation per resource type", resourceLabels(allocationLabels), nil),
+	}
+}
@@ -0,0 +1,67 @@
+package yarn
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+/**
+YARN 的资源结构，memory 和 vCores 之外的资源类型（如 yarn.io/gpu）通过 resourceInformations 返回
+*/
+
+type resourcesUsed struct {
+	Memory               int                  `json:"memory"`
+	VCores               int                  `json:"vCores"`
+	ResourceInformations resourceInformations `json:"resourceInformations"`
+}
+type resourceInformations struct {
+	ResourceInformation []*resourceInformation `json:"resourceInformation"`
+}
+type resourceInformation struct {
+	Value int64 `json:"value"`
+	// 标签
+	Name         string `json:"name"`
+	Units        string `json:"units"`
+	ResourceType string `json:"resourceType"`
+}
+
+/**
+把 other 累加到 r 上，resourceInformation 按名称和单位累加
+*/
+
+func (r *resourcesUsed) add(other resourcesUsed) {
+	r.Memory += other.Memory
+	r.VCores += other.VCores
+	for _, o := range other.ResourceInformations.ResourceInformation {
+		var found *resourceInformation
+		for _, ri := range r.ResourceInformations.ResourceInformation {
+			if ri.Name == o.Name && ri.Units == o.Units {
+				found = ri
+				break
+			}
+		}
+		if found == nil {
+			found = &resourceInformation{Name: o.Name, Units: o.Units, ResourceType: o.ResourceType}
+			r.ResourceInformations.ResourceInformation = append(r.ResourceInformations.ResourceInformation, found)
+		}
+		found.Value += o.Value
+	}
+}
+
+/**
+资源指标在原有标签的基础上增加 resource 和 unit 标签
+*/
+
+func resourceLabels(labels []string) []string {
+	return append(labels[:len(labels):len(labels)], "resource", "unit")
+}
+
+/**
+按资源类型输出指标，每个 resourceInformation 对应一条
+*/
+
+func collectResources(ch chan<- prometheus.Metric, desc *prometheus.Desc, r resourcesUsed, labelValues ...string) {
+	for _, ri := range r.ResourceInformations.ResourceInformation {
+		values := append(labelValues[:len(labelValues):len(labelValues)], ri.Name, ri.Units)
+		ch <- prometheus.MustNewConstMetric(desc, prometheus.GaugeValue, float64(ri.Value), values...)
+	}
+}
@@ -1,16 +1,16 @@
 package yarn
 
 import (
-	"encoding/json"
-	"errors"
-	"fmt"
 	"github.com/prometheus/client_golang/prometheus"
-	"io"
 	"log"
-	"net/http"
 	"net/url"
 )
 
+const leafQueueType = "capacitySchedulerLeafQueueInfo"
+
+// 队列的所有状态，queue_state 指标对每个状态都输出一条，当前状态为 1，其余为 0
+var queueStates = []string{"RUNNING", "STOPPED", "DRAINING"}
+
 type queueMetrics struct {
 	Scheduler scheduler `json:"scheduler"`
 }
@@ -19,7 +19,8 @@ type scheduler struct {
 	SchedulerInfo schedulerInfo `json:"schedulerInfo"`
 }
 type schedulerInfo struct {
-	Queues queues `json:"queues"`
+	QueueName string `json:"queueName"`
+	Queues    queues `json:"queues"`
 }
 type queues struct {
 	Queue []*queue `json:"queue"`
@@ -34,23 +35,95 @@ type queue struct {
 	AbsoluteUsedCapacity float64       `json:"absoluteUsedCapacity"`
 	NumApplications      int           `json:"numApplications"`
 	ResourcesUsed        resourcesUsed `json:"resourcesUsed"`
+	// 按分区（node label）划分的容量和资源使用
+	Capacities queueCapacities `json:"capacities"`
+	Resources  queueResources  `json:"resources"`
+	// 叶子队列的应用数限制、AM 资源和用户限制
+	MaxApplications        int           `json:"maxApplications"`
+	MaxApplicationsPerUser int           `json:"maxApplicationsPerUser"`
+	NumPendingApplications int           `json:"numPendingApplications"`
+	NumActiveApplications  int           `json:"numActiveApplications"`
+	NumContainers          int           `json:"numContainers"`
+	AMResourceLimit        resourcesUsed `json:"AMResourceLimit"`
+	UsedAMResource         resourcesUsed `json:"usedAMResource"`
+	Users                  queueUsers    `json:"users"`
+	// 抢占和预留
+	PreemptionDisabled bool   `json:"preemptionDisabled"`
+	PendingContainers  int    `json:"pendingContainers"`
+	ReservedContainers int    `json:"reservedContainers"`
+	State              string `json:"state"`
+
+	// 父队列的子队列
+	Queues queues `json:"queues"`
 
 	// 标签
 	Type      string `json:"type"`
 	QueueName string `json:"queueName"`
+	QueuePath string `json:"queuePath"`
 }
-type resourcesUsed struct {
-	Memory int `json:"memory"`
-	VCores int `json:"vCores"`
+type queueUsers struct {
+	User []*queueUser `json:"user"`
+}
+type queueUser struct {
+	ResourcesUsed          resourcesUsed `json:"resourcesUsed"`
+	AMResourceUsed         resourcesUsed `json:"AMResourceUsed"`
+	UserResourceLimit      resourcesUsed `json:"userResourceLimit"`
+	NumActiveApplications  int           `json:"numActiveApplications"`
+	NumPendingApplications int           `json:"numPendingApplications"`
+	// 标签
+	Username string `json:"username"`
+}
+
+type queueCapacities struct {
+	QueueCapacitiesByPartition []*partitionCapacities `json:"queueCapacitiesByPartition"`
+}
+type partitionCapacities struct {
+	PartitionName        string  `json:"partitionName"`
+	Capacity             float64 `json:"capacity"`
+	UsedCapacity         float64 `json:"usedCapacity"`
+	MaxCapacity          float64 `json:"maxCapacity"`
+	AbsoluteCapacity     float64 `json:"absoluteCapacity"`
+	AbsoluteUsedCapacity float64 `json:"absoluteUsedCapacity"`
+	AbsoluteMaxCapacity  float64 `json:"absoluteMaxCapacity"`
+}
+
+type queueResources struct {
+	ResourceUsagesByPartition []*partitionResourceUsage `json:"resourceUsagesByPartition"`
+}
+type partitionResourceUsage struct {
+	PartitionName string        `json:"partitionName"`
+	Used          resourcesUsed `json:"used"`
+	Reserved      resourcesUsed `json:"reserved"`
 }
 
 func (sc *SchedulerCollector) labels() []string {
 	var labels []string
-	labels = append(labels, "queueName", "type")
+	labels = append(labels, "queueName", "queuePath", "type")
 	return labels
 }
 
+/**
+分区指标在队列标签的基础上增加 partition 标签，默认分区的 partition 为空字符串
+*/
+
+func (sc *SchedulerCollector) partitionLabels() []string {
+	return append(sc.labels(), "partition")
+}
+
+/**
+用户指标在队列标签的基础上增加 user 标签
+*/
+
+func (sc *SchedulerCollector) userLabels() []string {
+	return append(sc.labels(), "user")
+}
+
+func (sc *SchedulerCollector) stateLabels() []string {
+	return append(sc.labels(), "state")
+}
+
 type SchedulerCollector struct {
+	variants
 	// queue
 	SchedulerEndpoint    *url.URL
 	Capacity             *prometheus.Desc
@@ -62,6 +135,47 @@ type SchedulerCollector struct {
 	NumApplications      *prometheus.Desc
 	ResourcesUsedMemory  *prometheus.Desc
 	ResourcesUsedVCores  *prometheus.Desc
+	// partition
+	PartitionCapacity             *prometheus.Desc
+	PartitionUsedCapacity         *prometheus.Desc
+	PartitionMaxCapacity          *prometheus.Desc
+	PartitionAbsoluteCapacity     *prometheus.Desc
+	PartitionAbsoluteUsedCapacity *prometheus.Desc
+	PartitionAbsoluteMaxCapacity  *prometheus.Desc
+	PartitionResourcesUsedMemory  *prometheus.Desc
+	PartitionResourcesUsedVCores  *prometheus.Desc
+	PartitionReservedMemory       *prometheus.Desc
+	PartitionReservedVCores       *prometheus.Desc
+	// resource types
+	ResourceUsed          *prometheus.Desc
+	PartitionResourceUsed *prometheus.Desc
+	PartitionReserved     *prometheus.Desc
+	UserResourceUsed      *prometheus.Desc
+	// state
+	State *prometheus.Desc
+	// limits
+	MaxApplications        *prometheus.Desc
+	MaxApplicationsPerUser *prometheus.Desc
+	NumPendingApplications *prometheus.Desc
+	NumActiveApplications  *prometheus.Desc
+	NumContainers          *prometheus.Desc
+	AMResourceLimitMemory  *prometheus.Desc
+	AMResourceLimitVCores  *prometheus.Desc
+	UsedAMResourceMemory   *prometheus.Desc
+	UsedAMResourceVCores   *prometheus.Desc
+	// user
+	UserResourcesUsedMemory    *prometheus.Desc
+	UserResourcesUsedVCores    *prometheus.Desc
+	UserAMResourceUsedMemory   *prometheus.Desc
+	UserAMResourceUsedVCores   *prometheus.Desc
+	UserResourceLimitMemory    *prometheus.Desc
+	UserResourceLimitVCores    *prometheus.Desc
+	UserNumActiveApplications  *prometheus.Desc
+	UserNumPendingApplications *prometheus.Desc
+	// preemption and reservation
+	PreemptionDisabled *prometheus.Desc
+	PendingContainers  *prometheus.Desc
+	ReservedContainers *prometheus.Desc
 }
 
 func (sc *SchedulerCollector) Collect(ch chan<- prometheus.Metric) {
@@ -73,7 +187,7 @@ func (sc *SchedulerCollector) Collect(ch chan<- prometheus.Metric) {
 	}
 	for _, a := range metrics {
 		labelValues := make([]string, 0, len(sc.labels()))
-		labelValues = append(labelValues, a.QueueName, a.Type)
+		labelValues = append(labelValues, a.QueueName, a.QueuePath, a.Type)
 		ch <- prometheus.MustNewConstMetric(sc.Capacity, prometheus.GaugeValue, a.Capacity, labelValues...)
 		ch <- prometheus.MustNewConstMetric(sc.MaxCapacity, prometheus.GaugeValue, a.MaxCapacity, labelValues...)
 		ch <- prometheus.MustNewConstMetric(sc.UsedCapacity, prometheus.GaugeValue, a.UsedCapacity, labelValues...)
@@ -83,7 +197,71 @@ func (sc *SchedulerCollector) Collect(ch chan<- prometheus.Metric) {
 		ch <- prometheus.MustNewConstMetric(sc.AbsoluteMaxCapacity, prometheus.GaugeValue, a.AbsoluteMaxCapacity, labelValues...)
 		ch <- prometheus.MustNewConstMetric(sc.ResourcesUsedMemory, prometheus.GaugeValue, float64(a.ResourcesUsed.Memory), labelValues...)
 		ch <- prometheus.MustNewConstMetric(sc.ResourcesUsedVCores, prometheus.GaugeValue, float64(a.ResourcesUsed.VCores), labelValues...)
+		collectResources(ch, sc.ResourceUsed, a.ResourcesUsed, labelValues...)
+
+		for _, p := range a.Capacities.QueueCapacitiesByPartition {
+			partitionValues := append(labelValues[:len(labelValues):len(labelValues)], p.PartitionName)
+			ch <- prometheus.MustNewConstMetric(sc.PartitionCapacity, prometheus.GaugeValue, p.Capacity, partitionValues...)
+			ch <- prometheus.MustNewConstMetric(sc.PartitionUsedCapacity, prometheus.GaugeValue, p.UsedCapacity, partitionValues...)
+			ch <- prometheus.MustNewConstMetric(sc.PartitionMaxCapacity, prometheus.GaugeValue, p.MaxCapacity, partitionValues...)
+			ch <- prometheus.MustNewConstMetric(sc.PartitionAbsoluteCapacity, prometheus.GaugeValue, p.AbsoluteCapacity, partitionValues...)
+			ch <- prometheus.MustNewConstMetric(sc.PartitionAbsoluteUsedCapacity, prometheus.GaugeValue, p.AbsoluteUsedCapacity, partitionValues...)
+			ch <- prometheus.MustNewConstMetric(sc.PartitionAbsoluteMaxCapacity, prometheus.GaugeValue, p.AbsoluteMaxCapacity, partitionValues...)
+		}
+		for _, p := range a.Resources.ResourceUsagesByPartition {
+			partitionValues := append(labelValues[:len(labelValues):len(labelValues)], p.PartitionName)
+			ch <- prometheus.MustNewConstMetric(sc.PartitionResourcesUsedMemory, prometheus.GaugeValue, float64(p.Used.Memory), partitionValues...)
+			ch <- prometheus.MustNewConstMetric(sc.PartitionResourcesUsedVCores, prometheus.GaugeValue, float64(p.Used.VCores), partitionValues...)
+			ch <- prometheus.MustNewConstMetric(sc.PartitionReservedMemory, prometheus.GaugeValue, float64(p.Reserved.Memory), partitionValues...)
+			ch <- prometheus.MustNewConstMetric(sc.PartitionReservedVCores, prometheus.GaugeValue, float64(p.Reserved.VCores), partitionValues...)
+			collectResources(ch, sc.PartitionResourceUsed, p.Used, partitionValues...)
+			collectResources(ch, sc.PartitionReserved, p.Reserved, partitionValues...)
+		}
+
+		if a.State != "" {
+			for _, state := range queueStates {
+				value := 0.0
+				if a.State == state {
+					value = 1.0
+				}
+				ch <- prometheus.MustNewConstMetric(sc.State, prometheus.GaugeValue, value, append(labelValues[:len(labelValues):len(labelValues)], state)...)
+			}
+		}
+
+		preemptionDisabled := 0.0
+		if a.PreemptionDisabled {
+			preemptionDisabled = 1.0
+		}
+		ch <- prometheus.MustNewConstMetric(sc.PreemptionDisabled, prometheus.GaugeValue, preemptionDisabled, labelValues...)
+		ch <- prometheus.MustNewConstMetric(sc.PendingContainers, prometheus.GaugeValue, float64(a.PendingContainers), labelValues...)
+		ch <- prometheus.MustNewConstMetric(sc.ReservedContainers, prometheus.GaugeValue, float64(a.ReservedContainers), labelValues...)
 
+		// 只有叶子队列才会返回应用数限制、AM 资源和用户信息
+		if a.Type != leafQueueType {
+			continue
+		}
+		ch <- prometheus.MustNewConstMetric(sc.MaxApplications, prometheus.GaugeValue, float64(a.MaxApplications), labelValues...)
+		ch <- prometheus.MustNewConstMetric(sc.MaxApplicationsPerUser, prometheus.GaugeValue, float64(a.MaxApplicationsPerUser), labelValues...)
+		ch <- prometheus.MustNewConstMetric(sc.NumPendingApplications, prometheus.GaugeValue, float64(a.NumPendingApplications), labelValues...)
+		ch <- prometheus.MustNewConstMetric(sc.NumActiveApplications, prometheus.GaugeValue, float64(a.NumActiveApplications), labelValues...)
+		ch <- prometheus.MustNewConstMetric(sc.NumContainers, prometheus.GaugeValue, float64(a.NumContainers), labelValues...)
+		ch <- prometheus.MustNewConstMetric(sc.AMResourceLimitMemory, prometheus.GaugeValue, float64(a.AMResourceLimit.Memory), labelValues...)
+		ch <- prometheus.MustNewConstMetric(sc.AMResourceLimitVCores, prometheus.GaugeValue, float64(a.AMResourceLimit.VCores), labelValues...)
+		ch <- prometheus.MustNewConstMetric(sc.UsedAMResourceMemory, prometheus.GaugeValue, float64(a.UsedAMResource.Memory), labelValues...)
+		ch <- prometheus.MustNewConstMetric(sc.UsedAMResourceVCores, prometheus.GaugeValue, float64(a.UsedAMResource.VCores), labelValues...)
+
+		for _, u := range a.Users.User {
+			userValues := append(labelValues[:len(labelValues):len(labelValues)], u.Username)
+			ch <- prometheus.MustNewConstMetric(sc.UserResourcesUsedMemory, prometheus.GaugeValue, float64(u.ResourcesUsed.Memory), userValues...)
+			ch <- prometheus.MustNewConstMetric(sc.UserResourcesUsedVCores, prometheus.GaugeValue, float64(u.ResourcesUsed.VCores), userValues...)
+			ch <- prometheus.MustNewConstMetric(sc.UserAMResourceUsedMemory, prometheus.GaugeValue, float64(u.AMResourceUsed.Memory), userValues...)
+			ch <- prometheus.MustNewConstMetric(sc.UserAMResourceUsedVCores, prometheus.GaugeValue, float64(u.AMResourceUsed.VCores), userValues...)
+			ch <- prometheus.MustNewConstMetric(sc.UserResourceLimitMemory, prometheus.GaugeValue, float64(u.UserResourceLimit.Memory), userValues...)
+			ch <- prometheus.MustNewConstMetric(sc.UserResourceLimitVCores, prometheus.GaugeValue, float64(u.UserResourceLimit.VCores), userValues...)
+			ch <- prometheus.MustNewConstMetric(sc.UserNumActiveApplications, prometheus.GaugeValue, float64(u.NumActiveApplications), userValues...)
+			ch <- prometheus.MustNewConstMetric(sc.UserNumPendingApplications, prometheus.GaugeValue, float64(u.NumPendingApplications), userValues...)
+			collectResources(ch, sc.UserResourceUsed, u.ResourcesUsed, userValues...)
+		}
 	}
 
 }
@@ -98,57 +276,129 @@ func (sc *SchedulerCollector) Describe(ch chan<- *prometheus.Desc) {
 	ch <- sc.NumApplications
 	ch <- sc.ResourcesUsedMemory
 	ch <- sc.ResourcesUsedVCores
+	ch <- sc.PartitionCapacity
+	ch <- sc.PartitionUsedCapacity
+	ch <- sc.PartitionMaxCapacity
+	ch <- sc.PartitionAbsoluteCapacity
+	ch <- sc.PartitionAbsoluteUsedCapacity
+	ch <- sc.PartitionAbsoluteMaxCapacity
+	ch <- sc.PartitionResourcesUsedMemory
+	ch <- sc.PartitionResourcesUsedVCores
+	ch <- sc.PartitionReservedMemory
+	ch <- sc.PartitionReservedVCores
+	ch <- sc.ResourceUsed
+	ch <- sc.PartitionResourceUsed
+	ch <- sc.PartitionReserved
+	ch <- sc.UserResourceUsed
+	ch <- sc.State
+	ch <- sc.MaxApplications
+	ch <- sc.MaxApplicationsPerUser
+	ch <- sc.NumPendingApplications
+	ch <- sc.NumActiveApplications
+	ch <- sc.NumContainers
+	ch <- sc.AMResourceLimitMemory
+	ch <- sc.AMResourceLimitVCores
+	ch <- sc.UsedAMResourceMemory
+	ch <- sc.UsedAMResourceVCores
+	ch <- sc.UserResourcesUsedMemory
+	ch <- sc.UserResourcesUsedVCores
+	ch <- sc.UserAMResourceUsedMemory
+	ch <- sc.UserAMResourceUsedVCores
+	ch <- sc.UserResourceLimitMemory
+	ch <- sc.UserResourceLimitVCores
+	ch <- sc.UserNumActiveApplications
+	ch <- sc.UserNumPendingApplications
+	ch <- sc.PreemptionDisabled
+	ch <- sc.PendingContainers
+	ch <- sc.ReservedContainers
 }
 
 func (sc *SchedulerCollector) fetch(u *url.URL) ([]*queue, error) {
-	req := http.Request{
-		Method:     "GET",
-		URL:        u,
-		Proto:      "HTTP/1.1",
-		ProtoMajor: 1,
-		ProtoMinor: 1,
-		Header:     make(http.Header),
-		Host:       u.Host,
-	}
-
-	resp, err := http.DefaultClient.Do(&req)
-	if err != nil {
+	var c queueMetrics
+	if err := fetchJSON(u, &c); err != nil {
 		return nil, err
 	}
-
-	defer func(Body io.ReadCloser) {
-		err := Body.Close()
-		if err != nil {
-			log.Fatal("response body error: " + err.Error())
-		}
-	}(resp.Body)
-
-	if resp.StatusCode != 200 {
-		return nil, errors.New(fmt.Sprintf("unexpected HTTP status: %v", resp.StatusCode))
+	root := c.Scheduler.SchedulerInfo.QueueName
+	if root == "" {
+		root = "root"
 	}
+	return flattenQueues(root, c.Scheduler.SchedulerInfo.Queues.Queue, nil), nil
+}
 
-	var c queueMetrics
-	err = json.NewDecoder(resp.Body).Decode(&c)
-	if err != nil {
-		return nil, err
-	}
+/**
+按深度优先展开队列树，父队列在子队列之前。Hadoop 3.x 返回 queuePath，2.x 没有时由父队列的路径拼接
+*/
 
-	return c.Scheduler.SchedulerInfo.Queues.Queue, nil
+func flattenQueues(parent string, children []*queue, all []*queue) []*queue {
+	for _, q := range children {
+		if q.QueuePath == "" {
+			q.QueuePath = parent + "." + q.QueueName
+		}
+		all = append(all, q)
+		all = flattenQueues(q.QueuePath, q.Queues.Queue, all)
+	}
+	return all
 }
 
 func NewSchedulerCollector(endpoint *url.URL) *SchedulerCollector {
 	labels := new(SchedulerCollector).labels()
+	partitionLabels := new(SchedulerCollector).partitionLabels()
+	userLabels := new(SchedulerCollector).userLabels()
+	stateLabels := new(SchedulerCollector).stateLabels()
+	vs := make(variants)
 	return &SchedulerCollector{
+		variants: vs,
 		// queue
 		SchedulerEndpoint:    endpoint,
-		Capacity:             newFuncMetric("capacity", "capacity percentage", labels, nil),
-		MaxCapacity:          newFuncMetric("max_capacity", "max capacity", labels, nil),
-		UsedCapacity:         newFuncMetric("used_capacity", "used capacity", labels, nil),
-		AbsoluteCapacity:     newFuncMetric("absolute_capacity", "used capacity", labels, nil),
-		AbsoluteMaxCapacity:  newFuncMetric("absolute_max_capacity", "used capacity", labels, nil),
-		AbsoluteUsedCapacity: newFuncMetric("absolute_used_capacity", "used capacity", labels, nil),
-		NumApplications:      newFuncMetric("num_applications", "queue running number applications", labels, nil),
-		ResourcesUsedMemory:  newFuncMetric("resources_used_memory", "used memory", labels, nil),
-		ResourcesUsedVCores:  newFuncMetric("resources_used_v_cores", "used cores", labels, nil),
+		Capacity:             vs.newFuncMetric("capacity", "capacity percentage", labels, nil),
+		MaxCapacity:          vs.newFuncMetric("max_capacity", "max capacity", labels, nil),
+		UsedCapacity:         vs.newFuncMetric("used_capacity", "used capacity", labels, nil),
+		AbsoluteCapacity:     vs.newFuncMetric("absolute_capacity", "used capacity", labels, nil),
+		AbsoluteMaxCapacity:  vs.newFuncMetric("absolute_max_capacity", "used capacity", labels, nil),
+		AbsoluteUsedCapacity: vs.newFuncMetric("absolute_used_capacity", "used capacity", labels, nil),
+		NumApplications:      vs.newFuncMetric("num_applications", "queue running number applications", labels, nil),
+		ResourcesUsedMemory:  vs.newFuncMetric("resources_used_memory", "used memory", labels, nil),
+		ResourcesUsedVCores:  vs.newFuncMetric("resources_used_v_cores", "used cores", labels, nil),
+		// partition
+		PartitionCapacity:             vs.newFuncMetric("partition_capacity", "capacity percentage per partition", partitionLabels, nil),
+		PartitionUsedCapacity:         vs.newFuncMetric("partition_used_capacity", "used capacity per partition", partitionLabels, nil),
+		PartitionMaxCapacity:          vs.newFuncMetric("partition_max_capacity", "max capacity per partition", partitionLabels, nil),
+		PartitionAbsoluteCapacity:     vs.newFuncMetric("partition_absolute_capacity", "absolute capacity per partition", partitionLabels, nil),
+		PartitionAbsoluteUsedCapacity: vs.newFuncMetric("partition_absolute_used_capacity", "absolute used capacity per partition", partitionLabels, nil),
+		PartitionAbsoluteMaxCapacity:  vs.newFuncMetric("partition_absolute_max_capacity", "absolute max capacity per partition", partitionLabels, nil),
+		PartitionResourcesUsedMemory:  vs.newFuncMetric("partition_resources_used_memory", "used memory per partition", partitionLabels, nil),
+		PartitionResourcesUsedVCores:  vs.newFuncMetric("partition_resources_used_v_cores", "used cores per partition", partitionLabels, nil),
+		PartitionReservedMemory:       vs.newFuncMetric("partition_reserved_memory", "reserved memory per partition", partitionLabels, nil),
+		PartitionReservedVCores:       vs.newFuncMetric("partition_reserved_v_cores", "reserved cores per partition", partitionLabels, nil),
+		// resource types
+		ResourceUsed:          vs.newFuncMetric("queue_used_resource", "used resource per resource type", resourceLabels(labels), nil),
+		PartitionResourceUsed: vs.newFuncMetric("partition_used_resource", "used resource per partition and resource type", resourceLabels(partitionLabels), nil),
+		PartitionReserved:     vs.newFuncMetric("partition_reserved_resource", "reserved resource per partition and resource type", resourceLabels(partitionLabels), nil),
+		UserResourceUsed:      vs.newFuncMetric("user_used_resource", "used resource per user and resource type", resourceLabels(userLabels), nil),
+		// state
+		State: vs.newFuncMetric("queue_state", "queue state, 1 for the current state", stateLabels, nil),
+		// limits
+		MaxApplications:        vs.newFuncMetric("max_applications", "max applications of the queue", labels, nil),
+		MaxApplicationsPerUser: vs.newFuncMetric("max_applications_per_user", "max applications per user of the queue", labels, nil),
+		NumPendingApplications: vs.newFuncMetric("num_pending_applications", "queue pending number applications", labels, nil),
+		NumActiveApplications:  vs.newFuncMetric("num_active_applications", "queue active number applications", labels, nil),
+		NumContainers:          vs.newFuncMetric("num_containers", "queue number containers", labels, nil),
+		AMResourceLimitMemory:  vs.newFuncMetric("am_resource_limit_memory", "application master memory limit", labels, nil),
+		AMResourceLimitVCores:  vs.newFuncMetric("am_resource_limit_v_cores", "application master cores limit", labels, nil),
+		UsedAMResourceMemory:   vs.newFuncMetric("used_am_resource_memory", "application master used memory", labels, nil),
+		UsedAMResourceVCores:   vs.newFuncMetric("used_am_resource_v_cores", "application master used cores", labels, nil),
+		// user
+		UserResourcesUsedMemory:    vs.newFuncMetric("user_resources_used_memory", "used memory per user", userLabels, nil),
+		UserResourcesUsedVCores:    vs.newFuncMetric("user_resources_used_v_cores", "used cores per user", userLabels, nil),
+		UserAMResourceUsedMemory:   vs.newFuncMetric("user_am_resource_used_memory", "application master used memory per user", userLabels, nil),
+		UserAMResourceUsedVCores:   vs.newFuncMetric("user_am_resource_used_v_cores", "application master used cores per user", userLabels, nil),
+		UserResourceLimitMemory:    vs.newFuncMetric("user_resource_limit_memory", "user limit memory", userLabels, nil),
+		UserResourceLimitVCores:    vs.newFuncMetric("user_resource_limit_v_cores", "user limit cores", userLabels, nil),
+		UserNumActiveApplications:  vs.newFuncMetric("user_num_active_applications", "active number applications per user", userLabels, nil),
+		UserNumPendingApplications: vs.newFuncMetric("user_num_pending_applications", "pending number applications per user", userLabels, nil),
+		// preemption and reservation
+		PreemptionDisabled: vs.newFuncMetric("preemption_disabled", "1 if preemption is disabled for the queue", labels, nil),
+		PendingContainers:  vs.newFuncMetric("pending_containers", "queue pending containers", labels, nil),
+		ReservedContainers: vs.newFuncMetric("reserved_containers", "queue reserved containers", labels, nil),
 	}
 }
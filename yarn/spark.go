@@ -0,0 +1,189 @@
+package yarn
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"log"
+	"net/url"
+	"sync"
+	"time"
+)
+
+/**
+定义 Spark REST API 的 response body
+*/
+
+type sparkApplication struct {
+	Attempts []*sparkAttempt `json:"attempts"`
+}
+type sparkAttempt struct {
+	AttemptId string `json:"attemptId"`
+}
+type sparkExecutor struct {
+	Id                string `json:"id"`
+	IsActive          bool   `json:"isActive"`
+	FailedTasks       int    `json:"failedTasks"`
+	CompletedTasks    int    `json:"completedTasks"`
+	TotalGCTime       int64  `json:"totalGCTime"`
+	TotalShuffleRead  int64  `json:"totalShuffleRead"`
+	TotalShuffleWrite int64  `json:"totalShuffleWrite"`
+}
+type sparkStage struct {
+	Status string `json:"status"`
+}
+
+// 同时请求 Spark REST API 的应用数上限
+const sparkConcurrency = 8
+
+func (sc *SparkCollector) labels() []string {
+	var labels []string
+	return append(labels, "id", "queue", "user")
+}
+
+func (sc *SparkCollector) stageLabels() []string {
+	return append(sc.labels(), "status")
+}
+
+/**
+SparkCollector 对 ApplicationCollector 最近拉取的 RUNNING 状态 SPARK 应用请求 Spark REST API。
+HistoryServer 为空时通过应用的 trackingUrl（RM proxy）访问 driver，否则访问 Spark History Server
+*/
+
+type SparkCollector struct {
+	Apps           *ApplicationCollector
+	HistoryServer  *url.URL
+	Executors      *prometheus.Desc
+	FailedTasks    *prometheus.Desc
+	CompletedTasks *prometheus.Desc
+	ShuffleRead    *prometheus.Desc
+	ShuffleWrite   *prometheus.Desc
+	GCTime         *prometheus.Desc
+	Stages         *prometheus.Desc
+}
+
+func (sc *SparkCollector) Collect(ch chan<- prometheus.Metric) {
+	apps, err := sc.Apps.latest()
+	if err != nil {
+		log.Println("Error while collecting data from YARN: " + err.Error())
+		return
+	}
+
+	var wg sync.WaitGroup
+	semaphore := make(chan struct{}, sparkConcurrency)
+	for _, a := range apps {
+		if a.ApplicationType != "SPARK" || a.State != "RUNNING" {
+			continue
+		}
+		wg.Add(1)
+		semaphore <- struct{}{}
+		go func(a *application) {
+			defer wg.Done()
+			defer func() { <-semaphore }()
+			if err := sc.collectApplication(ch, a); err != nil {
+				log.Println("Error while collecting data from Spark application " + a.Id + ": " + err.Error())
+			}
+		}(a)
+	}
+	wg.Wait()
+}
+
+func (sc *SparkCollector) collectApplication(ch chan<- prometheus.Metric, a *application) error {
+	base, err := sc.applicationUrl(a)
+	if err != nil {
+		return err
+	}
+
+	var executors []*sparkExecutor
+	// allexecutors 包含已经退出的 executor，累计值不会因为 executor 退出而下降
+	if err := fetchJSON(joinPath(base, "allexecutors"), &executors); err != nil {
+		return err
+	}
+	var stages []*sparkStage
+	if err := fetchJSON(joinPath(base, "stages"), &stages); err != nil {
+		return err
+	}
+
+	labelValues := make([]string, 0, len(sc.labels()))
+	labelValues = append(labelValues, a.Id, a.Queue, a.User)
+	var created time.Time
+	if a.StartedTime > 0 {
+		created = time.UnixMilli(a.StartedTime)
+	}
+	var active, failed, completed int
+	var gcTime, shuffleRead, shuffleWrite int64
+	for _, e := range executors {
+		if e.IsActive && e.Id != "driver" {
+			active++
+		}
+		failed += e.FailedTasks
+		completed += e.CompletedTasks
+		gcTime += e.TotalGCTime
+		shuffleRead += e.TotalShuffleRead
+		shuffleWrite += e.TotalShuffleWrite
+	}
+	ch <- prometheus.MustNewConstMetric(sc.Executors, prometheus.GaugeValue, float64(active), labelValues...)
+	ch <- newCounterMetric(sc.FailedTasks, float64(failed), created, labelValues...)
+	ch <- newCounterMetric(sc.CompletedTasks, float64(completed), created, labelValues...)
+	ch <- newCounterMetric(sc.ShuffleRead, float64(shuffleRead), created, labelValues...)
+	ch <- newCounterMetric(sc.ShuffleWrite, float64(shuffleWrite), created, labelValues...)
+	ch <- newCounterMetric(sc.GCTime, float64(gcTime)/1000, created, labelValues...)
+
+	statuses := make(map[string]int)
+	for _, s := range stages {
+		statuses[s.Status]++
+	}
+	for status, count := range statuses {
+		ch <- prometheus.MustNewConstMetric(sc.Stages, prometheus.GaugeValue, float64(count), append(labelValues, status)...)
+	}
+	return nil
+}
+
+func (sc *SparkCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- sc.Executors
+	ch <- sc.FailedTasks
+	ch <- sc.CompletedTasks
+	ch <- sc.ShuffleRead
+	ch <- sc.ShuffleWrite
+	ch <- sc.GCTime
+	ch <- sc.Stages
+}
+
+/**
+应用在 Spark REST API 中的地址，cluster 模式下需要带上最后一次 attempt 的 id
+*/
+
+func (sc *SparkCollector) applicationUrl(a *application) (*url.URL, error) {
+	base := sc.HistoryServer
+	if base == nil {
+		u, err := url.Parse(a.TrackingUrl)
+		if err != nil {
+			return nil, err
+		}
+		base = u
+	}
+	app := joinPath(base, "api/v1/applications/"+a.Id)
+
+	var info sparkApplication
+	if err := fetchJSON(app, &info); err != nil {
+		return nil, err
+	}
+	if n := len(info.Attempts); n > 0 && info.Attempts[n-1].AttemptId != "" {
+		app = joinPath(app, info.Attempts[n-1].AttemptId)
+	}
+	return app, nil
+}
+
+func NewSparkCollector(apps *ApplicationCollector, historyServer *url.URL) *SparkCollector {
+	labels := new(SparkCollector).labels()
+	stageLabels := new(SparkCollector).stageLabels()
+	return &SparkCollector{
+		Apps:           apps,
+		HistoryServer:  historyServer,
+		Executors:      newFuncMetric("spark_executors", "active executors of the Spark application", labels, nil),
+		FailedTasks:    newFuncMetric("spark_failed_tasks_total", "failed tasks of the Spark application", labels, nil),
+		CompletedTasks: newFuncMetric("spark_completed_tasks_total", "completed tasks of the Spark application", labels, nil),
+		ShuffleRead:    newFuncMetric("spark_shuffle_read_bytes_total", "shuffle bytes read by the Spark application", labels, nil),
+		ShuffleWrite:   newFuncMetric("spark_shuffle_write_bytes_total", "shuffle bytes written by the Spark application", labels, nil),
+		GCTime:         newFuncMetric("spark_gc_time_seconds_total", "executor GC time of the Spark application", labels, nil),
+		Stages:         newFuncMetric("spark_stages", "stages of the Spark application per status", stageLabels, nil),
+	}
+}
@@ -0,0 +1,237 @@
+package yarn
+
+import (
+	"errors"
+	"github.com/prometheus/client_golang/prometheus"
+	bolt "go.etcd.io/bbolt"
+	"log"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+/**
+StateStore 按 key 保存 collector 的状态，Load 在 key 不存在时返回 nil
+*/
+
+type StateStore interface {
+	Load(key string) ([]byte, error)
+	Save(key string, data []byte) error
+	Close() error
+}
+
+/**
+Stateful 是需要在重启后恢复状态的 collector，StateKey 在同一个 StateStore 中必须唯一
+*/
+
+type Stateful interface {
+	StateKey() string
+	Snapshot() ([]byte, error)
+	Restore(data []byte) error
+}
+
+/**
+FileStateStore 把每个 key 的状态保存为目录下的一个文件
+*/
+
+type FileStateStore struct {
+	Dir string
+}
+
+func NewFileStateStore(dir string) (*FileStateStore, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	return &FileStateStore{Dir: dir}, nil
+}
+
+func (fs *FileStateStore) Load(key string) ([]byte, error) {
+	data, err := os.ReadFile(filepath.Join(fs.Dir, key+".json"))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	return data, err
+}
+
+/**
+先写临时文件并刷盘再重命名，避免进程或机器中途退出时留下不完整的状态文件
+*/
+
+func (fs *FileStateStore) Save(key string, data []byte) error {
+	tmp, err := os.CreateTemp(fs.Dir, key+".json.tmp")
+	if err != nil {
+		return err
+	}
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	return os.Rename(tmp.Name(), filepath.Join(fs.Dir, key+".json"))
+}
+
+func (fs *FileStateStore) Close() error {
+	return nil
+}
+
+var stateBucket = []byte("state")
+
+/**
+BoltStateStore 把所有 key 保存在一个 BoltDB 文件中
+*/
+
+type BoltStateStore struct {
+	db *bolt.DB
+}
+
+func NewBoltStateStore(path string) (*BoltStateStore, error) {
+	db, err := bolt.Open(path, 0644, &bolt.Options{Timeout: time.Second})
+	if err != nil {
+		return nil, err
+	}
+	err = db.Update(func(tx *bolt.Tx) error {
+		_, err := tx.CreateBucketIfNotExists(stateBucket)
+		return err
+	})
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+	return &BoltStateStore{db: db}, nil
+}
+
+func (bs *BoltStateStore) Load(key string) ([]byte, error) {
+	var data []byte
+	err := bs.db.View(func(tx *bolt.Tx) error {
+		if v := tx.Bucket(stateBucket).Get([]byte(key)); v != nil {
+			data = append([]byte(nil), v...)
+		}
+		return nil
+	})
+	return data, err
+}
+
+func (bs *BoltStateStore) Save(key string, data []byte) error {
+	return bs.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(stateBucket).Put([]byte(key), data)
+	})
+}
+
+func (bs *BoltStateStore) Close() error {
+	return bs.db.Close()
+}
+
+/**
+Checkpointer 在启动时从 StateStore 恢复各个 collector 的状态，之后按 Interval 定期保存，
+并导出距上次成功保存的时间
+*/
+
+type Checkpointer struct {
+	Store    StateStore
+	Interval time.Duration
+	States   []Stateful
+
+	mu                 sync.Mutex
+	lastCheckpoint     time.Time
+	failureCount       int
+	CheckpointAge      *prometheus.Desc
+	CheckpointFailures *prometheus.Desc
+}
+
+func (cp *Checkpointer) restore() error {
+	for _, s := range cp.States {
+		data, err := cp.Store.Load(s.StateKey())
+		if err != nil {
+			return err
+		}
+		if data == nil {
+			continue
+		}
+		if err := s.Restore(data); err != nil {
+			return errors.New(s.StateKey() + ": " + err.Error())
+		}
+	}
+	return nil
+}
+
+func (cp *Checkpointer) Checkpoint() error {
+	for _, s := range cp.States {
+		data, err := s.Snapshot()
+		if err == nil {
+			err = cp.Store.Save(s.StateKey(), data)
+		}
+		if err != nil {
+			cp.mu.Lock()
+			cp.failureCount++
+			cp.mu.Unlock()
+			return errors.New(s.StateKey() + ": " + err.Error())
+		}
+	}
+	cp.mu.Lock()
+	cp.lastCheckpoint = time.Now()
+	cp.mu.Unlock()
+	return nil
+}
+
+/**
+定期保存状态，直到 stop 被关闭；退出前再保存一次
+*/
+
+func (cp *Checkpointer) Run(stop <-chan struct{}) {
+	ticker := time.NewTicker(cp.Interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			if err := cp.Checkpoint(); err != nil {
+				log.Println("Error while saving state: " + err.Error())
+			}
+		case <-stop:
+			if err := cp.Checkpoint(); err != nil {
+				log.Println("Error while saving state: " + err.Error())
+			}
+			return
+		}
+	}
+}
+
+func (cp *Checkpointer) Collect(ch chan<- prometheus.Metric) {
+	cp.mu.Lock()
+	defer cp.mu.Unlock()
+	ch <- prometheus.MustNewConstMetric(cp.CheckpointAge, prometheus.GaugeValue, time.Since(cp.lastCheckpoint).Seconds())
+	ch <- prometheus.MustNewConstMetric(cp.CheckpointFailures, prometheus.CounterValue, float64(cp.failureCount))
+}
+
+func (cp *Checkpointer) Describe(ch chan<- *prometheus.Desc) {
+	ch <- cp.CheckpointAge
+	ch <- cp.CheckpointFailures
+}
+
+/**
+创建 Checkpointer 并立即恢复状态；在恢复之前的启动时间视为最近一次保存的时间
+*/
+
+func NewCheckpointer(store StateStore, interval time.Duration, states ...Stateful) (*Checkpointer, error) {
+	cp := &Checkpointer{
+		Store:              store,
+		Interval:           interval,
+		States:             states,
+		lastCheckpoint:     time.Now(),
+		CheckpointAge:      newFuncMetric("state_checkpoint_age_seconds", "Seconds since the collector state was last saved", nil, nil),
+		CheckpointFailures: newFuncMetric("state_checkpoint_failures_total", "Number of errors while saving the collector state", nil, nil),
+	}
+	if err := cp.restore(); err != nil {
+		return nil, err
+	}
+	return cp, nil
+}
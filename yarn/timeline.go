@@ -0,0 +1,276 @@
+package yarn
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"log"
+	"net/url"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+)
+
+/**
+定义 Timeline Reader 的 response body
+*/
+
+type timelineEntity struct {
+	Id      string            `json:"id"`
+	Type    string            `json:"type"`
+	Info    timelineInfo      `json:"info"`
+	Metrics []*timelineMetric `json:"metrics"`
+}
+type timelineInfo struct {
+	User        string `json:"SYSTEM_INFO_USER"`
+	FlowName    string `json:"SYSTEM_INFO_FLOW_NAME"`
+	FinalStatus string `json:"YARN_APPLICATION_FINAL_STATUS"`
+}
+type timelineMetric struct {
+	Id     string             `json:"id"`
+	Values map[string]float64 `json:"values"`
+}
+
+/**
+取时间戳最新的值，SINGLE_VALUE 类型的指标只有一个值
+*/
+
+func (m *timelineMetric) latest() float64 {
+	var latestTs int64 = -1
+	var value float64
+	for ts, v := range m.Values {
+		t, err := strconv.ParseInt(ts, 10, 64)
+		if err != nil {
+			continue
+		}
+		if t > latestTs {
+			latestTs, value = t, v
+		}
+	}
+	return value
+}
+
+// ATSv2 中应用资源用量的指标 id，flow run 上为所有应用的合计
+const (
+	timelineMemoryMetric = "YARN_APPLICATION_MEMORY"
+	timelineCPUMetric    = "YARN_APPLICATION_CPU"
+)
+
+func (tc *TimelineCollector) labels() []string {
+	var labels []string
+	return append(labels, "user", "flow")
+}
+
+/**
+TimelineCollector 在后台每隔 Interval 从 ATSv2 Timeline Reader 读取最近 LookbackDays 天内活跃的 flow，
+并按 flow 汇总 run 数、application 数、memory-seconds 和 vcore-seconds。
+每个 flow 要请求 runs 和 apps 两次，Collect 只输出上一次拉取的结果，不请求 Timeline Reader
+*/
+
+type TimelineCollector struct {
+	variants
+	TimelineEndpoint *url.URL
+	LookbackDays     int
+	FlowLimit        int
+	Interval         time.Duration
+
+	mu            sync.Mutex
+	up            bool
+	flows         []*timelineFlowTotals
+	Up            *prometheus.Desc
+	FlowRuns      *prometheus.Desc
+	FlowApps      *prometheus.Desc
+	MemorySeconds *prometheus.Desc
+	VCoreSeconds  *prometheus.Desc
+}
+
+type timelineFlowTotals struct {
+	User          string
+	Flow          string
+	Runs          int
+	Apps          map[string]int
+	MemorySeconds float64
+	VCoreSeconds  float64
+}
+
+func (tc *TimelineCollector) Collect(ch chan<- prometheus.Metric) {
+	tc.mu.Lock()
+	defer tc.mu.Unlock()
+
+	up := 0.0
+	if tc.up {
+		up = 1.0
+	}
+	ch <- prometheus.MustNewConstMetric(tc.Up, prometheus.GaugeValue, up)
+	for _, f := range tc.flows {
+		ch <- prometheus.MustNewConstMetric(tc.FlowRuns, prometheus.GaugeValue, float64(f.Runs), f.User, f.Flow)
+		for finalStatus, n := range f.Apps {
+			ch <- prometheus.MustNewConstMetric(tc.FlowApps, prometheus.GaugeValue, float64(n), f.User, f.Flow, finalStatus)
+		}
+		ch <- prometheus.MustNewConstMetric(tc.MemorySeconds, prometheus.GaugeValue, f.MemorySeconds, f.User, f.Flow)
+		ch <- prometheus.MustNewConstMetric(tc.VCoreSeconds, prometheus.GaugeValue, f.VCoreSeconds, f.User, f.Flow)
+	}
+}
+
+func (tc *TimelineCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- tc.Up
+	ch <- tc.FlowRuns
+	ch <- tc.FlowApps
+	ch <- tc.MemorySeconds
+	ch <- tc.VCoreSeconds
+}
+
+/**
+立即拉取一次，之后按 Interval 定期拉取，直到 stop 被关闭
+*/
+
+func (tc *TimelineCollector) Run(stop <-chan struct{}) {
+	ticker := time.NewTicker(tc.Interval)
+	defer ticker.Stop()
+	for {
+		if err := tc.Poll(); err != nil {
+			log.Println("Error while collecting data from Timeline Reader: " + err.Error())
+		}
+		select {
+		case <-ticker.C:
+		case <-stop:
+			return
+		}
+	}
+}
+
+/**
+拉取活跃 flow 的 runs 和 apps 并替换上一次的结果。flow 列表拉取失败时 up 为 0，
+保留上一次的结果；单个 flow 拉取失败时跳过该 flow
+*/
+
+func (tc *TimelineCollector) Poll() error {
+	flows, err := tc.fetchFlows()
+	if err != nil {
+		tc.mu.Lock()
+		tc.up = false
+		tc.mu.Unlock()
+		return err
+	}
+
+	var totals []*timelineFlowTotals
+	for _, f := range uniqueFlows(flows) {
+		t, err := tc.fetchFlow(f.Info.User, f.Info.FlowName)
+		if err != nil {
+			log.Println("Error while collecting data from Timeline Reader: " + err.Error())
+			continue
+		}
+		totals = append(totals, t)
+	}
+	sort.Slice(totals, func(i, k int) bool {
+		if totals[i].User != totals[k].User {
+			return totals[i].User < totals[k].User
+		}
+		return totals[i].Flow < totals[k].Flow
+	})
+
+	tc.mu.Lock()
+	defer tc.mu.Unlock()
+	tc.up = true
+	tc.flows = totals
+	return nil
+}
+
+func (tc *TimelineCollector) fetchFlow(user string, flow string) (*timelineFlowTotals, error) {
+	runs, err := tc.fetchEntities(user, flow, "runs", "METRICS")
+	if err != nil {
+		return nil, err
+	}
+	apps, err := tc.fetchEntities(user, flow, "apps", "INFO")
+	if err != nil {
+		return nil, err
+	}
+
+	t := &timelineFlowTotals{User: user, Flow: flow, Runs: len(runs), Apps: make(map[string]int)}
+	for _, r := range runs {
+		for _, m := range r.Metrics {
+			switch m.Id {
+			case timelineMemoryMetric:
+				t.MemorySeconds += m.latest()
+			case timelineCPUMetric:
+				t.VCoreSeconds += m.latest()
+			}
+		}
+	}
+	// 运行中的应用还没有 final status
+	for _, a := range apps {
+		finalStatus := a.Info.FinalStatus
+		if finalStatus == "" {
+			finalStatus = "UNDEFINED"
+		}
+		t.Apps[finalStatus]++
+	}
+	return t, nil
+}
+
+/**
+flow activity 每天一条，跨天活跃的 flow 会出现多次；按 (user, flow) 去重，每个 flow 只请求一次 runs
+*/
+
+func uniqueFlows(flows []*timelineEntity) []*timelineEntity {
+	seen := make(map[[2]string]bool, len(flows))
+	unique := make([]*timelineEntity, 0, len(flows))
+	for _, f := range flows {
+		key := [2]string{f.Info.User, f.Info.FlowName}
+		if seen[key] {
+			continue
+		}
+		seen[key] = true
+		unique = append(unique, f)
+	}
+	return unique
+}
+
+func (tc *TimelineCollector) lookbackStart() time.Time {
+	return time.Now().AddDate(0, 0, -tc.LookbackDays)
+}
+
+func (tc *TimelineCollector) fetchFlows() ([]*timelineEntity, error) {
+	endpoint := joinPath(tc.TimelineEndpoint, "flows")
+	q := endpoint.Query()
+	q.Set("limit", strconv.Itoa(tc.FlowLimit))
+	q.Set("daterange", tc.lookbackStart().Format("20060102")+"-")
+	endpoint.RawQuery = q.Encode()
+
+	var flows []*timelineEntity
+	if err := fetchJSON(endpoint, &flows); err != nil {
+		return nil, err
+	}
+	return flows, nil
+}
+
+// entities 为 runs 或 apps，只取 lookback 窗口内创建的实体
+func (tc *TimelineCollector) fetchEntities(user string, flow string, entities string, fields string) ([]*timelineEntity, error) {
+	endpoint := joinPath(tc.TimelineEndpoint, "users/"+url.PathEscape(user)+"/flows/"+url.PathEscape(flow)+"/"+entities)
+	q := endpoint.Query()
+	q.Set("fields", fields)
+	q.Set("createdtimestart", strconv.FormatInt(tc.lookbackStart().UnixMilli(), 10))
+	endpoint.RawQuery = q.Encode()
+
+	var result []*timelineEntity
+	if err := fetchJSON(endpoint, &result); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+func NewTimelineCollector(endpoint *url.URL, lookbackDays int, flowLimit int, interval time.Duration) *TimelineCollector {
+	labels := new(TimelineCollector).labels()
+	vs := make(variants)
+	return &TimelineCollector{
+		variants:         vs,
+		TimelineEndpoint: endpoint,
+		LookbackDays:     lookbackDays,
+		FlowLimit:        flowLimit,
+		Interval:         interval,
+		Up:               vs.newFuncMetric("timeline_up", "Able to contact the Timeline Reader on the last poll", nil, nil),
+		FlowRuns:         vs.newFuncMetric("timeline_flow_runs", "flow runs created in the lookback window", labels, nil),
+		FlowApps:         vs.newFuncMetric("timeline_flow_apps", "applications of the flow created in the lookback window", append(labels, "finalStatus"), nil),
+		MemorySeconds:    vs.newFuncMetric("timeline_flow_memory_seconds", "memory seconds of flow runs in the lookback window :MB", labels, nil),
+		VCoreSeconds:     vs.newFuncMetric("timeline_flow_v_core_seconds", "core seconds of flow runs in the lookback window", labels, nil),
+	}
+}